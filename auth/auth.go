@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"ExecutionEngine/log"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"os"
+	"slices"
+	"strings"
+)
+
+// APIKeyHeader carries an API key, a JWT is sent as a bearer token of the
+// authorization header.
+const APIKeyHeader = "x-api-key"
+
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+type Options struct {
+	// APIKeyHashes maps the hex encoded SHA-256 digests of API keys to the
+	// names of their clients
+	APIKeyHashes map[string]string
+	// Clients are the names tokens may carry as subject
+	Clients []string
+	JWT     *JWTOptions
+}
+
+type JWTOptions struct {
+	Issuer        string
+	Audience      string
+	SecretFile    string
+	PublicKeyFile string
+}
+
+// Authenticator maps the credentials of a call to the name of a client.
+type Authenticator struct {
+	apiKeys map[[sha256.Size]byte]string
+	clients map[string]bool
+	parser  *jwt.Parser
+	key     interface{}
+}
+
+func New(options *Options) (error, *Authenticator) {
+	a := &Authenticator{
+		apiKeys: map[[sha256.Size]byte]string{},
+		clients: map[string]bool{},
+	}
+	for hash, client := range options.APIKeyHashes {
+		var digest [sha256.Size]byte
+		if n, err := hex.Decode(digest[:], []byte(hash)); err != nil || n != sha256.Size {
+			return fmt.Errorf("API key hash of client %q is not a SHA-256 digest", client), nil
+		}
+		a.apiKeys[digest] = client
+	}
+	for _, client := range options.Clients {
+		a.clients[client] = true
+	}
+
+	if jwtOptions := options.JWT; jwtOptions != nil && (jwtOptions.SecretFile != "" || jwtOptions.PublicKeyFile != "") {
+		err, key, methods := readKey(jwtOptions)
+		if err != nil {
+			return err, nil
+		}
+		parserOptions := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+		if jwtOptions.Issuer != "" {
+			parserOptions = append(parserOptions, jwt.WithIssuer(jwtOptions.Issuer))
+		}
+		if jwtOptions.Audience != "" {
+			parserOptions = append(parserOptions, jwt.WithAudience(jwtOptions.Audience))
+		}
+		a.parser = jwt.NewParser(parserOptions...)
+		a.key = key
+	}
+
+	return nil, a
+}
+
+// readKey returns the key verifying tokens and the signing methods allowed
+// with it.
+func readKey(options *JWTOptions) (error, interface{}, []string) {
+	if options.SecretFile != "" {
+		secret, err := os.ReadFile(options.SecretFile)
+		if err != nil {
+			return fmt.Errorf("failed to read JWT secret: %w", err), nil, nil
+		}
+		return nil, []byte(strings.TrimSpace(string(secret))), []string{"HS256", "HS384", "HS512"}
+	}
+
+	pem, err := os.ReadFile(options.PublicKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read JWT public key: %w", err), nil, nil
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return nil, key, []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return nil, key, []string{"ES256", "ES384", "ES512"}
+	}
+	return errors.New("JWT public key is neither an RSA nor an ECDSA key"), nil, nil
+}
+
+// Authenticate returns the client whose API key or token came with the call.
+func (a *Authenticator) Authenticate(ctx context.Context) (error, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(APIKeyHeader); len(keys) > 0 {
+		return a.authenticateAPIKey(keys[0])
+	}
+	if authorization := md.Get("authorization"); len(authorization) > 0 {
+		token, found := strings.CutPrefix(authorization[0], "Bearer ")
+		if !found {
+			return ErrUnauthenticated, ""
+		}
+		return a.authenticateToken(token)
+	}
+	return ErrUnauthenticated, ""
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (error, string) {
+	digest := sha256.Sum256([]byte(key))
+	// Comparing every digest keeps the time independent of the key
+	client := ""
+	for candidate, name := range a.apiKeys {
+		if subtle.ConstantTimeCompare(candidate[:], digest[:]) == 1 {
+			client = name
+		}
+	}
+	if client == "" {
+		return ErrUnauthenticated, ""
+	}
+	return nil, client
+}
+
+func (a *Authenticator) authenticateToken(token string) (error, string) {
+	if a.parser == nil {
+		return ErrUnauthenticated, ""
+	}
+	parsed, err := a.parser.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return a.key, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnauthenticated, err), ""
+	}
+	subject, err := parsed.Claims.GetSubject()
+	if err != nil || !a.clients[subject] {
+		return fmt.Errorf("%w: unknown subject %q", ErrUnauthenticated, subject), ""
+	}
+	return nil, subject
+}
+
+type contextKey struct{}
+
+// WithClient returns a copy of ctx carrying the name of the calling client.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// ClientFromContext returns the name of the calling client, or an empty
+// string for unauthenticated calls.
+func ClientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(contextKey{}).(string)
+	return client
+}
+
+// UnaryServerInterceptor rejects calls without valid credentials with
+// UNAUTHENTICATED. authenticate returns the authenticator to use, nil lets
+// every call through. publicMethods are the full names of methods callable
+// without credentials.
+func UnaryServerInterceptor(authenticate func() *Authenticator, publicMethods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		a := authenticate()
+		if a == nil || slices.Contains(publicMethods, info.FullMethod) {
+			return handler(ctx, request)
+		}
+		err, client := a.Authenticate(ctx)
+		if err != nil {
+			log.FromContext(ctx).Info("Rejected unauthenticated call", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+		ctx = log.With(WithClient(ctx, client), zap.String("client", client))
+		return handler(ctx, request)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(authenticate func() *Authenticator, publicMethods ...string) grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		a := authenticate()
+		if a == nil || slices.Contains(publicMethods, info.FullMethod) {
+			return handler(server, stream)
+		}
+		ctx := stream.Context()
+		err, client := a.Authenticate(ctx)
+		if err != nil {
+			log.FromContext(ctx).Info("Rejected unauthenticated call", zap.String("method", info.FullMethod), zap.Error(err))
+			return status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+		ctx = log.With(WithClient(ctx, client), zap.String("client", client))
+		return handler(server, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticatedStream passes the client to the handler through its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
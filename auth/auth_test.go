@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hash(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+func incoming(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestAPIKeys(t *testing.T) {
+	err, a := New(&Options{APIKeyHashes: map[string]string{hash("secret-a"): "a", hash("secret-b"): "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		client string
+	}{
+		{"first key", incoming(APIKeyHeader, "secret-a"), "a"},
+		{"second key", incoming(APIKeyHeader, "secret-b"), "b"},
+		{"unknown key", incoming(APIKeyHeader, "secret-c"), ""},
+		{"no credentials", context.Background(), ""},
+		{"token without JWT settings", incoming("authorization", "Bearer token"), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, client := a.Authenticate(test.ctx)
+			if test.client == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("error = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil || client != test.client {
+				t.Errorf("Authenticate = %v, %q, want %q", err, client, test.client)
+			}
+		})
+	}
+}
+
+func TestHMACTokens(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("shared secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err, a := New(&Options{
+		Clients: []string{"lms"},
+		JWT:     &JWTOptions{Issuer: "issuer", Audience: "engine", SecretFile: secretFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(claims jwt.MapClaims, secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "lms", "iss": "issuer", "aud": "engine", "exp": time.Now().Add(time.Minute).Unix()}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		accepted bool
+	}{
+		{"valid", sign(valid(), "shared secret"), true},
+		{"wrong secret", sign(valid(), "other secret"), false},
+		{"expired", sign(with("exp", time.Now().Add(-time.Minute).Unix()), "shared secret"), false},
+		{"no expiry", sign(with("exp", nil), "shared secret"), false},
+		{"wrong issuer", sign(with("iss", "other"), "shared secret"), false},
+		{"wrong audience", sign(with("aud", "other"), "shared secret"), false},
+		{"unknown subject", sign(with("sub", "other"), "shared secret"), false},
+		{"unsigned", func() string {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}(), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, client := a.Authenticate(incoming("authorization", "Bearer "+test.token))
+			if test.accepted && (err != nil || client != "lms") {
+				t.Errorf("Authenticate = %v, %q, want lms", err, client)
+			}
+			if !test.accepted && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("error = %v, want ErrUnauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestPublicKeyTokens(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err, a := New(&Options{Clients: []string{"lms"}, JWT: &JWTOptions{PublicKeyFile: publicKeyFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"sub": "lms",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, client := a.Authenticate(incoming("authorization", "Bearer "+token)); err != nil || client != "lms" {
+		t.Errorf("Authenticate = %v, %q, want lms", err, client)
+	}
+
+	// A token signed with the public key as HMAC secret must not pass
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "lms",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := a.Authenticate(incoming("authorization", "Bearer "+forged)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("forged token error = %v, want ErrUnauthenticated", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/config"
+	"ExecutionEngine/loadgen"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	server "ExecutionEngine/server"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// benchmarkRequests is how many requests are drawn from the mix when the
+// benchmark runs for a duration, they are submitted in a cycle.
+const benchmarkRequests = 1000
+
+// benchmark drives an engine with a mix of jobs and writes a report. The
+// engine runs in this process with cfg unless -address names a remote one.
+func benchmark(cfg *config.Config, arguments []string) error {
+	flags := flag.NewFlagSet("benchmark", flag.ContinueOnError)
+	address := flags.String("address", "", "address of the gRPC server to benchmark, an engine is started in this process with the configuration when empty")
+	apiKey := flags.String("api-key", os.Getenv("EXECUTION_ENGINE_API_KEY"), "API key sent to the gRPC server, defaults to $EXECUTION_ENGINE_API_KEY")
+	useTLS := flags.Bool("tls", false, "connect to the gRPC server with TLS")
+	caFile := flags.String("ca-file", "", "PEM file of the authorities of the server certificate, the system ones when empty")
+	mixName := flags.String("mix", "hello", fmt.Sprintf("built-in mix (%s) or JSON file of weighted job requests", strings.Join(loadgen.BuiltinMixNames(), ", ")))
+	jobs := flags.Int("jobs", 100, "number of jobs to submit")
+	duration := flags.Duration("duration", 0, "submit jobs for this long instead of a number of jobs")
+	concurrency := flags.Int("concurrency", 0, "number of jobs submitted at once, twice the workers in process and 16 over gRPC when 0")
+	warmup := flags.Int("warmup", 0, "number of jobs submitted before measuring")
+	seed := flags.Uint64("seed", 1, "seed drawing the jobs from the mix")
+	useCache := flags.Bool("cache", false, "let the engine serve responses from its result cache")
+	format := flags.String("format", "json", "format of the report, json or csv")
+	output := flags.String("output", "", "file the report is written to, CSV rows are appended to an existing file; the standard output when empty")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] benchmark [benchmark flags]\n\nThe flags before benchmark configure the engine run in process, e.g. -workers.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown report format %q", *format)
+	}
+
+	mix, ok := loadgen.BuiltinMix(*mixName)
+	if !ok {
+		file, err := os.Open(*mixName)
+		if err != nil {
+			return fmt.Errorf("%q is neither a built-in mix nor a readable file: %w", *mixName, err)
+		}
+		err, mix = loadgen.ReadMix(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("cannot read mix: %w", err)
+		}
+	}
+	count := *jobs
+	if *duration > 0 {
+		count = benchmarkRequests
+	}
+	random := rand.New(rand.NewPCG(*seed, 0))
+	requests := mix.Requests(count, random)
+	warmupRequests := mix.Requests(*warmup, random)
+	for _, request := range append(requests, warmupRequests...) {
+		request.BypassCache = !*useCache
+	}
+
+	var submit loadgen.SubmitFunc
+	var target string
+	var workers int
+	if *address == "" {
+		s, stop := startBenchmarkServer(cfg)
+		defer stop()
+		submit = s.Submit
+		target = "in-process"
+		workers = cfg.Pool.Workers
+		if *concurrency == 0 {
+			*concurrency = 2 * workers
+		}
+	} else {
+		err, connection := dialBenchmark(*address, *useTLS, *caFile)
+		if err != nil {
+			return err
+		}
+		defer connection.Close()
+		client := job.NewJobClient(connection)
+		submit = func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+			if *apiKey != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, auth.APIKeyHeader, *apiKey)
+			}
+			return client.Submit(ctx, request)
+		}
+		target = *address
+		if *concurrency == 0 {
+			*concurrency = 16
+		}
+	}
+
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopSignals()
+	if len(warmupRequests) > 0 {
+		log.L().Info("Warming up", zap.Int("jobs", len(warmupRequests)))
+		loadgen.Run(ctx, submit, warmupRequests, &loadgen.Options{Concurrency: *concurrency})
+	}
+	log.L().Info("Running benchmark", zap.String("target", target), zap.String("mix", *mixName), zap.Int("concurrency", *concurrency))
+	startedAt := time.Now()
+	stats := loadgen.Run(ctx, submit, requests, &loadgen.Options{
+		Concurrency: *concurrency,
+		Duration:    *duration,
+	})
+
+	report := loadgen.NewReport(stats)
+	report.StartedAt = startedAt
+	report.Target = target
+	report.Mix = *mixName
+	report.Workers = workers
+	report.Concurrency = *concurrency
+	log.L().Info("Benchmark finished", zap.Int("jobs", report.Jobs), zap.Int("failures", report.Failures),
+		zap.Float64("successfulJobsPerSecond", report.Throughput), zap.Float64("latencyP99Milliseconds", report.Latency.P99))
+	return writeReport(report, *format, *output)
+}
+
+// startBenchmarkServer starts an engine that only serves this process: no
+// authentication, quotas, listeners or persistent records.
+func startBenchmarkServer(cfg *config.Config) (*server.Server, func()) {
+	cfg.Server.ListenAddress = "127.0.0.1:0"
+	cfg.Gateway.ListenAddress = ""
+	cfg.Metrics.ListenAddress = ""
+	cfg.Auth.Enabled = false
+	cfg.Quotas = config.QuotasConfig{Key: cfg.Quotas.Key}
+	cfg.Store.Backend = config.StoreMemory
+	cfg.Health.DrainDelay = 0
+
+	s := server.NewServer(cfg)
+	s.Initialize()
+	served := make(chan struct{})
+	go func() {
+		s.Serve()
+		close(served)
+	}()
+	<-s.Started()
+	return s, func() {
+		s.Drain()
+		<-served
+	}
+}
+
+func dialBenchmark(address string, useTLS bool, caFile string) (error, *grpc.ClientConn) {
+	transportCredentials := insecure.NewCredentials()
+	if useTLS {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return err, nil
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("%s contains no certificate", caFile), nil
+			}
+		}
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+	connection, err := grpc.NewClient(address, grpc.WithTransportCredentials(transportCredentials))
+	return err, connection
+}
+
+func writeReport(report *loadgen.Report, format, output string) error {
+	var w io.Writer = os.Stdout
+	header := true
+	if output != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if format == "csv" {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			if info, err := os.Stat(output); err == nil && info.Size() > 0 {
+				header = false
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		file, err := os.OpenFile(output, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if format == "csv" {
+		return report.WriteCSV(w, header)
+	}
+	return report.WriteJSON(w)
+}
@@ -0,0 +1,227 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("blob not found")
+	ErrTooLarge       = errors.New("blob exceeds the size limit")
+	ErrDigestMismatch = errors.New("content does not match the expected SHA-256")
+)
+
+type Options struct {
+	Directory string
+	// MaxBytes and MaxBlobBytes bound the directory and single blobs, zero
+	// means unbounded
+	MaxBytes     int64
+	MaxBlobBytes int64
+}
+
+type Info struct {
+	// Digest is the SHA-256 of the content in lowercase hex
+	Digest string
+	Size   int64
+}
+
+// Store keeps blobs in a directory, one file named after the digest of its
+// content per blob. The modification time of a file is its last use, the
+// least recently used blobs are evicted first, except for pinned ones.
+type Store struct {
+	options *Options
+	lock    sync.Mutex
+	// pins counts the pins of each pinned blob
+	pins map[string]int
+}
+
+func NewStore(options *Options) (error, *Store) {
+	if err := os.MkdirAll(options.Directory, 0700); err != nil {
+		return err, nil
+	}
+
+	// Blobs being uploaded when the engine stopped are incomplete
+	temporaryFiles, err := filepath.Glob(filepath.Join(options.Directory, "*.tmp"))
+	if err != nil {
+		return err, nil
+	}
+	for _, file := range temporaryFiles {
+		os.Remove(file)
+	}
+
+	return nil, &Store{
+		options: options,
+		pins:    map[string]int{},
+	}
+}
+
+// ValidDigest reports whether digest is a SHA-256 in lowercase hex.
+func ValidDigest(digest string) bool {
+	if len(digest) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil && strings.ToLower(digest) == digest
+}
+
+// Put stores content while hashing it, without holding it in memory. When
+// expected is not empty the content must hash to it. A blob only becomes
+// visible once it was written completely.
+func (s *Store) Put(content io.Reader, expected string) (error, *Info) {
+	file, err := os.CreateTemp(s.options.Directory, "*.tmp")
+	if err != nil {
+		return err, nil
+	}
+	defer os.Remove(file.Name())
+
+	if s.options.MaxBlobBytes > 0 {
+		content = io.LimitReader(content, s.options.MaxBlobBytes+1)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err, nil
+	}
+	if s.options.MaxBlobBytes > 0 && written > s.options.MaxBlobBytes {
+		return fmt.Errorf("%w of %d bytes", ErrTooLarge, s.options.MaxBlobBytes), nil
+	}
+	info := &Info{Digest: hex.EncodeToString(hash.Sum(nil)), Size: written}
+	if expected != "" && expected != info.Digest {
+		return fmt.Errorf("%w %s, got %s", ErrDigestMismatch, expected, info.Digest), nil
+	}
+
+	if err := os.Rename(file.Name(), s.path(info.Digest)); err != nil {
+		return err, nil
+	}
+	now := time.Now()
+	os.Chtimes(s.path(info.Digest), now, now)
+	return s.evict(), info
+}
+
+// Stat returns ErrNotFound when there is no blob with digest.
+func (s *Store) Stat(digest string) (error, *Info) {
+	if !ValidDigest(digest) {
+		return ErrNotFound, nil
+	}
+	fileInfo, err := os.Stat(s.path(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound, nil
+	}
+	if err != nil {
+		return err, nil
+	}
+	return nil, &Info{Digest: digest, Size: fileInfo.Size()}
+}
+
+// Pin keeps the blob with digest from being evicted until the returned
+// function is called, or returns ErrNotFound. Blobs pinned more than once
+// stay until every pin was released.
+func (s *Store) Pin(digest string) (error, func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err, _ := s.Stat(digest); err != nil {
+		return err, nil
+	}
+	s.pins[digest]++
+
+	var once sync.Once
+	return nil, func() {
+		once.Do(func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			if s.pins[digest]--; s.pins[digest] == 0 {
+				delete(s.pins, digest)
+			}
+		})
+	}
+}
+
+// Open returns the content of a blob and its size, or ErrNotFound.
+func (s *Store) Open(digest string) (error, io.ReadCloser, int64) {
+	if !ValidDigest(digest) {
+		return ErrNotFound, nil, 0
+	}
+	path := s.path(digest)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound, nil, 0
+	}
+	if err != nil {
+		return err, nil, 0
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err, nil, 0
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return nil, file, fileInfo.Size()
+}
+
+func (s *Store) path(digest string) string {
+	return filepath.Join(s.options.Directory, digest)
+}
+
+// evict removes the least recently used blobs that are not pinned until the
+// directory fits MaxBytes. Blobs being read stay readable until they are
+// closed.
+func (s *Store) evict() error {
+	if s.options.MaxBytes <= 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries, err := os.ReadDir(s.options.Directory)
+	if err != nil {
+		return err
+	}
+	var infos []os.FileInfo
+	var size int64
+	for _, entry := range entries {
+		if !ValidDigest(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed concurrently
+			continue
+		}
+		infos = append(infos, info)
+		size += info.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		if size <= s.options.MaxBytes {
+			break
+		}
+		if s.pins[info.Name()] > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.options.Directory, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		size -= info.Size()
+	}
+	return nil
+}
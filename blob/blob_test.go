@@ -0,0 +1,150 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T, options *Options) *Store {
+	t.Helper()
+
+	options.Directory = t.TempDir()
+	err, s := NewStore(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStore(t *testing.T) {
+	s := newStore(t, &Options{MaxBlobBytes: 10})
+
+	err, info := s.Put(strings.NewReader("content"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Digest != digest("content") || info.Size != 7 {
+		t.Errorf("info = %+v", info)
+	}
+	err, reader, size := s.Open(info.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "content" || size != 7 {
+		t.Errorf("blob = %q of %d bytes", content, size)
+	}
+	if err, stat := s.Stat(info.Digest); err != nil || *stat != *info {
+		t.Errorf("stat = %+v, %v", stat, err)
+	}
+
+	for _, missing := range []string{digest("other"), "../" + info.Digest[3:], strings.ToUpper(info.Digest)} {
+		if err, _, _ := s.Open(missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("opening %q: %v, want ErrNotFound", missing, err)
+		}
+	}
+
+	if err, _ := s.Put(strings.NewReader("more than ten bytes"), ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("error = %v, want ErrTooLarge", err)
+	}
+	if err, _ := s.Put(strings.NewReader("content"), digest("other")); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("error = %v, want ErrDigestMismatch", err)
+	}
+	if err, _ := s.Put(strings.NewReader("other"), digest("other")); err != nil {
+		t.Errorf("upload with the right digest: %v", err)
+	}
+	temporaryFiles, _ := filepath.Glob(filepath.Join(s.options.Directory, "*.tmp"))
+	if len(temporaryFiles) != 0 {
+		t.Errorf("temporary files left behind: %v", temporaryFiles)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	s := newStore(t, &Options{MaxBytes: 20})
+
+	base := time.Now().Add(-time.Hour)
+	var digests []string
+	for i, content := range []string{"0123456789", "abcdefghij"} {
+		err, info := s.Put(strings.NewReader(content), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		used := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(s.path(info.Digest), used, used)
+		digests = append(digests, info.Digest)
+	}
+
+	// Opening the first blob marks it as recently used, so the second one is
+	// evicted
+	err, reader, _ := s.Open(digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	if err, _ := s.Put(strings.NewReader("ABCDEFGHIJ"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := s.Stat(digests[0]); err != nil {
+		t.Errorf("recently used blob: %v", err)
+	}
+	if err, _ := s.Stat(digests[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("least recently used blob: %v, want ErrNotFound", err)
+	}
+}
+
+func TestPin(t *testing.T) {
+	s := newStore(t, &Options{MaxBytes: 10})
+
+	err, info := s.Put(strings.NewReader("0123456789"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := s.Pin(digest("missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pinning a missing blob: %v, want ErrNotFound", err)
+	}
+	err, unpin := s.Pin(info.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, unpinAgain := s.Pin(info.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pinned blob stays even though the store is over its size
+	if err, _ := s.Put(strings.NewReader("abcdefghij"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := s.Stat(info.Digest); err != nil {
+		t.Errorf("pinned blob: %v", err)
+	}
+	unpin()
+	unpin()
+	if err, _ := s.Put(strings.NewReader("ABCDEFGHIJ"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := s.Stat(info.Digest); err != nil {
+		t.Errorf("blob still pinned once: %v", err)
+	}
+
+	unpinAgain()
+	if err, _ := s.Put(strings.NewReader("KLMNOPQRST"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := s.Stat(info.Digest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unpinned blob: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const artifactExtension = ".tar"
+
+var errArtifactTooLarge = errors.New("artifact exceeds the size limit")
+
+type ArtifactOptions struct {
+	Directory string
+	// MaxBytes and MaxArtifactBytes bound the directory and single
+	// artifacts, zero means unbounded
+	MaxBytes         int64
+	MaxArtifactBytes int64
+}
+
+// ArtifactCache keeps archives in a directory, one file per key. The
+// modification time of a file is its last use, the least recently used
+// archives are evicted first.
+type ArtifactCache struct {
+	options *ArtifactOptions
+	lock    sync.Mutex
+}
+
+func NewArtifactCache(options *ArtifactOptions) (error, *ArtifactCache) {
+	if err := os.MkdirAll(options.Directory, 0700); err != nil {
+		return err, nil
+	}
+
+	// Archives being written when the engine stopped are incomplete
+	temporaryFiles, err := filepath.Glob(filepath.Join(options.Directory, "*.tmp"))
+	if err != nil {
+		return err, nil
+	}
+	for _, file := range temporaryFiles {
+		os.Remove(file)
+	}
+
+	return nil, &ArtifactCache{
+		options: options,
+	}
+}
+
+// Get returns nil when there is no archive for key.
+func (c *ArtifactCache) Get(key string) (error, io.ReadCloser) {
+	path := c.path(key)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return err, nil
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return nil, file
+}
+
+// Put stores archive under key. The archive only becomes visible once it was
+// written completely, so concurrent readers never see a partial one.
+func (c *ArtifactCache) Put(key string, archive io.Reader) error {
+	file, err := os.CreateTemp(c.options.Directory, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	content := archive
+	if c.options.MaxArtifactBytes > 0 {
+		content = io.LimitReader(archive, c.options.MaxArtifactBytes+1)
+	}
+	written, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if c.options.MaxArtifactBytes > 0 && written > c.options.MaxArtifactBytes {
+		return fmt.Errorf("%w of %d bytes", errArtifactTooLarge, c.options.MaxArtifactBytes)
+	}
+
+	if err := os.Rename(file.Name(), c.path(key)); err != nil {
+		return err
+	}
+	return c.evict()
+}
+
+func (c *ArtifactCache) path(key string) string {
+	return filepath.Join(c.options.Directory, key+artifactExtension)
+}
+
+// evict removes the least recently used archives until the directory fits
+// MaxBytes.
+func (c *ArtifactCache) evict() error {
+	if c.options.MaxBytes <= 0 {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries, err := os.ReadDir(c.options.Directory)
+	if err != nil {
+		return err
+	}
+	var infos []os.FileInfo
+	var size int64
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), artifactExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed concurrently
+			continue
+		}
+		infos = append(infos, info)
+		size += info.Size()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		if size <= c.options.MaxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.options.Directory, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		size -= info.Size()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newArtifactCache(t *testing.T, options *ArtifactOptions) *ArtifactCache {
+	t.Helper()
+
+	options.Directory = t.TempDir()
+	err, c := NewArtifactCache(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readArtifact(t *testing.T, c *ArtifactCache, key string) (string, bool) {
+	t.Helper()
+
+	err, archive := c.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive == nil {
+		return "", false
+	}
+	defer archive.Close()
+	content, err := io.ReadAll(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content), true
+}
+
+func TestArtifactCache(t *testing.T) {
+	c := newArtifactCache(t, &ArtifactOptions{MaxArtifactBytes: 10})
+
+	if _, ok := readArtifact(t, c, "a"); ok {
+		t.Error("missing artifact was found")
+	}
+	if err := c.Put("a", strings.NewReader("content")); err != nil {
+		t.Fatal(err)
+	}
+	if content, ok := readArtifact(t, c, "a"); !ok || content != "content" {
+		t.Errorf("artifact = %q, %v", content, ok)
+	}
+
+	err := c.Put("b", strings.NewReader("more than ten bytes"))
+	if !errors.Is(err, errArtifactTooLarge) {
+		t.Errorf("error = %v, want errArtifactTooLarge", err)
+	}
+	if _, ok := readArtifact(t, c, "b"); ok {
+		t.Error("too large artifact was stored")
+	}
+	temporaryFiles, _ := filepath.Glob(filepath.Join(c.options.Directory, "*.tmp"))
+	if len(temporaryFiles) != 0 {
+		t.Errorf("temporary files left behind: %v", temporaryFiles)
+	}
+}
+
+func TestArtifactEviction(t *testing.T) {
+	c := newArtifactCache(t, &ArtifactOptions{MaxBytes: 20})
+
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b"} {
+		if err := c.Put(key, strings.NewReader("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		used := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(c.path(key), used, used)
+	}
+
+	// Reading a marks it as recently used, so b is evicted
+	readArtifact(t, c, "a")
+	if err := c.Put("c", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := readArtifact(t, c, key); ok != want {
+			t.Errorf("artifact %s present = %v, want %v", key, ok, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"ExecutionEngine/proto/job"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"google.golang.org/protobuf/proto"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	// TTL is how long a response stays valid, zero keeps it until evicted
+	TTL time.Duration
+	// MaxEntries and MaxBytes bound the cache, zero means unbounded
+	MaxEntries int
+	MaxBytes   int64
+}
+
+type entry struct {
+	key      string
+	response *job.JobResponse
+	size     int64
+	storedAt time.Time
+}
+
+// ResultCache keeps the responses of finished jobs and evicts the least
+// recently used ones first.
+type ResultCache struct {
+	options *Options
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	size    int64
+	now     func() time.Time
+}
+
+func NewResultCache(options *Options) *ResultCache {
+	return &ResultCache{
+		options: options,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Key hashes everything that influences the execution of request in an
+// image. Fields that only describe who submitted the job are ignored.
+func Key(request *job.JobRequest, imageID string) (error, string) {
+	request = proto.Clone(request).(*job.JobRequest)
+	request.Tenant = ""
+	request.BypassCache = false
+
+	content, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return err, ""
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(imageID))
+	hash.Write([]byte{0})
+	hash.Write(content)
+	return nil, hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns a copy of the response stored under key, or nil.
+func (c *ResultCache) Get(key string) *job.JobResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := element.Value.(*entry)
+	if c.options.TTL > 0 && c.now().Sub(e.storedAt) > c.options.TTL {
+		c.remove(element)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return proto.Clone(e.response).(*job.JobResponse)
+}
+
+// Put stores a copy of response under key, replacing any previous one.
+func (c *ResultCache) Put(key string, response *job.JobResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	e := &entry{
+		key:      key,
+		response: proto.Clone(response).(*job.JobResponse),
+		size:     int64(proto.Size(response) + len(key)),
+		storedAt: c.now(),
+	}
+	if c.options.MaxBytes > 0 && e.size > c.options.MaxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(e)
+	c.size += e.size
+
+	for (c.options.MaxEntries > 0 && c.order.Len() > c.options.MaxEntries) ||
+		(c.options.MaxBytes > 0 && c.size > c.options.MaxBytes) {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *ResultCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
+
+// remove must be called with lock held.
+func (c *ResultCache) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
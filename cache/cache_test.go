@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"ExecutionEngine/proto/job"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRequest() *job.JobRequest {
+	return &job.JobRequest{
+		SourceCodeFileName:   "main.py",
+		SourceCode:           "print(input())",
+		RunScript:            "python3 main.py",
+		Stdin:                "hello",
+		EnvironmentVariables: []string{"A=1", "B=2"},
+		ResourceLimits: &job.ResourceLimits{
+			MaxExecutionTime: 500,
+		},
+	}
+}
+
+func mustKey(t *testing.T, request *job.JobRequest, imageID string) string {
+	t.Helper()
+
+	err, key := Key(request, imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKey(t *testing.T) {
+	base := mustKey(t, newRequest(), "sha256:1")
+
+	same := newRequest()
+	same.Tenant = "other"
+	same.BypassCache = true
+	if key := mustKey(t, same, "sha256:1"); key != base {
+		t.Error("tenant and bypass_cache must not change the key")
+	}
+
+	changes := map[string]func(request *job.JobRequest){
+		"stdin":       func(request *job.JobRequest) { request.Stdin = "world" },
+		"source":      func(request *job.JobRequest) { request.SourceCode = "print(1)" },
+		"environment": func(request *job.JobRequest) { request.EnvironmentVariables = []string{"B=2", "A=1"} },
+		"limits":      func(request *job.JobRequest) { request.ResourceLimits.MaxExecutionTime = 1000 },
+	}
+	for name, change := range changes {
+		request := newRequest()
+		change(request)
+		if key := mustKey(t, request, "sha256:1"); key == base {
+			t.Errorf("changing %s must change the key", name)
+		}
+	}
+
+	if key := mustKey(t, newRequest(), "sha256:2"); key == base {
+		t.Error("changing the image must change the key")
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	c := NewResultCache(&Options{})
+	c.Put("a", &job.JobResponse{Status: "Finished", RunStdout: "hello"})
+
+	response := c.Get("a")
+	if response == nil || response.RunStdout != "hello" {
+		t.Fatalf("got %v", response)
+	}
+	response.RunStdout = "changed"
+	if response := c.Get("a"); response.RunStdout != "hello" {
+		t.Error("modifying a returned response changed the cache")
+	}
+	if c.Get("b") != nil {
+		t.Error("unknown key returned a response")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	c := NewResultCache(&Options{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Put("a", &job.JobResponse{Status: "Finished"})
+	now = now.Add(59 * time.Second)
+	if c.Get("a") == nil {
+		t.Error("response expired before its TTL")
+	}
+	now = now.Add(2 * time.Second)
+	if c.Get("a") != nil {
+		t.Error("response did not expire after its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expired response was not removed, %d entries left", c.Len())
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := NewResultCache(&Options{MaxEntries: 2})
+	c.Put("a", &job.JobResponse{})
+	c.Put("b", &job.JobResponse{})
+	c.Get("a")
+	c.Put("c", &job.JobResponse{})
+
+	if c.Get("b") != nil {
+		t.Error("least recently used response was not evicted")
+	}
+	if c.Get("a") == nil || c.Get("c") == nil {
+		t.Error("recently used responses were evicted")
+	}
+
+	large := &job.JobResponse{RunStdout: strings.Repeat("x", 100)}
+	c = NewResultCache(&Options{MaxBytes: 250})
+	c.Put("a", large)
+	c.Put("b", large)
+	c.Put("c", large)
+	if c.Len() != 2 || c.Get("a") != nil {
+		t.Errorf("size bound was not enforced, %d entries", c.Len())
+	}
+
+	c.Put("d", &job.JobResponse{RunStdout: strings.Repeat("x", 300)})
+	if c.Get("d") != nil || c.Len() != 2 {
+		t.Error("response larger than the cache was stored")
+	}
+}
@@ -0,0 +1,136 @@
+package callback
+
+import (
+	"ExecutionEngine/proto/job"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader holds "sha256=" followed by the hex encoded HMAC-SHA256
+	// of the timestamp, a dot and the body
+	SignatureHeader = "X-Engine-Signature"
+	// TimestampHeader holds the unix time in seconds the callback was signed
+	// at, receivers should reject old timestamps to prevent replays
+	TimestampHeader = "X-Engine-Timestamp"
+	JobIDHeader     = "X-Engine-Job-Id"
+)
+
+type Options struct {
+	// Secret signs the callbacks, they are not signed when it is empty
+	Secret         []byte
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds every attempt
+	Timeout time.Duration
+	// Client defaults to a client that does not follow redirects, which
+	// could lead to hosts callbacks are not allowed to reach
+	Client *http.Client
+}
+
+// Notifier posts the responses of finished jobs to their callback URL.
+type Notifier struct {
+	options Options
+	now     func() time.Time
+}
+
+func NewNotifier(options *Options) *Notifier {
+	n := &Notifier{options: *options, now: time.Now}
+	if n.options.Client == nil {
+		n.options.Client = &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return n
+}
+
+// Deliver posts response as JSON to url until the receiver accepts it with a
+// 2xx status, it rejects it with a 4xx status other than 408 and 429, the
+// attempts are used up or ctx is done. It returns the error of the last
+// attempt and the number of attempts.
+func (n *Notifier) Deliver(ctx context.Context, url string, response *job.JobResponse) (error, int) {
+	body, err := protojson.Marshal(response)
+	if err != nil {
+		return err, 0
+	}
+
+	backoff := n.options.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err, retryable := n.post(ctx, url, response.JobId, body)
+		if err == nil || !retryable || attempt >= n.options.MaxAttempts {
+			return err, attempt
+		}
+
+		select {
+		case <-ctx.Done():
+			return err, attempt
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if n.options.MaxBackoff > 0 && backoff > n.options.MaxBackoff {
+			backoff = n.options.MaxBackoff
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, url, jobID string, body []byte) (error, bool) {
+	if n.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.options.Timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err, false
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(JobIDHeader, jobID)
+	if len(n.options.Secret) > 0 {
+		timestamp := strconv.FormatInt(n.now().Unix(), 10)
+		request.Header.Set(TimestampHeader, timestamp)
+		request.Header.Set(SignatureHeader, Sign(n.options.Secret, timestamp, body))
+	}
+
+	response, err := n.options.Client.Do(request)
+	if err != nil {
+		return err, true
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	switch code := response.StatusCode; {
+	case code >= 200 && code < 300:
+		return nil, false
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		return fmt.Errorf("callback receiver responded with %s", response.Status), true
+	default:
+		return fmt.Errorf("callback receiver responded with %s", response.Status), false
+	}
+}
+
+// Sign returns the value of the signature header for body sent at timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body sent at
+// timestamp, for receivers written in Go.
+func Verify(secret []byte, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
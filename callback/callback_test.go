@@ -0,0 +1,104 @@
+package callback
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestNotifier(secret string) *Notifier {
+	return NewNotifier(&Options{
+		Secret:         []byte(secret),
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		Timeout:        time.Second,
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	var received *job.JobResponse
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if !Verify([]byte("secret"), r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("signature %q does not match", r.Header.Get(SignatureHeader))
+		}
+		if r.Header.Get(JobIDHeader) != "job-1" {
+			t.Errorf("job ID header = %q, want job-1", r.Header.Get(JobIDHeader))
+		}
+		received = &job.JobResponse{}
+		if err := protojson.Unmarshal(body, received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	err, attempts := newTestNotifier("secret").Deliver(context.Background(), server.URL, &job.JobResponse{JobId: "job-1", RunStdout: "ok"})
+	if err != nil || attempts != 1 {
+		t.Fatalf("Deliver = %v after %d attempts", err, attempts)
+	}
+	if received.GetRunStdout() != "ok" {
+		t.Errorf("received %v, want the response", received)
+	}
+	if Verify([]byte("other"), "0", []byte("{}"), Sign([]byte("secret"), "0", []byte("{}"))) {
+		t.Error("signature verified with another secret")
+	}
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	var redirected atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Store(true)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	err, attempts := newTestNotifier("").Deliver(context.Background(), server.URL, &job.JobResponse{JobId: "job-1"})
+	if err == nil || attempts != 1 {
+		t.Errorf("Deliver = %v after %d attempts, want a failure without retries", err, attempts)
+	}
+	if redirected.Load() {
+		t.Error("the redirect was followed")
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		failed   bool
+	}{
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, false},
+		{"gives up", []int{http.StatusBadGateway}, 3, true},
+		{"rejected", []int{http.StatusNotFound}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := int(calls.Add(1)) - 1
+				w.WriteHeader(test.statuses[min(call, len(test.statuses)-1)])
+			}))
+			defer server.Close()
+
+			err, attempts := newTestNotifier("").Deliver(context.Background(), server.URL, &job.JobResponse{})
+			if attempts != test.attempts || int(calls.Load()) != test.attempts {
+				t.Errorf("attempts = %d, calls = %d, want %d", attempts, calls.Load(), test.attempts)
+			}
+			if (err != nil) != test.failed {
+				t.Errorf("error = %v, want failure %v", err, test.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package certificates
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of the authorities client certificates are
+	// verified against, clients need no certificate when it is empty
+	ClientCAFile string
+}
+
+// Reloader serves the certificate and client authorities read from files,
+// picking up new files while connections keep being accepted.
+type Reloader struct {
+	options *Options
+	config  atomic.Pointer[tls.Config]
+	// modified holds the modification times of the files of config
+	modified []time.Time
+}
+
+func NewReloader(options *Options) (error, *Reloader) {
+	r := &Reloader{options: options}
+	if err := r.Reload(); err != nil {
+		return err, nil
+	}
+	return nil, r
+}
+
+// TLSConfig returns the configuration to serve with, every handshake uses the
+// most recently loaded files.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load(), nil
+		},
+	}
+}
+
+// Reload reads the files again. The previous files stay in use when they
+// cannot be loaded, until the files change again.
+func (r *Reloader) Reload() error {
+	err, modified := r.modificationTimes()
+	if err != nil {
+		return err
+	}
+	r.modified = modified
+
+	certificate, err := tls.LoadX509KeyPair(r.options.CertFile, r.options.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	if r.options.ClientCAFile != "" {
+		bundle, err := os.ReadFile(r.options.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client authorities: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bundle) {
+			return errors.New("client authorities contain no certificate")
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.config.Store(config)
+	return nil
+}
+
+// Watch reloads the files every interval once one of them changed, until ctx
+// is done. onError is called with failed reloads.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) changed() bool {
+	err, modified := r.modificationTimes()
+	if err != nil {
+		// A file being replaced is reported once it is back
+		return false
+	}
+	for i := range modified {
+		if !modified[i].Equal(r.modified[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) modificationTimes() (error, []time.Time) {
+	var modified []time.Time
+	for _, path := range []string{r.options.CertFile, r.options.KeyFile, r.options.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err, nil
+		}
+		modified = append(modified, info.ModTime())
+	}
+	return nil, modified
+}
@@ -0,0 +1,233 @@
+package certificates
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test authority"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authority{certificate: certificate, key: key}
+}
+
+// issue returns a PEM certificate and key for name signed by a.
+func (a *authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (a *authority) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.certificate.Raw})
+}
+
+func writeFile(t *testing.T, path string, content []byte, modified time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects a client using clientConfig to a server using r and
+// returns the common name of the server certificate.
+func handshake(t *testing.T, r *Reloader, clientConfig *tls.Config) (string, error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			serverErrors <- err
+			return
+		}
+		defer connection.Close()
+		serverErrors <- tls.Server(connection, r.TLSConfig()).Handshake()
+	}()
+
+	client, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	serverError := <-serverErrors
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	if serverError != nil {
+		return "", serverError
+	}
+	return client.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestReload(t *testing.T) {
+	serverAuthority := newAuthority(t)
+	directory := t.TempDir()
+	options := &Options{
+		CertFile: filepath.Join(directory, "server.pem"),
+		KeyFile:  filepath.Join(directory, "server.key"),
+	}
+	certificate, key := serverAuthority.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, options.CertFile, certificate, time.Now().Add(-time.Minute))
+	writeFile(t, options.KeyFile, key, time.Now().Add(-time.Minute))
+
+	err, reloader := NewReloader(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverAuthority.certificate)
+	clientConfig := func(name string) *tls.Config {
+		return &tls.Config{RootCAs: roots, ServerName: name}
+	}
+	if name, err := handshake(t, reloader, clientConfig("first")); err != nil || name != "first" {
+		t.Fatalf("handshake = %q, %v, want first", name, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go reloader.Watch(ctx, 10*time.Millisecond, func(err error) { errs <- err })
+
+	certificate, key = serverAuthority.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, options.KeyFile, key, time.Now())
+	writeFile(t, options.CertFile, certificate, time.Now())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		name, err := handshake(t, reloader, clientConfig("second"))
+		if err == nil && name == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate was not reloaded, handshake = %q, %v", name, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	writeFile(t, options.CertFile, []byte("not a certificate"), time.Now().Add(time.Minute))
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broken certificate was not reported")
+	}
+	if name, err := handshake(t, reloader, clientConfig("second")); err != nil || name != "second" {
+		t.Errorf("handshake after a failed reload = %q, %v, want second", name, err)
+	}
+}
+
+func TestClientAuthentication(t *testing.T) {
+	serverAuthority, clientAuthority, otherAuthority := newAuthority(t), newAuthority(t), newAuthority(t)
+	directory := t.TempDir()
+	options := &Options{
+		CertFile:     filepath.Join(directory, "server.pem"),
+		KeyFile:      filepath.Join(directory, "server.key"),
+		ClientCAFile: filepath.Join(directory, "clients.pem"),
+	}
+	certificate, key := serverAuthority.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, options.CertFile, certificate, time.Now())
+	writeFile(t, options.KeyFile, key, time.Now())
+	writeFile(t, options.ClientCAFile, clientAuthority.pem(), time.Now())
+
+	err, reloader := NewReloader(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverAuthority.certificate)
+	clientCertificate := func(a *authority) []tls.Certificate {
+		certificate, key := a.issue(t, "client", x509.ExtKeyUsageClientAuth)
+		pair, err := tls.X509KeyPair(certificate, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []tls.Certificate{pair}
+	}
+
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		accepted     bool
+	}{
+		{"trusted certificate", clientCertificate(clientAuthority), true},
+		{"untrusted certificate", clientCertificate(otherAuthority), false},
+		{"no certificate", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := handshake(t, reloader, &tls.Config{
+				RootCAs:      roots,
+				ServerName:   "server",
+				Certificates: test.certificates,
+			})
+			if (err == nil) != test.accepted {
+				t.Errorf("handshake error = %v, want accepted %t", err, test.accepted)
+			}
+		})
+	}
+}
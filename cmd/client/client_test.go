@@ -0,0 +1,161 @@
+package main
+
+import (
+	"ExecutionEngine/proto/job"
+	"bytes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildRequest(t *testing.T) {
+	cSource := writeFile(t, "solution.c", "int main() {}")
+	javaSource := writeFile(t, "Solution.java", "class Solution {}")
+	runScript := writeFile(t, "run.sh", "./main < input")
+	requestFile := writeFile(t, "request.json", `{"sourceCodeFileName": "a.py", "sourceCode": "print(1)", "runScript": "python3 a.py", "tenant": "course-1"}`)
+
+	tests := []struct {
+		name     string
+		options  submitOptions
+		source   string
+		fileName string
+		compile  string
+		run      string
+		fails    bool
+		check    func(t *testing.T, request *job.JobRequest)
+	}{
+		{name: "preset from extension", source: cSource, fileName: "main.c", compile: "gcc -O2 -std=c17 -o main main.c -lm", run: "./main"},
+		{name: "java keeps the class name", source: javaSource, fileName: "Solution.java", compile: "javac Solution.java", run: "java Solution"},
+		{name: "run script replaces the preset", options: submitOptions{runFile: runScript}, source: cSource, fileName: "main.c", compile: "gcc -O2 -std=c17 -o main main.c -lm", run: "./main < input"},
+		{name: "explicit preset", options: submitOptions{preset: "python", fileName: "solve.py"}, source: cSource, fileName: "solve.py", run: "python3 solve.py"},
+		{name: "request file", options: submitOptions{requestFile: requestFile, tenant: "course-2", timeLimit: time.Second, noCache: true}, fileName: "a.py", run: "python3 a.py",
+			check: func(t *testing.T, request *job.JobRequest) {
+				if request.Tenant != "course-2" || request.ResourceLimits.GetMaxExecutionTime() != 1000 || !request.BypassCache {
+					t.Errorf("flags did not override the request file: %v", request)
+				}
+			}},
+		{name: "stdin", options: submitOptions{preset: "python", stdinFile: "-"}, fileName: "main.py", run: "python3 main.py",
+			check: func(t *testing.T, request *job.JobRequest) {
+				if request.Stdin != "input" {
+					t.Errorf("stdin = %q, want input", request.Stdin)
+				}
+			}},
+		{name: "binary stdin", options: submitOptions{preset: "python", stdinFile: writeFile(t, "input.bin", "\x00\xff")}, fileName: "main.py", run: "python3 main.py",
+			check: func(t *testing.T, request *job.JobRequest) {
+				if request.Stdin != "" || string(request.StdinBytes) != "\x00\xff" {
+					t.Errorf("stdin = %q, bytes %q, want the bytes only", request.Stdin, request.StdinBytes)
+				}
+			}},
+		{name: "unknown preset", options: submitOptions{preset: "cobol"}, fails: true},
+		{name: "unknown extension", source: writeFile(t, "main.rs", ""), fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, request := buildRequest(&test.options, test.source, strings.NewReader("input"))
+			if test.fails {
+				if err == nil {
+					t.Errorf("request = %v, want an error", request)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request.SourceCodeFileName != test.fileName || request.CompileScript != test.compile || request.RunScript != test.run {
+				t.Errorf("file %q, compile %q, run %q, want %q, %q, %q", request.SourceCodeFileName, request.CompileScript, request.RunScript, test.fileName, test.compile, test.run)
+			}
+			if test.check != nil {
+				test.check(t, request)
+			}
+		})
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := `event: output
+data: {"phase":"run","stream":"stdout","data":"hello "}
+
+event: output
+data: {"phase":"run","stream":"stderr","data":"warning"}
+
+event: output
+data: {"phase":"run","stream":"stderr","data_base64":"/w=="}
+
+event: output
+data: {"phase":"run","stream":"stdout","data":"world"}
+
+event: response
+data: {"status":"Finished","runStdout":"hello world"}
+
+`
+	var stdout, stderr bytes.Buffer
+	err, response := readEvents(strings.NewReader(stream), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello world" || stderr.String() != "warning\xff" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+	if response.Status != "Finished" {
+		t.Errorf("response = %v", response)
+	}
+
+	err, _ = readEvents(strings.NewReader("event: error\ndata: {\"code\": 8, \"message\": \"quota exceeded\"}\n\n"), &stdout, &stderr)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("error = %v, want ResourceExhausted", err)
+	}
+	if err, _ := readEvents(strings.NewReader("event: output\n"), &stdout, &stderr); err == nil {
+		t.Error("truncated stream was accepted")
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	tests := []struct {
+		response *job.JobResponse
+		text     string
+		color    string
+	}{
+		{&job.JobResponse{Status: "Finished"}, "Finished (exit code 0)", colorGreen},
+		{&job.JobResponse{Status: "Finished", RunExitCode: 1}, "Finished (exit code 1)", colorYellow},
+		{&job.JobResponse{Status: "Time Limit Exceeded"}, "Time Limit Exceeded", colorRed},
+		{&job.JobResponse{Status: "Internal Error"}, "Internal Error", colorMagenta},
+	}
+	for _, test := range tests {
+		if text := verdict(test.response, false); text != test.text {
+			t.Errorf("verdict = %q, want %q", text, test.text)
+		}
+		if text := verdict(test.response, true); text != test.color+test.text+colorReset {
+			t.Errorf("colored verdict = %q", text)
+		}
+	}
+}
+
+func TestSaveOutputFiles(t *testing.T) {
+	directory := t.TempDir()
+	err := saveOutputFiles(directory, []*job.OutputFile{{Name: "plots/loss.png", Content: []byte("png")}, {Name: "results.csv", Content: []byte("a,b")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"plots/loss.png": "png", "results.csv": "a,b"} {
+		if content, err := os.ReadFile(filepath.Join(directory, name)); err != nil || string(content) != want {
+			t.Errorf("%s = %q, %v, want %q", name, content, err, want)
+		}
+	}
+
+	if err := saveOutputFiles(directory, []*job.OutputFile{{Name: "../escaped"}}); err == nil {
+		t.Error("saved a file outside of the directory")
+	}
+}
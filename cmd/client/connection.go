@@ -0,0 +1,110 @@
+package main
+
+import (
+	"ExecutionEngine/auth"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"os"
+)
+
+// connection holds the flags describing how to reach the engine.
+type connection struct {
+	address  string
+	gateway  string
+	apiKey   string
+	token    string
+	useTLS   bool
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func (c *connection) register(flags *flag.FlagSet) {
+	flags.StringVar(&c.address, "address", "localhost:8000", "address of the gRPC server")
+	flags.StringVar(&c.gateway, "gateway", "", "URL of the HTTP gateway, used instead of gRPC when set")
+	flags.StringVar(&c.apiKey, "api-key", os.Getenv("EXECUTION_ENGINE_API_KEY"), "API key of the client, defaults to $EXECUTION_ENGINE_API_KEY")
+	flags.StringVar(&c.token, "token", os.Getenv("EXECUTION_ENGINE_TOKEN"), "JWT of the client, defaults to $EXECUTION_ENGINE_TOKEN")
+	flags.BoolVar(&c.useTLS, "tls", false, "connect to the gRPC server with TLS")
+	flags.StringVar(&c.caFile, "ca-file", "", "PEM file of the authorities of the server certificate, the system ones when empty")
+	flags.StringVar(&c.certFile, "cert-file", "", "PEM file of the client certificate")
+	flags.StringVar(&c.keyFile, "key-file", "", "PEM file of the key of the client certificate")
+}
+
+func (c *connection) tlsConfig() (error, *tls.Config) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return err, nil
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s contains no certificate", c.caFile), nil
+		}
+	}
+	if c.certFile != "" || c.keyFile != "" {
+		if c.certFile == "" || c.keyFile == "" {
+			return errors.New("-cert-file and -key-file must be given together"), nil
+		}
+		certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return err, nil
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return nil, config
+}
+
+func (c *connection) dial() (error, *grpc.ClientConn) {
+	transportCredentials := insecure.NewCredentials()
+	if c.useTLS {
+		err, config := c.tlsConfig()
+		if err != nil {
+			return err, nil
+		}
+		transportCredentials = credentials.NewTLS(config)
+	}
+	connection, err := grpc.NewClient(c.address,
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(64<<20), grpc.MaxCallSendMsgSize(64<<20)),
+	)
+	return err, connection
+}
+
+func (c *connection) httpClient() (error, *http.Client) {
+	err, config := c.tlsConfig()
+	if err != nil {
+		return err, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return nil, &http.Client{Transport: transport}
+}
+
+// credentials returns the authentication headers of the calls.
+func (c *connection) credentials() map[string]string {
+	headers := map[string]string{}
+	if c.apiKey != "" {
+		headers[auth.APIKeyHeader] = c.apiKey
+	}
+	if c.token != "" {
+		headers["authorization"] = "Bearer " + c.token
+	}
+	return headers
+}
+
+func (c *connection) outgoingContext(ctx context.Context) context.Context {
+	for name, value := range c.credentials() {
+		ctx = metadata.AppendToOutgoingContext(ctx, name, value)
+	}
+	return ctx
+}
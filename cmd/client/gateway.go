@@ -0,0 +1,122 @@
+package main
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/proto/job"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// submitHTTP submits request through the gateway. With stream the output of
+// the job is copied to stdout and stderr while it runs.
+func submitHTTP(ctx context.Context, c *connection, request *job.JobRequest, stream bool, stdout, stderr io.Writer) (error, *job.JobResponse) {
+	err, client := c.httpClient()
+	if err != nil {
+		return err, nil
+	}
+	body, err := protojson.Marshal(request)
+	if err != nil {
+		return err, nil
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.gateway, "/")+"/jobs", bytes.NewReader(body))
+	if err != nil {
+		return err, nil
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if stream {
+		httpRequest.Header.Set("Accept", "text/event-stream")
+	}
+	for name, value := range c.credentials() {
+		httpRequest.Header.Set(name, value)
+	}
+
+	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		return err, nil
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(httpResponse.Body)
+		return statusError(data, httpResponse.Status), nil
+	}
+
+	if !strings.HasPrefix(httpResponse.Header.Get("Content-Type"), "text/event-stream") {
+		data, err := io.ReadAll(httpResponse.Body)
+		if err != nil {
+			return err, nil
+		}
+		response := &job.JobResponse{}
+		return protojson.Unmarshal(data, response), response
+	}
+	return readEvents(httpResponse.Body, stdout, stderr)
+}
+
+// readEvents copies the output events to stdout and stderr until the
+// response or error event.
+func readEvents(r io.Reader, stdout, stderr io.Writer) (error, *job.JobResponse) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		case line != "":
+			continue
+		}
+
+		payload := []byte(strings.Join(data, "\n"))
+		data = nil
+		switch event {
+		case "output":
+			var output struct {
+				Stream     string `json:"stream"`
+				Data       string `json:"data"`
+				DataBase64 []byte `json:"data_base64"`
+			}
+			if err := json.Unmarshal(payload, &output); err != nil {
+				return err, nil
+			}
+			w := stdout
+			if output.Stream == container.StreamStderr {
+				w = stderr
+			}
+			io.WriteString(w, output.Data)
+			w.Write(output.DataBase64)
+		case "response":
+			response := &job.JobResponse{}
+			return protojson.Unmarshal(payload, response), response
+		case "error":
+			return statusError(payload, "job failed"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+	return errors.New("the gateway closed the stream before the response"), nil
+}
+
+// statusError converts a google.rpc.Status in JSON into an error.
+func statusError(data []byte, fallback string) error {
+	st := &statuspb.Status{}
+	if err := protojson.Unmarshal(data, st); err != nil || st.Code == 0 {
+		return fmt.Errorf("%s: %s", fallback, bytes.TrimSpace(data))
+	}
+	return status.ErrorProto(st)
+}
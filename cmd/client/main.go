@@ -0,0 +1,49 @@
+// Command client submits jobs to an execution engine and replays files of
+// job requests against it.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes of the commands.
+const (
+	exitOK = 0
+	// exitVerdict means the job ran but did not finish successfully, or some
+	// replayed jobs failed
+	exitVerdict = 1
+	exitUsage   = 2
+	// exitError means the engine could not be reached or rejected the job
+	exitError = 3
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s <command> [flags] [arguments]
+
+Commands:
+  submit  submit a job from files or a language preset and print its response
+  replay  submit the job requests of a JSONL file concurrently and report
+          throughput and latencies
+
+Run "%[1]s <command> -h" for the flags of a command.
+`, os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	switch os.Args[1] {
+	case "submit":
+		os.Exit(submit(os.Args[2:]))
+	case "replay":
+		os.Exit(replay(os.Args[2:]))
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		usage()
+		os.Exit(exitUsage)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// preset holds the scripts of a language available in the default image.
+// "{file}" in the scripts stands for the source file name and "{name}" for
+// it without extension.
+type preset struct {
+	fileName      string
+	extensions    []string
+	compileScript string
+	runScript     string
+}
+
+var presets = map[string]preset{
+	"c": {
+		fileName:      "main.c",
+		extensions:    []string{".c"},
+		compileScript: "gcc -O2 -std=c17 -o main {file} -lm",
+		runScript:     "./main",
+	},
+	"cpp": {
+		fileName:      "main.cpp",
+		extensions:    []string{".cpp", ".cc", ".cxx"},
+		compileScript: "g++ -O2 -std=c++17 -o main {file}",
+		runScript:     "./main",
+	},
+	"java": {
+		fileName:      "Main.java",
+		extensions:    []string{".java"},
+		compileScript: "javac {file}",
+		runScript:     "java {name}",
+	},
+	"python": {
+		fileName:   "main.py",
+		extensions: []string{".py"},
+		runScript:  "python3 {file}",
+	},
+}
+
+// presetNames returns the names of the presets, sorted.
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// presetFor returns the preset whose extensions include the one of fileName.
+func presetFor(fileName string) (string, bool) {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	for name, preset := range presets {
+		if slices.Contains(preset.extensions, extension) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// script fills in the source file name.
+func (p *preset) script(script, fileName string) string {
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	return strings.NewReplacer("{file}", fileName, "{name}", name).Replace(script)
+}
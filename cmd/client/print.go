@@ -0,0 +1,139 @@
+package main
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/proto/job"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+)
+
+// useColor reports whether f is a terminal and NO_COLOR is not set.
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// successful reports whether the job ran to the end and its run script
+// exited with 0.
+func successful(response *job.JobResponse) bool {
+	return response.Status == container.StatusFinished && response.RunExitCode == 0
+}
+
+// verdict describes the outcome of a job, colored when color is set.
+func verdict(response *job.JobResponse, color bool) string {
+	text := response.Status
+	if response.Status == container.StatusFinished {
+		text = fmt.Sprintf("%s (exit code %d)", text, response.RunExitCode)
+	}
+	if !color {
+		return text
+	}
+
+	code := colorMagenta
+	switch {
+	case successful(response):
+		code = colorGreen
+	case response.Status == container.StatusFinished, response.Status == container.StatusCompileError:
+		code = colorYellow
+	case response.Status == container.StatusTimeLimitExceeded, response.Status == container.StatusMemoryLimitExceeded:
+		code = colorRed
+	}
+	return code + text + colorReset
+}
+
+// printResponse writes the verdict, timings and output of a job. The output
+// is left out when it was already streamed.
+func printResponse(w io.Writer, response *job.JobResponse, color, withOutput bool) {
+	fmt.Fprintf(w, "Verdict: %s\n", verdict(response, color))
+	if response.ErrorString != "" {
+		fmt.Fprintf(w, "Error:   %s\n", response.ErrorString)
+	}
+
+	details := []string{"job " + response.JobId}
+	if response.Cached {
+		details = append(details, "cached")
+	}
+	if response.CompileCached {
+		details = append(details, "compile cached")
+	}
+	if response.Attempts > 1 {
+		details = append(details, fmt.Sprintf("%d attempts", response.Attempts))
+	}
+	if len(response.TruncatedOutputs) > 0 {
+		details = append(details, "truncated "+strings.Join(response.TruncatedOutputs, " "))
+	}
+	if statistics := response.ResourceStatistics; statistics != nil {
+		details = append(details, (time.Duration(statistics.ExecutionTime) * time.Millisecond).String())
+		if statistics.CpuTime >= 0 {
+			details = append(details, (time.Duration(statistics.CpuTime)*time.Millisecond).String()+" CPU")
+		}
+		// Runtimes that cannot measure memory report a negative value
+		if statistics.MaxMemoryUsed >= 0 {
+			details = append(details, fmt.Sprintf("%.1f MiB", float64(statistics.MaxMemoryUsed)/(1<<20)))
+		}
+	}
+	fmt.Fprintf(w, "Job:     %s\n", strings.Join(details, ", "))
+
+	var phases []string
+	for _, phase := range response.Phases {
+		phases = append(phases, fmt.Sprintf("%s %s", phase.Name, time.Duration(phase.Duration)*time.Millisecond))
+	}
+	if len(phases) > 0 {
+		fmt.Fprintf(w, "Phases:  %s\n", strings.Join(phases, ", "))
+	}
+
+	var files []string
+	for _, file := range response.OutputFiles {
+		description := fmt.Sprintf("%s (%d bytes)", file.Name, file.Size)
+		if file.Truncated {
+			description = fmt.Sprintf("%s (%d of %d bytes)", file.Name, len(file.Content), file.Size)
+		}
+		files = append(files, description)
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(w, "Files:   %s\n", strings.Join(files, ", "))
+	}
+
+	if !withOutput {
+		return
+	}
+	for _, section := range []struct {
+		name   string
+		output string
+		raw    []byte
+	}{
+		{"setup stdout", response.SetupStdout, response.SetupStdoutBytes},
+		{"setup stderr", response.SetupStderr, response.SetupStderrBytes},
+		{"compile stdout", response.CompileStdout, response.CompileStdoutBytes},
+		{"compile stderr", response.CompileStderr, response.CompileStderrBytes},
+		{"run stdout", response.RunStdout, response.RunStdoutBytes},
+		{"run stderr", response.RunStderr, response.RunStderrBytes},
+	} {
+		// Output that is not UTF-8 is printed as is, like the program did
+		output := section.output
+		if section.raw != nil {
+			output = string(section.raw)
+		}
+		if output == "" {
+			continue
+		}
+		fmt.Fprintf(w, "--- %s ---\n%s", section.name, output)
+		if !strings.HasSuffix(output, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+}
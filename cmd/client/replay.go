@@ -0,0 +1,126 @@
+package main
+
+import (
+	"ExecutionEngine/loadgen"
+	"ExecutionEngine/proto/job"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+)
+
+func replay(arguments []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var c connection
+	c.register(flags)
+	concurrency := flags.Int("concurrency", 4, "number of jobs submitted at once")
+	verbose := flags.Bool("v", false, "print the verdict of every job")
+	noCache := flags.Bool("no-cache", false, "run every job even if the engine has a cached response")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [flags] <requests.jsonl>\n\nThe file holds one JobRequest in protobuf JSON per line, - reads the standard input.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 || *concurrency < 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var input io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitUsage
+		}
+		defer file.Close()
+		input = file
+	}
+	err, requests := loadgen.ReadRequests(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	for _, request := range requests {
+		request.BypassCache = request.BypassCache || *noCache
+	}
+
+	err, submit := c.submitFunc()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	color := useColor(os.Stdout)
+	var printLock sync.Mutex
+	stats := loadgen.Run(ctx, submit, requests, &loadgen.Options{
+		Concurrency: *concurrency,
+		OnResult: func(result *loadgen.Result) {
+			if !*verbose && result.Err == nil {
+				return
+			}
+			printLock.Lock()
+			defer printLock.Unlock()
+			if result.Err != nil {
+				fmt.Printf("request %d: error: %v\n", result.Index+1, result.Err)
+				return
+			}
+			fmt.Printf("request %d: %s in %s, job %s\n", result.Index+1, verdict(result.Response, color), result.Latency.Round(time.Millisecond), result.Response.JobId)
+		},
+	})
+
+	printStats(os.Stdout, stats)
+	if stats.Failures > 0 || stats.Jobs < len(requests) {
+		return exitVerdict
+	}
+	return exitOK
+}
+
+// submitFunc submits through the gateway when one is set and over gRPC
+// otherwise.
+func (c *connection) submitFunc() (error, loadgen.SubmitFunc) {
+	if c.gateway != "" {
+		return nil, func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+			err, response := submitHTTP(ctx, c, request, false, io.Discard, io.Discard)
+			return response, err
+		}
+	}
+	err, connection := c.dial()
+	if err != nil {
+		return err, nil
+	}
+	client := job.NewJobClient(connection)
+	return nil, func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+		return client.Submit(c.outgoingContext(ctx), request)
+	}
+}
+
+func printStats(w io.Writer, stats *loadgen.Stats) {
+	fmt.Fprintf(w, "Jobs:       %d in %s, %.2f successful jobs/s\n", stats.Jobs, stats.Duration.Round(time.Millisecond), stats.Throughput())
+	fmt.Fprintf(w, "Failures:   %d\n", stats.Failures)
+	var verdicts []string
+	for verdict := range stats.Verdicts {
+		verdicts = append(verdicts, verdict)
+	}
+	slices.Sort(verdicts)
+	for _, verdict := range verdicts {
+		fmt.Fprintf(w, "  %-22s %d\n", verdict+":", stats.Verdicts[verdict])
+	}
+	if len(stats.Latencies) > 0 {
+		fmt.Fprintf(w, "Latency:    p50 %s, p90 %s, p99 %s, max %s\n",
+			stats.Percentile(50).Round(time.Millisecond),
+			stats.Percentile(90).Round(time.Millisecond),
+			stats.Percentile(99).Round(time.Millisecond),
+			stats.Percentile(100).Round(time.Millisecond),
+		)
+	}
+}
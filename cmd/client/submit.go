@@ -0,0 +1,284 @@
+package main
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// stringList collects repeated flags.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// submitOptions are the flags of submit describing the job.
+type submitOptions struct {
+	requestFile   string
+	preset        string
+	fileName      string
+	setupFile     string
+	compileFile   string
+	runFile       string
+	stdinFile     string
+	image         string
+	tenant        string
+	environment   stringList
+	timeLimit     time.Duration
+	memoryLimit   int64
+	noCache       bool
+	networkAccess bool
+	callbackURL   string
+	outputFiles   stringList
+}
+
+func submit(arguments []string) int {
+	flags := flag.NewFlagSet("submit", flag.ContinueOnError)
+	var c connection
+	c.register(flags)
+	var options submitOptions
+	flags.StringVar(&options.requestFile, "request", "", "JSON file of a JobRequest to submit, e.g. the request of a job record; the other flags override its fields")
+	flags.StringVar(&options.preset, "preset", "", fmt.Sprintf("language preset providing the file name and scripts: %s; guessed from the extension of the source file when empty", strings.Join(presetNames(), ", ")))
+	flags.StringVar(&options.fileName, "file-name", "", "name of the source file in the sandbox, defaults to the one of the preset or of the source file")
+	flags.StringVar(&options.setupFile, "setup", "", "file holding the setup script")
+	flags.StringVar(&options.compileFile, "compile", "", "file holding the compile script, replaces the one of the preset")
+	flags.StringVar(&options.runFile, "run", "", "file holding the run script, replaces the one of the preset")
+	flags.StringVar(&options.stdinFile, "stdin", "", "file passed to the run script on stdin, - for the standard input")
+	flags.StringVar(&options.image, "image", "", "name of the image, the default one of the engine when empty")
+	flags.StringVar(&options.tenant, "tenant", "", "tenant of the job")
+	flags.Var(&options.environment, "env", "environment variable of the scripts as NAME=value (repeatable)")
+	flags.DurationVar(&options.timeLimit, "time-limit", 0, "execution time limit, the default of the engine when 0")
+	flags.Int64Var(&options.memoryLimit, "memory-limit", 0, "memory limit in MiB, the default of the engine when 0")
+	flags.BoolVar(&options.noCache, "no-cache", false, "run the job even if the engine has a cached response")
+	flags.BoolVar(&options.networkAccess, "network", false, "give the job network access, the client must be allowed to")
+	flags.StringVar(&options.callbackURL, "callback-url", "", "URL the engine posts the response to when the job finishes")
+	flags.Var(&options.outputFiles, "output-file", "pattern of files to collect after the run script, e.g. *.csv (repeatable)")
+	outputDirectory := flags.String("output-dir", "", "directory the collected files are saved to, they are only listed when empty")
+	stream := flags.Bool("stream", false, "print the output while the job runs, needs -gateway")
+	jsonOutput := flags.Bool("json", false, "print the response as JSON")
+	timeout := flags.Duration("timeout", 0, "give up after this long, 0 waits for the job")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s submit [flags] [source file]\n\nExit codes: 0 the run script exited with 0, 1 another verdict, 2 usage error, 3 the job was not run.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 1 || (*stream && c.gateway == "") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	err, request := buildRequest(&options, flags.Arg(0), os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var response *job.JobResponse
+	if c.gateway != "" {
+		err, response = submitHTTP(ctx, &c, request, *stream, os.Stdout, os.Stderr)
+	} else {
+		err, response = submitGRPC(ctx, &c, request)
+	}
+	if err != nil {
+		if st, ok := status.FromError(err); ok {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", st.Code(), st.Message())
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		return exitError
+	}
+
+	if *jsonOutput {
+		data, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(response)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+		fmt.Println(string(data))
+	} else {
+		printResponse(os.Stdout, response, useColor(os.Stdout), !*stream)
+	}
+	if *outputDirectory != "" {
+		if err := saveOutputFiles(*outputDirectory, response.OutputFiles); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+	}
+	if !successful(response) {
+		return exitVerdict
+	}
+	return exitOK
+}
+
+// saveOutputFiles writes files below directory, creating the directories of
+// their names.
+func saveOutputFiles(directory string, files []*job.OutputFile) error {
+	for _, file := range files {
+		if !filepath.IsLocal(file.Name) {
+			return fmt.Errorf("refusing to save output file %q outside of %s", file.Name, directory)
+		}
+		name := filepath.Join(directory, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, file.Content, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func submitGRPC(ctx context.Context, c *connection, request *job.JobRequest) (error, *job.JobResponse) {
+	err, connection := c.dial()
+	if err != nil {
+		return err, nil
+	}
+	defer connection.Close()
+	response, err := job.NewJobClient(connection).Submit(c.outgoingContext(ctx), request)
+	return err, response
+}
+
+// buildRequest assembles the request from the request file, the preset and
+// the files named by options. stdin is read when the stdin file is "-".
+func buildRequest(options *submitOptions, sourceFile string, stdin io.Reader) (error, *job.JobRequest) {
+	request := &job.JobRequest{}
+	if options.requestFile != "" {
+		data, err := os.ReadFile(options.requestFile)
+		if err != nil {
+			return err, nil
+		}
+		if err := protojson.Unmarshal(data, request); err != nil {
+			return fmt.Errorf("%s: %w", options.requestFile, err), nil
+		}
+	}
+
+	presetName := options.preset
+	if presetName == "" && sourceFile != "" && options.requestFile == "" {
+		presetName, _ = presetFor(sourceFile)
+	}
+	var selected *preset
+	if presetName != "" {
+		p, ok := presets[presetName]
+		if !ok {
+			return fmt.Errorf("unknown preset %q, available are %s", presetName, strings.Join(presetNames(), ", ")), nil
+		}
+		selected = &p
+	}
+
+	if sourceFile != "" {
+		source, err := os.ReadFile(sourceFile)
+		if err != nil {
+			return err, nil
+		}
+		request.SourceCode = string(source)
+		request.SourceCodeFileName = filepath.Base(sourceFile)
+		// Java needs the file to be named after its public class
+		if selected != nil && presetName != "java" {
+			request.SourceCodeFileName = selected.fileName
+		}
+	} else if selected != nil && request.SourceCodeFileName == "" {
+		request.SourceCodeFileName = selected.fileName
+	}
+	if options.fileName != "" {
+		request.SourceCodeFileName = options.fileName
+	}
+	if selected != nil {
+		request.CompileScript = selected.script(selected.compileScript, request.SourceCodeFileName)
+		request.RunScript = selected.script(selected.runScript, request.SourceCodeFileName)
+	}
+
+	for _, script := range []struct {
+		file   string
+		target *string
+	}{
+		{options.setupFile, &request.SetupScript},
+		{options.compileFile, &request.CompileScript},
+		{options.runFile, &request.RunScript},
+	} {
+		if script.file == "" {
+			continue
+		}
+		content, err := os.ReadFile(script.file)
+		if err != nil {
+			return err, nil
+		}
+		*script.target = string(content)
+	}
+
+	if options.stdinFile != "" {
+		var content []byte
+		var err error
+		if options.stdinFile == "-" {
+			content, err = io.ReadAll(stdin)
+		} else {
+			content, err = os.ReadFile(options.stdinFile)
+		}
+		if err != nil {
+			return err, nil
+		}
+		// Protobuf strings must be valid UTF-8
+		request.Stdin, request.StdinBytes = "", nil
+		if utf8.Valid(content) {
+			request.Stdin = string(content)
+		} else {
+			request.StdinBytes = content
+		}
+	}
+
+	if options.image != "" {
+		request.Image = options.image
+	}
+	if options.tenant != "" {
+		request.Tenant = options.tenant
+	}
+	if options.callbackURL != "" {
+		request.CallbackUrl = options.callbackURL
+	}
+	request.EnvironmentVariables = append(request.EnvironmentVariables, options.environment...)
+	request.OutputFiles = append(request.OutputFiles, options.outputFiles...)
+	request.BypassCache = request.BypassCache || options.noCache
+	request.NetworkAccess = request.NetworkAccess || options.networkAccess
+	if options.timeLimit > 0 || options.memoryLimit > 0 {
+		if request.ResourceLimits == nil {
+			request.ResourceLimits = &job.ResourceLimits{}
+		}
+		if options.timeLimit > 0 {
+			request.ResourceLimits.MaxExecutionTime = options.timeLimit.Milliseconds()
+		}
+		if options.memoryLimit > 0 {
+			request.ResourceLimits.MaxMemory = options.memoryLimit << 20
+		}
+	}
+
+	if request.SourceCodeFileName == "" || request.RunScript == "" {
+		return errors.New("a source file with a known extension, -preset, -run or -request is needed to know how to run the job"), nil
+	}
+	return nil, request
+}
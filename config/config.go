@@ -0,0 +1,670 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Images   []ImageConfig  `yaml:"images"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	Security SecurityConfig `yaml:"security"`
+	Runtime  RuntimeConfig  `yaml:"runtime"`
+	Pool     PoolConfig     `yaml:"pool"`
+	Retry    RetryConfig    `yaml:"retry"`
+	Store    StoreConfig    `yaml:"store"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Blobs    BlobsConfig    `yaml:"blobs"`
+	Gateway  GatewayConfig  `yaml:"gateway"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Log      LogConfig      `yaml:"log"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Quotas   QuotasConfig   `yaml:"quotas"`
+	Callback CallbackConfig `yaml:"callback"`
+	Health   HealthConfig   `yaml:"health"`
+}
+
+type ServerConfig struct {
+	ListenAddress string    `yaml:"listen_address"`
+	TLS           TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig enables TLS on the gRPC listener when CertFile and KeyFile are
+// set. With a ClientCAFile clients must present a certificate signed by one of
+// its authorities. The files are reloaded when they change.
+type TLSConfig struct {
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	ClientCAFile   string        `yaml:"client_ca_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// ImageConfig is an image jobs can ask for by name, the first one is used
+// when a job names none.
+type ImageConfig struct {
+	Name string `yaml:"name"`
+	Tag  string `yaml:"tag"`
+	// BuildContext is a directory with a Dockerfile the image is built from
+	// at startup, empty expects the image to exist already
+	BuildContext string `yaml:"build_context"`
+}
+
+// LimitsConfig holds the limits of jobs not asking for any and the most
+// any job may ask for.
+type LimitsConfig struct {
+	Default ResourceLimits `yaml:"default"`
+	Maximum ResourceLimits `yaml:"maximum"`
+	// MaxSourceSize bounds the source code and each script, MaxStdinSize the
+	// standard input of a request.
+	MaxSourceSize int64 `yaml:"max_source_size"`
+	MaxStdinSize  int64 `yaml:"max_stdin_size"`
+	// MaxCompileTime bounds the setup script and the compile script of every
+	// job, each
+	MaxCompileTime time.Duration `yaml:"max_compile_time"`
+}
+
+type ResourceLimits struct {
+	MaxExecutionTime time.Duration `yaml:"max_execution_time"`
+	MaxMemory        int64         `yaml:"max_memory"`
+	MaxOutputSize    int64         `yaml:"max_output_size"`
+	// MaxOutputFilesSize bounds the content of the output files returned
+	// with a response
+	MaxOutputFilesSize int64 `yaml:"max_output_files_size"`
+}
+
+// SecurityConfig hardens the sandboxes of the Docker backend, the native
+// backend is configured through runtime.native.
+type SecurityConfig struct {
+	// NetworkDisabled isolates the sandboxes of jobs not granted network
+	// access
+	NetworkDisabled bool `yaml:"network_disabled"`
+	// PidsLimit bounds the processes of a sandbox, zero means unlimited
+	PidsLimit       int64    `yaml:"pids_limit"`
+	CapDrop         []string `yaml:"cap_drop"`
+	NoNewPrivileges bool     `yaml:"no_new_privileges"`
+	// User runs jobs as another user of the image, empty keeps the user of
+	// the image
+	User string `yaml:"user"`
+	// SeccompProfile is a path to a seccomp profile, empty uses the default
+	// profile of Docker
+	SeccompProfile string `yaml:"seccomp_profile"`
+}
+
+const RuntimeDocker = "docker"
+const RuntimeNative = "native"
+
+type RuntimeConfig struct {
+	// Backend is either "docker" or "native"
+	Backend  string         `yaml:"backend"`
+	Native   NativeConfig   `yaml:"native"`
+	WarmPool WarmPoolConfig `yaml:"warm_pool"`
+}
+
+// WarmPoolConfig keeps started sandboxes ready to cut job startup latency.
+type WarmPoolConfig struct {
+	// Size is the number of ready sandboxes of each image, zero disables the
+	// warm pool
+	Size int `yaml:"size"`
+	// MemoryLimit of the ready sandboxes, only jobs asking for the same
+	// limit can use them. Zero means limits.default.max_memory, the limit of
+	// jobs that do not ask for one
+	MemoryLimit int64 `yaml:"memory_limit"`
+}
+
+// NativeConfig configures the backend running jobs as host processes.
+type NativeConfig struct {
+	WorkDirectory string        `yaml:"work_directory"`
+	Namespaces    bool          `yaml:"namespaces"`
+	CgroupRoot    string        `yaml:"cgroup_root"`
+	UID           int           `yaml:"uid"`
+	GID           int           `yaml:"gid"`
+	CPUTime       time.Duration `yaml:"cpu_time"`
+	MaxFileSize   int64         `yaml:"max_file_size"`
+	MaxProcesses  int           `yaml:"max_processes"`
+}
+
+type PoolConfig struct {
+	// Workers is the number of jobs executed concurrently. Zero means one
+	// worker per CPU.
+	Workers int `yaml:"workers"`
+}
+
+// RetryConfig controls how jobs failing because of the container runtime
+// are re-run. Failures caused by the submitted code are never retried.
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+const StoreBolt = "bolt"
+const StoreMemory = "memory"
+
+// StoreConfig selects where job records are kept.
+type StoreConfig struct {
+	// Backend is either "bolt" or "memory"
+	Backend string `yaml:"backend"`
+	Path    string `yaml:"path"`
+	// Retention is how long job records are kept, zero keeps them forever
+	Retention time.Duration `yaml:"retention"`
+}
+
+// CacheConfig bounds the cache of responses to identical job requests.
+type CacheConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	TTL     time.Duration `yaml:"ttl"`
+	// MaxEntries and MaxBytes evict the least recently used responses
+	MaxEntries int                `yaml:"max_entries"`
+	MaxBytes   int64              `yaml:"max_bytes"`
+	Compile    CompileCacheConfig `yaml:"compile"`
+}
+
+// CompileCacheConfig keeps workspaces after the compile phase on disk, jobs
+// with the same source and scripts restore them instead of compiling.
+type CompileCacheConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Directory string `yaml:"directory"`
+	// MaxBytes bounds the directory, the least recently used workspaces are
+	// evicted first
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxArtifactBytes bounds a single workspace, larger ones are not kept
+	MaxArtifactBytes int64 `yaml:"max_artifact_bytes"`
+}
+
+// BlobsConfig keeps the content uploaded through UploadBlob on disk, job
+// requests refer to it by SHA-256 for inputs too large to travel inline.
+type BlobsConfig struct {
+	Directory string `yaml:"directory"`
+	// MaxBytes bounds the directory, the least recently used blobs are
+	// evicted first. Blobs of queued and running jobs are kept, so the
+	// directory may exceed it meanwhile
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxBlobBytes bounds a single upload
+	MaxBlobBytes int64 `yaml:"max_blob_bytes"`
+}
+
+// GatewayConfig serves the Job service as JSON over HTTP next to gRPC, with
+// the same TLS settings and authentication.
+type GatewayConfig struct {
+	// ListenAddress of the gateway, empty disables it
+	ListenAddress   string `yaml:"listen_address"`
+	MaxRequestBytes int64  `yaml:"max_request_bytes"`
+}
+
+type MetricsConfig struct {
+	// ListenAddress serves Prometheus metrics on /metrics, empty disables it
+	ListenAddress string `yaml:"listen_address"`
+}
+
+const TracingNone = "none"
+const TracingOTLP = "otlp"
+const TracingStdout = "stdout"
+
+// TracingConfig selects where OpenTelemetry spans are exported.
+type TracingConfig struct {
+	// Exporter is "none", "otlp" or "stdout"
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host and port of an OTLP/HTTP collector
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// LogConfig overrides the logging defaults of the build.
+type LogConfig struct {
+	// Format is "json" or "console"
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+// AuthConfig makes callers authenticate with an API key or a JWT naming one of
+// the clients.
+type AuthConfig struct {
+	Enabled bool           `yaml:"enabled"`
+	Clients []ClientConfig `yaml:"clients"`
+	JWT     JWTConfig      `yaml:"jwt"`
+}
+
+// ClientConfig is a caller and what it may do.
+type ClientConfig struct {
+	Name string `yaml:"name"`
+	// APIKeyHashes are the hex encoded SHA-256 digests of the API keys of
+	// the client
+	APIKeyHashes []string `yaml:"api_key_hashes"`
+	// Images are the names of the images the client may use, empty allows
+	// every image
+	Images        []string `yaml:"images"`
+	NetworkAccess bool     `yaml:"network_access"`
+	// Admin allows calling the Admin service and reading every job
+	Admin bool `yaml:"admin"`
+	// Limits lowers the maxima of the jobs of the client, zero keeps the
+	// maximum of the server
+	Limits ResourceLimits `yaml:"limits"`
+	// CallbackURL receives the responses of the jobs of the client that name
+	// no callback URL themselves
+	CallbackURL string `yaml:"callback_url"`
+}
+
+// JWTConfig verifies tokens whose subject is the name of a client. Tokens are
+// signed with HMAC using the secret or with the RSA or ECDSA public key.
+type JWTConfig struct {
+	Issuer        string `yaml:"issuer"`
+	Audience      string `yaml:"audience"`
+	SecretFile    string `yaml:"secret_file"`
+	PublicKeyFile string `yaml:"public_key_file"`
+}
+
+// CallbackConfig controls how the responses of finished jobs are posted to
+// their callback URL. Callbacks still failing after MaxAttempts are recorded
+// as failed in the job store.
+type CallbackConfig struct {
+	// SecretFile holds the HMAC secret signing the callbacks, empty sends
+	// them unsigned
+	SecretFile     string        `yaml:"secret_file"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Timeout        time.Duration `yaml:"timeout"`
+	// AllowedHosts are the hosts callback URLs may point to, empty disables
+	// callbacks
+	AllowedHosts []string `yaml:"allowed_hosts"`
+}
+
+// HealthConfig controls the readiness reported by the gRPC health service.
+type HealthConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	// MaxQueuedJobs reports the server as not ready while more jobs wait for
+	// a worker, zero disables the check
+	MaxQueuedJobs int `yaml:"max_queued_jobs"`
+	// DrainDelay is how long the server reports not serving on shutdown
+	// before it stops accepting calls
+	DrainDelay time.Duration `yaml:"drain_delay"`
+}
+
+const QuotaKeyClient = "client"
+const QuotaKeyTenant = "tenant"
+
+// QuotasConfig limits the jobs of every client or tenant.
+type QuotasConfig struct {
+	// Key is "client" or "tenant"
+	Key     string      `yaml:"key"`
+	Default QuotaConfig `yaml:"default"`
+	// Overrides replaces the default quota of clients or tenants by name
+	Overrides map[string]QuotaConfig `yaml:"overrides"`
+}
+
+// QuotaConfig bounds the jobs of one client or tenant, zero values mean no
+// limit.
+type QuotaConfig struct {
+	// Rate is in jobs per second
+	Rate              float64 `yaml:"rate"`
+	Burst             int     `yaml:"burst"`
+	MaxConcurrentJobs int     `yaml:"max_concurrent_jobs"`
+	// MaxQueuedJobs bounds the jobs waiting for one of the concurrent jobs
+	// to finish
+	MaxQueuedJobs int `yaml:"max_queued_jobs"`
+	// DailyCPUTime is charged the processor time of run scripts
+	DailyCPUTime time.Duration `yaml:"daily_cpu_time"`
+}
+
+// Quota returns the quota of the client or tenant with the given name.
+func (q *QuotasConfig) Quota(name string) QuotaConfig {
+	if quota, ok := q.Overrides[name]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress: ":8000",
+			TLS: TLSConfig{
+				ReloadInterval: 10 * time.Second,
+			},
+		},
+		Images: []ImageConfig{{
+			Name:         "default",
+			Tag:          "execution-engine-image",
+			BuildContext: "docker/",
+		}},
+		Limits: LimitsConfig{
+			Default: ResourceLimits{
+				MaxExecutionTime:   2 * time.Second,
+				MaxMemory:          256 << 20,
+				MaxOutputSize:      1 << 20,
+				MaxOutputFilesSize: 1 << 20,
+			},
+			Maximum: ResourceLimits{
+				MaxExecutionTime:   30 * time.Second,
+				MaxMemory:          1 << 30,
+				MaxOutputSize:      16 << 20,
+				MaxOutputFilesSize: 16 << 20,
+			},
+			MaxSourceSize:  1 << 20,
+			MaxStdinSize:   2 << 20,
+			MaxCompileTime: time.Minute,
+		},
+		Security: SecurityConfig{
+			PidsLimit:       256,
+			NoNewPrivileges: true,
+		},
+		Runtime: RuntimeConfig{
+			Backend: RuntimeDocker,
+			Native: NativeConfig{
+				WorkDirectory: filepath.Join(os.TempDir(), "execution-engine"),
+				Namespaces:    true,
+				UID:           -1,
+				GID:           -1,
+				CPUTime:       10 * time.Second,
+				MaxFileSize:   64 << 20,
+				MaxProcesses:  64,
+			},
+		},
+		Pool: PoolConfig{
+			Workers: runtime.NumCPU(),
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: 200 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+		},
+		Store: StoreConfig{
+			Backend:   StoreBolt,
+			Path:      "jobs.db",
+			Retention: 30 * 24 * time.Hour,
+		},
+		Cache: CacheConfig{
+			TTL:        24 * time.Hour,
+			MaxEntries: 10000,
+			MaxBytes:   256 << 20,
+			Compile: CompileCacheConfig{
+				Directory:        filepath.Join(os.TempDir(), "execution-engine-artifacts"),
+				MaxBytes:         1 << 30,
+				MaxArtifactBytes: 64 << 20,
+			},
+		},
+		Blobs: BlobsConfig{
+			Directory:    filepath.Join(os.TempDir(), "execution-engine-blobs"),
+			MaxBytes:     8 << 30,
+			MaxBlobBytes: 1 << 30,
+		},
+		Gateway: GatewayConfig{
+			MaxRequestBytes: 8 << 20,
+		},
+		Metrics: MetricsConfig{
+			ListenAddress: ":9090",
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingNone,
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "execution-engine",
+		},
+		Quotas: QuotasConfig{
+			Key: QuotaKeyClient,
+		},
+		Callback: CallbackConfig{
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+			Timeout:        10 * time.Second,
+		},
+		Health: HealthConfig{
+			CheckInterval: 5 * time.Second,
+			DrainDelay:    5 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, a YAML or TOML file, EXECUTION_ENGINE_* environment variables and
+// overrides of the form key=value, keys being dotted paths such as
+// pool.workers.
+func Load(path string, overrides []string) (error, *Config) {
+	config := Default()
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return err, nil
+		}
+	}
+	if err := config.readEnvironment(os.LookupEnv); err != nil {
+		return err, nil
+	}
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return fmt.Errorf("override %q is not of the form key=value", override), nil
+		}
+		if err := config.Set(key, value); err != nil {
+			return err, nil
+		}
+	}
+
+	if config.Pool.Workers == 0 {
+		config.Pool.Workers = runtime.NumCPU()
+	}
+	if err := config.Validate(); err != nil {
+		return err, nil
+	}
+
+	return nil, config
+}
+
+// Image returns the image called name, or the default image when name is
+// empty.
+func (c *Config) Image(name string) (error, *ImageConfig) {
+	if name == "" {
+		return nil, &c.Images[0]
+	}
+	for i := range c.Images {
+		if c.Images[i].Name == name {
+			return nil, &c.Images[i]
+		}
+	}
+	return fmt.Errorf("unknown image %q", name), nil
+}
+
+// WarmPoolMemoryLimit returns the memory limit of the ready sandboxes.
+func (c *Config) WarmPoolMemoryLimit() int64 {
+	if c.Runtime.WarmPool.MemoryLimit == 0 {
+		return c.Limits.Default.MaxMemory
+	}
+	return c.Runtime.WarmPool.MemoryLimit
+}
+
+// Client returns the client with the given name, or nil.
+func (c *Config) Client(name string) *ClientConfig {
+	for i := range c.Auth.Clients {
+		if c.Auth.Clients[i].Name == name {
+			return &c.Auth.Clients[i]
+		}
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.Server.ListenAddress == "" {
+		return errors.New("server.listen_address must not be empty")
+	}
+	if len(c.Images) == 0 {
+		return errors.New("images must not be empty")
+	}
+	names := map[string]bool{}
+	for _, image := range c.Images {
+		if image.Name == "" || image.Tag == "" {
+			return errors.New("images need a name and a tag")
+		}
+		if names[image.Name] {
+			return fmt.Errorf("image %q is configured twice", image.Name)
+		}
+		names[image.Name] = true
+	}
+	if tlsConfig := c.Server.TLS; (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		return errors.New("server.tls.cert_file and server.tls.key_file must be set together")
+	} else if tlsConfig.ClientCAFile != "" && tlsConfig.CertFile == "" {
+		return errors.New("server.tls.client_ca_file requires server.tls.cert_file")
+	} else if tlsConfig.ReloadInterval < 0 {
+		return errors.New("server.tls.reload_interval must not be negative")
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	if c.Security.PidsLimit < 0 {
+		return errors.New("security.pids_limit must not be negative")
+	}
+	if c.Runtime.Backend != RuntimeDocker && c.Runtime.Backend != RuntimeNative {
+		return fmt.Errorf("runtime.backend must be %q or %q", RuntimeDocker, RuntimeNative)
+	}
+	if c.Runtime.WarmPool.Size < 0 {
+		return errors.New("runtime.warm_pool.size must not be negative")
+	}
+	// No job could use sandboxes with a limit above the maximum
+	if memoryLimit := c.Runtime.WarmPool.MemoryLimit; memoryLimit < 0 {
+		return errors.New("runtime.warm_pool.memory_limit must not be negative")
+	} else if memoryLimit > c.Limits.Maximum.MaxMemory {
+		return errors.New("runtime.warm_pool.memory_limit exceeds limits.maximum.max_memory")
+	}
+	if c.Pool.Workers < 1 {
+		return errors.New("pool.workers must be positive")
+	}
+	if c.Retry.MaxAttempts < 1 {
+		return errors.New("retry.max_attempts must be positive")
+	}
+	if c.Retry.InitialBackoff < 0 || c.Retry.MaxBackoff < 0 {
+		return errors.New("retry backoffs must not be negative")
+	}
+	if c.Store.Backend != StoreBolt && c.Store.Backend != StoreMemory {
+		return fmt.Errorf("store.backend must be %q or %q", StoreBolt, StoreMemory)
+	}
+	if c.Store.Retention < 0 {
+		return errors.New("store.retention must not be negative")
+	}
+	if c.Cache.TTL < 0 || c.Cache.MaxEntries < 0 || c.Cache.MaxBytes < 0 {
+		return errors.New("cache bounds must not be negative")
+	}
+	if c.Cache.Compile.MaxBytes < 0 || c.Cache.Compile.MaxArtifactBytes < 0 {
+		return errors.New("cache.compile bounds must not be negative")
+	}
+	if c.Blobs.Directory == "" {
+		return errors.New("blobs.directory must not be empty")
+	}
+	if c.Blobs.MaxBytes < 0 || c.Blobs.MaxBlobBytes < 0 {
+		return errors.New("blobs bounds must not be negative")
+	}
+	switch c.Tracing.Exporter {
+	case TracingNone, TracingOTLP, TracingStdout:
+	default:
+		return fmt.Errorf("tracing.exporter must be %q, %q or %q", TracingNone, TracingOTLP, TracingStdout)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return errors.New("tracing.sample_ratio must be between 0 and 1")
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if c.Callback.MaxAttempts <= 0 {
+		return errors.New("callback.max_attempts must be positive")
+	}
+	if c.Callback.InitialBackoff < 0 || c.Callback.MaxBackoff < 0 || c.Callback.Timeout < 0 {
+		return errors.New("callback backoffs and timeout must not be negative")
+	}
+	if c.Gateway.MaxRequestBytes <= 0 {
+		return errors.New("gateway.max_request_bytes must be positive")
+	}
+	if c.Health.CheckInterval <= 0 {
+		return errors.New("health.check_interval must be positive")
+	}
+	if c.Health.MaxQueuedJobs < 0 || c.Health.DrainDelay < 0 {
+		return errors.New("health.max_queued_jobs and health.drain_delay must not be negative")
+	}
+	if c.Quotas.Key != QuotaKeyClient && c.Quotas.Key != QuotaKeyTenant {
+		return fmt.Errorf("quotas.key must be %q or %q", QuotaKeyClient, QuotaKeyTenant)
+	}
+	if err := c.Quotas.Default.validate(); err != nil {
+		return fmt.Errorf("quotas.default: %w", err)
+	}
+	for name, quota := range c.Quotas.Overrides {
+		if err := quota.validate(); err != nil {
+			return fmt.Errorf("quotas.overrides.%s: %w", name, err)
+		}
+	}
+	if c.Log.Format != "" && c.Log.Format != "json" && c.Log.Format != "console" {
+		return errors.New(`log.format must be "json" or "console"`)
+	}
+	if c.Log.Level != "" {
+		if _, err := zapcore.ParseLevel(c.Log.Level); err != nil {
+			return fmt.Errorf("log.level: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *LimitsConfig) validate() error {
+	for _, limit := range []struct {
+		name                  string
+		defaultValue, maximum int64
+	}{
+		{"max_execution_time", int64(l.Default.MaxExecutionTime), int64(l.Maximum.MaxExecutionTime)},
+		{"max_memory", l.Default.MaxMemory, l.Maximum.MaxMemory},
+		{"max_output_size", l.Default.MaxOutputSize, l.Maximum.MaxOutputSize},
+		{"max_output_files_size", l.Default.MaxOutputFilesSize, l.Maximum.MaxOutputFilesSize},
+	} {
+		if limit.defaultValue <= 0 || limit.maximum <= 0 {
+			return fmt.Errorf("limits of %s must be positive", limit.name)
+		}
+		if limit.defaultValue > limit.maximum {
+			return fmt.Errorf("limits.default.%s exceeds limits.maximum.%s", limit.name, limit.name)
+		}
+	}
+	if l.MaxSourceSize <= 0 || l.MaxStdinSize <= 0 {
+		return errors.New("limits.max_source_size and limits.max_stdin_size must be positive")
+	}
+	if l.MaxCompileTime <= 0 {
+		return errors.New("limits.max_compile_time must be positive")
+	}
+	return nil
+}
+
+func (a *AuthConfig) validate() error {
+	if a.JWT.SecretFile != "" && a.JWT.PublicKeyFile != "" {
+		return errors.New("auth.jwt.secret_file and auth.jwt.public_key_file are exclusive")
+	}
+	names := map[string]bool{}
+	for _, client := range a.Clients {
+		if client.Name == "" {
+			return errors.New("auth clients need a name")
+		}
+		if names[client.Name] {
+			return fmt.Errorf("auth client %q is defined twice", client.Name)
+		}
+		names[client.Name] = true
+		for _, hash := range client.APIKeyHashes {
+			if digest, err := hex.DecodeString(hash); err != nil || len(digest) != sha256.Size {
+				return fmt.Errorf("auth client %q has an API key hash that is not a hex encoded SHA-256 digest", client.Name)
+			}
+		}
+		if client.Limits.MaxExecutionTime < 0 || client.Limits.MaxMemory < 0 || client.Limits.MaxOutputSize < 0 {
+			return fmt.Errorf("limits of auth client %q must not be negative", client.Name)
+		}
+	}
+	return nil
+}
+
+func (q *QuotaConfig) validate() error {
+	if q.Rate < 0 || q.Burst < 0 || q.MaxConcurrentJobs < 0 || q.MaxQueuedJobs < 0 || q.DailyCPUTime < 0 {
+		return errors.New("quotas must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFiles(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  listen_address: ":9000"
+pool:
+  workers: 3
+limits:
+  maximum:
+    max_execution_time: 1m
+images:
+  - name: python
+    tag: python:3.12
+`,
+		"config.toml": `
+[server]
+listen_address = ":9000"
+
+[pool]
+workers = 3
+
+[limits.maximum]
+max_execution_time = "1m"
+
+[[images]]
+name = "python"
+tag = "python:3.12"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			err, config := Load(writeFile(t, name, content), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Server.ListenAddress != ":9000" || config.Pool.Workers != 3 {
+				t.Errorf("listen address = %q, workers = %d", config.Server.ListenAddress, config.Pool.Workers)
+			}
+			if config.Limits.Maximum.MaxExecutionTime != time.Minute || config.Limits.Default.MaxExecutionTime != 2*time.Second {
+				t.Errorf("limits = %+v, want the maximum overridden only", config.Limits)
+			}
+			if len(config.Images) != 1 || config.Images[0].Tag != "python:3.12" {
+				t.Errorf("images = %+v, want the configured image only", config.Images)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "pool:\n  workers: 3\nstore:\n  path: file.db\n")
+	t.Setenv("EXECUTION_ENGINE_POOL_WORKERS", "4")
+	t.Setenv("EXECUTION_ENGINE_RETRY_MAX_BACKOFF", "1s")
+	t.Setenv("EXECUTION_ENGINE_SECURITY_CAP_DROP", "[ALL]")
+
+	err, config := Load(path, []string{"pool.workers=5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Pool.Workers != 5 {
+		t.Errorf("workers = %d, flags must win over the environment", config.Pool.Workers)
+	}
+	if config.Retry.MaxBackoff != time.Second || len(config.Security.CapDrop) != 1 {
+		t.Errorf("max backoff = %v, cap drop = %v, want them from the environment", config.Retry.MaxBackoff, config.Security.CapDrop)
+	}
+	if config.Store.Path != "file.db" {
+		t.Errorf("store path = %q, want it from the file", config.Store.Path)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string][]string{
+		"unknown setting":          {"pool.threads=4"},
+		"section":                  {"pool=4"},
+		"malformed override":       {"pool.workers"},
+		"invalid value":            {"pool.workers=many"},
+		"default above maximum":    {"limits.default.max_memory=2147483648"},
+		"duplicate image":          {"images=[{name: a, tag: a}, {name: a, tag: b}]"},
+		"no image":                 {"images=[]"},
+		"negative pids limit":      {"security.pids_limit=-1"},
+		"unknown log format":       {"log.format=xml"},
+		"unknown tracing exporter": {"tracing.exporter=zipkin"},
+		"no callback attempts":     {"callback.max_attempts=0"},
+		"no blob directory":        {"blobs.directory="},
+		"warm memory over maximum": {"runtime.warm_pool.memory_limit=2147483648"},
+		"no compile time":          {"limits.max_compile_time=0s"},
+	}
+
+	for name, overrides := range tests {
+		if err, _ := Load("", overrides); err == nil {
+			t.Errorf("%s: Load succeeded, want an error", name)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	err, config := Load("", []string{"images=[{name: c, tag: gcc:14}, {name: python, tag: python:3.12}]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"": "gcc:14", "c": "gcc:14", "python": "python:3.12"} {
+		err, image := config.Image(name)
+		if err != nil || image.Tag != want {
+			t.Errorf("Image(%q) = %v, %v, want %s", name, image, err, want)
+		}
+	}
+	if err, _ := config.Image("ruby"); err == nil {
+		t.Error("unknown image was found")
+	}
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	err, config := Load("", []string{"retry.max_backoff=90s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, content := config.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err, reloaded := Load(writeFile(t, "dump.yaml", string(content)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Retry.MaxBackoff != 90*time.Second {
+		t.Errorf("max backoff = %v after a round trip", reloaded.Retry.MaxBackoff)
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// environmentPrefix starts the environment variables overriding settings,
+// pool.workers is set by EXECUTION_ENGINE_POOL_WORKERS.
+const environmentPrefix = "EXECUTION_ENGINE_"
+
+// readFile decodes YAML, or TOML for files ending in .toml, on top of c.
+func (c *Config) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if filepath.Ext(path) == ".toml" {
+		// TOML is converted to YAML so that the yaml tags are the only
+		// mapping of keys to fields
+		var document map[string]interface{}
+		if err := toml.Unmarshal(content, &document); err != nil {
+			return fmt.Errorf("failed to parse config file: %w", err)
+		}
+		if content, err = yaml.Marshal(document); err != nil {
+			return fmt.Errorf("failed to convert config file: %w", err)
+		}
+	}
+
+	if err := yaml.Unmarshal(content, c); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return nil
+}
+
+// readEnvironment applies every setting found through lookup.
+func (c *Config) readEnvironment(lookup func(string) (string, bool)) error {
+	for _, key := range Keys() {
+		name := environmentPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if value, ok := lookup(name); ok {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Set parses value as YAML into the setting at the dotted path key, so lists
+// are written as [a, b] and durations as 1m30s.
+func (c *Config) Set(key string, value string) error {
+	field := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if field.Kind() != reflect.Struct {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		index := fieldIndex(field.Type(), name)
+		if index < 0 {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		field = field.Field(index)
+	}
+	if field.Kind() == reflect.Struct {
+		return fmt.Errorf("setting %q is a section", key)
+	}
+
+	if value == "" {
+		field.SetZero()
+		return nil
+	}
+	parsed := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
+
+// Keys lists the dotted paths of all settings.
+func Keys() []string {
+	return keys(reflect.TypeOf(Config{}), "")
+}
+
+func keys(t reflect.Type, prefix string) []string {
+	var result []string
+	for i := range t.NumField() {
+		name := yamlName(t.Field(i))
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			result = append(result, keys(t.Field(i).Type, prefix+name+".")...)
+		} else {
+			result = append(result, prefix+name)
+		}
+	}
+	return result
+}
+
+func fieldIndex(t reflect.Type, name string) int {
+	for i := range t.NumField() {
+		if yamlName(t.Field(i)) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
+
+// Dump renders the configuration as YAML.
+func (c *Config) Dump() (error, []byte) {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to render configuration: %w", err), nil
+	}
+	return nil, content
+}
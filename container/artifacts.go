@@ -0,0 +1,82 @@
+package container
+
+import (
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+)
+
+// ArtifactCache keeps archived workspaces of jobs that passed the compile
+// phase, so that jobs with the same source and scripts can skip setup and
+// compile.
+type ArtifactCache interface {
+	// Get returns nil when there is no artifact for key.
+	Get(key string) (error, io.ReadCloser)
+	Put(key string, archive io.Reader) error
+}
+
+// ArtifactKey hashes everything the setup and compile phases depend on.
+func ArtifactKey(request *job.JobRequest, imageID string) string {
+	hash := sha256.New()
+	fields := []string{imageID, request.SourceCodeFileName, request.SourceCode, request.SetupScript, request.CompileScript}
+	fields = append(fields, request.EnvironmentVariables...)
+	// Setup and compile scripts may read the files of the request
+	for _, file := range request.Files {
+		fields = append(fields, file.Name, file.Blob, strconv.FormatBool(file.Executable))
+	}
+	for _, field := range fields {
+		// Length prefixes keep distinct field lists from hashing alike
+		binary.Write(hash, binary.BigEndian, uint64(len(field)))
+		io.WriteString(hash, field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// restoreArtifact copies a cached workspace into the sandbox. It returns the
+// artifact key, which is empty when the image cannot be identified. Failures
+// are not fatal, the job then runs setup and compile itself.
+func restoreArtifact(ctx context.Context, runtime Runtime, artifacts ArtifactCache, sandboxID, image string, request *job.JobRequest) (bool, string) {
+	err, imageID := runtime.ImageID(ctx, image)
+	if err != nil {
+		log.FromContext(ctx).Warn("Cannot identify image, skipping compile cache", zap.Error(err))
+		return false, ""
+	}
+	key := ArtifactKey(request, imageID)
+
+	err, archive := artifacts.Get(key)
+	if err != nil {
+		log.FromContext(ctx).Warn("Cannot read compile artifact", zap.Error(err))
+		return false, key
+	}
+	if archive == nil {
+		return false, key
+	}
+	defer archive.Close()
+
+	log.FromContext(ctx).Debug("Restoring compile artifact", zap.String("artifactKey", key))
+	if err := runtime.CopyTo(ctx, sandboxID, ".", archive); err != nil {
+		log.FromContext(ctx).Warn("Cannot restore compile artifact", zap.Error(err))
+		return false, key
+	}
+	return true, key
+}
+
+func storeArtifact(ctx context.Context, runtime Runtime, artifacts ArtifactCache, sandboxID, key string) {
+	log.FromContext(ctx).Debug("Storing compile artifact", zap.String("artifactKey", key))
+	err, archive := runtime.CopyFrom(ctx, sandboxID, ".")
+	if err != nil {
+		log.FromContext(ctx).Warn("Cannot archive workspace", zap.Error(err))
+		return
+	}
+	defer archive.Close()
+
+	if err := artifacts.Put(key, archive); err != nil {
+		log.FromContext(ctx).Warn("Cannot store compile artifact", zap.Error(err))
+	}
+}
@@ -1,10 +1,21 @@
 package container
 
-const containerWorkingDirectory = "/workspace"
-
 const setupScriptFileName = "setup.sh"
 const compileScriptFileName = "compile.sh"
 const runScriptFileName = "run.sh"
-const setupScriptPath = containerWorkingDirectory + "/" + setupScriptFileName
-const compileScriptPath = containerWorkingDirectory + "/" + compileScriptFileName
-const runScriptPath = containerWorkingDirectory + "/" + runScriptFileName
+
+const StatusFinished = "Finished"
+const StatusSetupError = "Internal Error"
+const StatusCompileError = "Compile Error"
+const StatusTimeLimitExceeded = "Time Limit Exceeded"
+const StatusMemoryLimitExceeded = "Memory Limit Exceeded"
+const StatusAborted = "Aborted"
+
+const PhaseQueue = "queue"
+const PhasePrepare = "prepare"
+const PhaseSetup = "setup"
+const PhaseCompile = "compile"
+const PhaseRun = "run"
+
+const StreamStdout = "stdout"
+const StreamStderr = "stderr"
@@ -0,0 +1,14 @@
+package docker
+
+type Options struct {
+	NetworkDisabled bool
+	// PidsLimit bounds the processes of a sandbox, zero means unlimited
+	PidsLimit       int64
+	CapDrop         []string
+	NoNewPrivileges bool
+	// User jobs are run as, empty keeps the user of the image
+	User string
+	// SeccompProfile is the path of a JSON seccomp profile, empty keeps the
+	// default profile of Docker
+	SeccompProfile string
+}
@@ -0,0 +1,241 @@
+package docker
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/log"
+	"context"
+	"encoding/json"
+	"fmt"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// execPollInterval is how often a finished exec is inspected until Docker
+// reports it as no longer running.
+const execPollInterval = 10 * time.Millisecond
+
+type dockerRuntime struct {
+	cli         *client.Client
+	options     Options
+	securityOpt []string
+}
+
+// NewRuntime returns a container.Runtime backed by the Docker daemon. The
+// client is shared by all sandboxes.
+func NewRuntime(cli *client.Client, options *Options) (error, container.Runtime) {
+	r := &dockerRuntime{
+		cli:     cli,
+		options: *options,
+	}
+	if options.NoNewPrivileges {
+		r.securityOpt = append(r.securityOpt, "no-new-privileges")
+	}
+	if options.SeccompProfile != "" {
+		// The daemon expects the profile itself rather than its path
+		profile, err := os.ReadFile(options.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("failed to read seccomp profile: %w", err), nil
+		}
+		r.securityOpt = append(r.securityOpt, "seccomp="+string(profile))
+	}
+
+	return nil, r
+}
+
+func (r *dockerRuntime) Create(ctx context.Context, spec *container.SandboxSpec) (error, string) {
+	var pidsLimit *int64
+	if r.options.PidsLimit > 0 {
+		pidsLimit = &r.options.PidsLimit
+	}
+	response, err := r.cli.ContainerCreate(ctx, &dockercontainer.Config{
+		Image:           spec.Image,
+		WorkingDir:      containerWorkingDirectory,
+		Tty:             false,
+		AttachStdout:    true,
+		AttachStderr:    true,
+		AttachStdin:     true,
+		NetworkDisabled: r.options.NetworkDisabled && !spec.NetworkAccess,
+		User:            r.options.User,
+	}, &dockercontainer.HostConfig{
+		Resources: dockercontainer.Resources{
+			Memory:    spec.MemoryLimit,
+			PidsLimit: pidsLimit,
+		},
+		CapDrop:     r.options.CapDrop,
+		SecurityOpt: r.securityOpt,
+	}, nil, nil, "")
+	if err != nil {
+		return err, ""
+	}
+
+	return nil, response.ID
+}
+
+func (r *dockerRuntime) Start(ctx context.Context, sandboxID string) error {
+	return r.cli.ContainerStart(ctx, sandboxID, dockercontainer.StartOptions{})
+}
+
+func (r *dockerRuntime) CopyTo(ctx context.Context, sandboxID, directory string, archive io.Reader) error {
+	return r.cli.CopyToContainer(ctx, sandboxID, path.Join(containerWorkingDirectory, directory), archive, dockercontainer.CopyToContainerOptions{})
+}
+
+func (r *dockerRuntime) CopyFrom(ctx context.Context, sandboxID, name string) (error, io.ReadCloser) {
+	source := path.Join(containerWorkingDirectory, name)
+	stat, err := r.cli.ContainerStatPath(ctx, sandboxID, source)
+	if err != nil {
+		return err, nil
+	}
+	if stat.Mode.IsDir() {
+		// The trailing "." makes Docker archive the content of the directory
+		// instead of the directory itself.
+		source += "/."
+	}
+	archive, _, err := r.cli.CopyFromContainer(ctx, sandboxID, source)
+	if err != nil {
+		return err, nil
+	}
+	return nil, archive
+}
+
+func (r *dockerRuntime) Exec(ctx context.Context, sandboxID string, options *container.ExecOptions) (error, *container.ExecResult) {
+	// Commands run one at a time, the usage of the container grows by the
+	// usage of this one
+	cpuUsageBefore := r.cpuUsage(ctx, sandboxID)
+	execConfig, err := r.cli.ContainerExecCreate(ctx, sandboxID, dockercontainer.ExecOptions{
+		Cmd:          options.Command,
+		Env:          options.EnvironmentVariables,
+		AttachStdout: true,
+		AttachStderr: true,
+		AttachStdin:  options.Stdin != nil,
+		Tty:          false,
+	})
+	if err != nil {
+		return err, nil
+	}
+
+	hijackedResponse, err := r.cli.ContainerExecAttach(ctx, execConfig.ID, dockercontainer.ExecAttachOptions{})
+	if err != nil {
+		return err, nil
+	}
+	defer hijackedResponse.Close()
+
+	if options.Stdin != nil {
+		go func() {
+			// Programs are free to exit without consuming their input, so a
+			// failed write is not an error of the execution.
+			_, err := io.Copy(hijackedResponse.Conn, options.Stdin)
+			if err == nil {
+				err = hijackedResponse.CloseWrite()
+			}
+			if err != nil {
+				log.FromContext(ctx).Debug("Cannot write stdin", zap.Error(err))
+			}
+		}()
+	}
+
+	stdout := options.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	stderr := options.Stderr
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	outputErrorChannel := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, hijackedResponse.Reader)
+		outputErrorChannel <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Make sure nothing writes to the output buffers once we return
+		hijackedResponse.Close()
+		<-outputErrorChannel
+		return ctx.Err(), nil
+	case err := <-outputErrorChannel:
+		if err != nil {
+			return err, nil
+		}
+	}
+
+	for {
+		execInspectResponse, err := r.cli.ContainerExecInspect(ctx, execConfig.ID)
+		if err != nil {
+			return err, nil
+		}
+		if !execInspectResponse.Running {
+			cpuTime := time.Duration(-1)
+			if cpuUsageBefore >= 0 {
+				if cpuUsageAfter := r.cpuUsage(ctx, sandboxID); cpuUsageAfter >= 0 {
+					cpuTime = cpuUsageAfter - cpuUsageBefore
+				}
+			}
+			return nil, &container.ExecResult{
+				ExitCode: execInspectResponse.ExitCode,
+				CPUTime:  cpuTime,
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err(), nil
+		case <-time.After(execPollInterval):
+		}
+	}
+}
+
+// cpuUsage returns the processor time used by a container so far, or -1 when
+// Docker cannot tell.
+func (r *dockerRuntime) cpuUsage(ctx context.Context, sandboxID string) time.Duration {
+	stats, err := r.cli.ContainerStatsOneShot(ctx, sandboxID)
+	if err != nil {
+		log.FromContext(ctx).Debug("Cannot read container statistics", zap.Error(err))
+		return -1
+	}
+	defer stats.Body.Close()
+
+	var response dockercontainer.StatsResponse
+	if err := json.NewDecoder(stats.Body).Decode(&response); err != nil {
+		log.FromContext(ctx).Debug("Cannot read container statistics", zap.Error(err))
+		return -1
+	}
+	return time.Duration(response.CPUStats.CPUUsage.TotalUsage)
+}
+
+func (r *dockerRuntime) Inspect(ctx context.Context, sandboxID string) (error, *container.SandboxState) {
+	response, err := r.cli.ContainerInspect(ctx, sandboxID)
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, &container.SandboxState{
+		Running:   response.State.Running,
+		ExitCode:  response.State.ExitCode,
+		OOMKilled: response.State.OOMKilled,
+	}
+}
+
+func (r *dockerRuntime) Kill(ctx context.Context, sandboxID string) error {
+	return r.cli.ContainerKill(ctx, sandboxID, "SIGKILL")
+}
+
+func (r *dockerRuntime) Remove(ctx context.Context, sandboxID string) error {
+	return r.cli.ContainerRemove(ctx, sandboxID, dockercontainer.RemoveOptions{
+		Force: true,
+	})
+}
+
+func (r *dockerRuntime) ImageID(ctx context.Context, image string) (error, string) {
+	response, _, err := r.cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return err, ""
+	}
+	return nil, response.ID
+}
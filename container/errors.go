@@ -0,0 +1,34 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InfrastructureError marks a failure of the container runtime itself, as
+// opposed to an outcome caused by the submitted code. Only infrastructure
+// errors are worth retrying.
+type InfrastructureError struct {
+	Operation string
+	Err       error
+}
+
+func (e *InfrastructureError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Operation, e.Err)
+}
+
+func (e *InfrastructureError) Unwrap() error {
+	return e.Err
+}
+
+func IsInfrastructureError(err error) bool {
+	var infrastructureError *InfrastructureError
+	return errors.As(err, &infrastructureError)
+}
+
+func newInfrastructureError(operation string, err error) error {
+	return &InfrastructureError{
+		Operation: operation,
+		Err:       err,
+	}
+}
@@ -0,0 +1,431 @@
+package fake
+
+import (
+	"ExecutionEngine/container"
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of the runtime for which failures can be injected.
+const (
+	OperationCreate   = "create"
+	OperationStart    = "start"
+	OperationCopyTo   = "copyTo"
+	OperationCopyFrom = "copyFrom"
+	OperationExec     = "exec"
+	OperationInspect  = "inspect"
+	OperationKill     = "kill"
+	OperationRemove   = "remove"
+	OperationImageID  = "imageID"
+)
+
+// ErrInjected is returned by operations configured to fail.
+var ErrInjected = errors.New("injected runtime failure")
+
+// Behavior describes what happens when a command is executed in a sandbox.
+type Behavior struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	// EchoStdin copies the standard input to the standard output
+	EchoStdin bool
+	// Delay is how long the command runs, exceeding the context deadline
+	// turns the execution into a timeout
+	Delay time.Duration
+	// OOMKilled stops the sandbox as if it ran out of memory
+	OOMKilled bool
+	// ExitSandbox stops the whole sandbox with ExitCode, like /exit.sh does
+	ExitSandbox bool
+	// Files are written to the sandbox by the command, like compilers do
+	Files map[string]string
+	// CPUTime is reported as the processor time of the command
+	CPUTime time.Duration
+}
+
+type sandbox struct {
+	spec    *container.SandboxSpec
+	files   map[string][]byte
+	state   container.SandboxState
+	removed bool
+}
+
+// Runtime is an in-memory container.Runtime for tests. Commands are matched
+// against Behaviors by their last argument, which is the script file name
+// for jobs; unknown commands succeed without output. find lists the files of
+// the sandbox, separated by null bytes, whatever its arguments.
+type Runtime struct {
+	lock      sync.Mutex
+	behaviors map[string]Behavior
+	failures  map[string]int
+	sandboxes map[string]*sandbox
+	nextID    int
+	created   int
+	// copied are the files archived by CopyFrom
+	copied []string
+
+	imageGeneration int
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{
+		behaviors: map[string]Behavior{},
+		failures:  map[string]int{},
+		sandboxes: map[string]*sandbox{},
+	}
+}
+
+func (r *Runtime) SetBehavior(command string, behavior Behavior) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.behaviors[command] = behavior
+}
+
+// FailNext makes the next count calls of operation return ErrInjected.
+func (r *Runtime) FailNext(operation string, count int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.failures[operation] = count
+}
+
+// LiveSandboxes returns the number of sandboxes that were not removed yet.
+func (r *Runtime) LiveSandboxes() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	live := 0
+	for _, s := range r.sandboxes {
+		if !s.removed {
+			live++
+		}
+	}
+	return live
+}
+
+// CreatedSandboxes returns the number of sandboxes created so far.
+func (r *Runtime) CreatedSandboxes() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.created
+}
+
+// CopiedFiles returns the names of the files archived by CopyFrom so far, in
+// the order they were archived.
+func (r *Runtime) CopiedFiles() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return slices.Clone(r.copied)
+}
+
+func (r *Runtime) Create(ctx context.Context, spec *container.SandboxSpec) (error, string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationCreate); err != nil {
+		return err, ""
+	}
+
+	r.nextID++
+	r.created++
+	sandboxID := fmt.Sprintf("fake-%d", r.nextID)
+	r.sandboxes[sandboxID] = &sandbox{
+		spec:  spec,
+		files: map[string][]byte{},
+	}
+
+	return nil, sandboxID
+}
+
+func (r *Runtime) Start(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationStart); err != nil {
+		return err
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+	s.state.Running = true
+
+	return nil
+}
+
+func (r *Runtime) CopyTo(ctx context.Context, sandboxID, directory string, archive io.Reader) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationCopyTo); err != nil {
+		return err
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return err
+		}
+		s.files[path.Join(directory, header.Name)] = content
+	}
+}
+
+func (r *Runtime) CopyFrom(ctx context.Context, sandboxID, name string) (error, io.ReadCloser) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationCopyFrom); err != nil {
+		return err, nil
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err, nil
+	}
+
+	var prefix string
+	var names []string
+	name = path.Clean(name)
+	if _, ok := s.files[name]; ok {
+		// A file is archived alone, named after itself
+		prefix, names = path.Dir(name)+"/", []string{name}
+	} else {
+		if name != "." {
+			prefix = name + "/"
+		}
+		for file := range s.files {
+			if strings.HasPrefix(file, prefix) {
+				names = append(names, file)
+			}
+		}
+		sort.Strings(names)
+	}
+	r.copied = append(r.copied, names...)
+
+	archive := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(archive)
+	for _, name := range names {
+		header := &tar.Header{
+			Name: strings.TrimPrefix(name, prefix),
+			Mode: 0644,
+			Size: int64(len(s.files[name])),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err, nil
+		}
+		if _, err := tarWriter.Write(s.files[name]); err != nil {
+			return err, nil
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err, nil
+	}
+
+	return nil, io.NopCloser(archive)
+}
+
+func (r *Runtime) Exec(ctx context.Context, sandboxID string, options *container.ExecOptions) (error, *container.ExecResult) {
+	r.lock.Lock()
+	if err := r.fail(OperationExec); err != nil {
+		r.lock.Unlock()
+		return err, nil
+	}
+	err, s := r.sandbox(sandboxID)
+	if err == nil && !s.state.Running {
+		err = fmt.Errorf("sandbox %s is not running", sandboxID)
+	}
+	behavior := r.behaviors[options.Command[len(options.Command)-1]]
+	r.lock.Unlock()
+	if err != nil {
+		return err, nil
+	}
+
+	if behavior.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err(), nil
+		case <-time.After(behavior.Delay):
+		}
+	}
+
+	if behavior.EchoStdin && options.Stdin != nil && options.Stdout != nil {
+		if _, err := io.Copy(options.Stdout, options.Stdin); err != nil {
+			return err, nil
+		}
+	}
+	if options.Command[0] == "find" && options.Stdout != nil {
+		r.lock.Lock()
+		names := slices.Sorted(maps.Keys(s.files))
+		r.lock.Unlock()
+		for _, name := range names {
+			io.WriteString(options.Stdout, "./"+name+"\x00")
+		}
+	}
+	if options.Stdout != nil {
+		io.WriteString(options.Stdout, behavior.Stdout)
+	}
+	if options.Stderr != nil {
+		io.WriteString(options.Stderr, behavior.Stderr)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, content := range behavior.Files {
+		s.files[path.Clean(name)] = []byte(content)
+	}
+	switch {
+	case behavior.OOMKilled:
+		s.state = container.SandboxState{Running: false, ExitCode: 137, OOMKilled: true}
+		return nil, &container.ExecResult{ExitCode: 137, CPUTime: behavior.CPUTime}
+	case behavior.ExitSandbox:
+		s.state = container.SandboxState{Running: false, ExitCode: behavior.ExitCode}
+		return nil, &container.ExecResult{ExitCode: 137, CPUTime: behavior.CPUTime}
+	}
+
+	return nil, &container.ExecResult{
+		ExitCode: behavior.ExitCode,
+		CPUTime:  behavior.CPUTime,
+	}
+}
+
+func (r *Runtime) Inspect(ctx context.Context, sandboxID string) (error, *container.SandboxState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationInspect); err != nil {
+		return err, nil
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err, nil
+	}
+	state := s.state
+
+	return nil, &state
+}
+
+func (r *Runtime) Kill(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationKill); err != nil {
+		return err
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+	s.state = container.SandboxState{Running: false, ExitCode: 137}
+
+	return nil
+}
+
+func (r *Runtime) Remove(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationRemove); err != nil {
+		return err
+	}
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+	s.removed = true
+	s.state.Running = false
+
+	return nil
+}
+
+// ImageID derives the ID from the image name and the generation set by
+// RebuildImage.
+func (r *Runtime) ImageID(ctx context.Context, image string) (error, string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.fail(OperationImageID); err != nil {
+		return err, ""
+	}
+	return nil, fmt.Sprintf("sha256:%s-%d", image, r.imageGeneration)
+}
+
+// RebuildImage changes the IDs of all images.
+func (r *Runtime) RebuildImage() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.imageGeneration++
+}
+
+// Spec returns the specification a sandbox was created with, removed
+// sandboxes are still known.
+func (r *Runtime) Spec(sandboxID string) (error, *container.SandboxSpec) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.sandboxes[sandboxID]
+	if !ok {
+		return fmt.Errorf("no such sandbox: %s", sandboxID), nil
+	}
+	return nil, s.spec
+}
+
+// File returns the content of a file copied into a sandbox, removed sandboxes
+// keep their files.
+func (r *Runtime) File(sandboxID, name string) (error, []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.sandboxes[sandboxID]
+	if !ok {
+		return fmt.Errorf("no such sandbox: %s", sandboxID), nil
+	}
+	content, ok := s.files[path.Clean(name)]
+	if !ok {
+		return fmt.Errorf("no such file: %s", name), nil
+	}
+
+	return nil, content
+}
+
+// fail must be called with lock held.
+func (r *Runtime) fail(operation string) error {
+	if r.failures[operation] <= 0 {
+		return nil
+	}
+	r.failures[operation]--
+	return fmt.Errorf("%s: %w", operation, ErrInjected)
+}
+
+// sandbox must be called with lock held.
+func (r *Runtime) sandbox(sandboxID string) (error, *sandbox) {
+	s, ok := r.sandboxes[sandboxID]
+	if !ok || s.removed {
+		return fmt.Errorf("no such sandbox: %s", sandboxID), nil
+	}
+	return nil, s
+}
@@ -0,0 +1,135 @@
+package container
+
+import (
+	"ExecutionEngine/proto/job"
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// BlobStore holds the uploaded content job requests refer to by SHA-256.
+type BlobStore interface {
+	// Open returns the content of a blob and its size.
+	Open(digest string) (error, io.ReadCloser, int64)
+}
+
+var errNoBlobStore = errors.New("the request refers to blobs but there is no blob store")
+
+// streamedFile is read from content while it is copied into a sandbox.
+type streamedFile struct {
+	name    string
+	mode    int64
+	size    int64
+	content io.ReadCloser
+}
+
+// writeStreamedFiles copies files into the working directory of a sandbox.
+// The archive is written while the runtime extracts it, so files are never
+// held in memory as a whole.
+func writeStreamedFiles(ctx context.Context, runtime Runtime, sandboxID string, files []streamedFile) error {
+	reader, writer := io.Pipe()
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		writer.CloseWithError(writeArchive(writer, files))
+	}()
+
+	err := runtime.CopyTo(ctx, sandboxID, ".", reader)
+	// Unblocks the archive when the runtime stopped reading early
+	reader.CloseWithError(io.ErrClosedPipe)
+	<-written
+	return err
+}
+
+func writeArchive(w io.Writer, files []streamedFile) error {
+	tarWriter := tar.NewWriter(w)
+	directories := map[string]bool{".": true}
+	for _, file := range files {
+		// Runtimes give the directories of entries to the sandbox user
+		if err := writeDirectories(tarWriter, path.Dir(file.name), directories); err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name: file.name,
+			Mode: file.mode,
+			Size: file.size,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tarWriter, file.content, file.size); err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// writeDirectories writes entries for directory and its parents which are not
+// in written yet.
+func writeDirectories(tarWriter *tar.Writer, directory string, written map[string]bool) error {
+	if written[directory] {
+		return nil
+	}
+	if err := writeDirectories(tarWriter, path.Dir(directory), written); err != nil {
+		return err
+	}
+	written[directory] = true
+	return tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     directory + "/",
+		Mode:     0755,
+	})
+}
+
+// writeJobFiles copies the source code, the scripts and the files of request
+// into the working directory of a sandbox.
+func writeJobFiles(ctx context.Context, runtime Runtime, sandboxID string, request *job.JobRequest, blobs BlobStore) error {
+	err, blobFiles := openBlobFiles(blobs, request)
+	if err != nil {
+		return err
+	}
+	defer closeFiles(blobFiles)
+
+	var files []streamedFile
+	for _, file := range []TextFile{
+		{request.SourceCodeFileName, request.SourceCode, 0644},
+		{setupScriptFileName, request.SetupScript, 0644},
+		{compileScriptFileName, request.CompileScript, 0644},
+		{runScriptFileName, request.RunScript, 0644},
+	} {
+		files = append(files, streamedFile{file.Name, file.Mode, int64(len(file.Content)), io.NopCloser(strings.NewReader(file.Content))})
+	}
+	return writeStreamedFiles(ctx, runtime, sandboxID, append(files, blobFiles...))
+}
+
+// openBlobFiles opens the blobs of the files of request, they are closed with
+// closeFiles.
+func openBlobFiles(blobs BlobStore, request *job.JobRequest) (error, []streamedFile) {
+	var files []streamedFile
+	for _, file := range request.Files {
+		if blobs == nil {
+			return errNoBlobStore, nil
+		}
+		err, content, size := blobs.Open(file.Blob)
+		if err != nil {
+			closeFiles(files)
+			return fmt.Errorf("blob %s of file %s: %w", file.Blob, file.Name, err), nil
+		}
+		mode := int64(0644)
+		if file.Executable {
+			mode = 0755
+		}
+		files = append(files, streamedFile{file.Name, mode, size, content})
+	}
+	return nil, files
+}
+
+func closeFiles(files []streamedFile) {
+	for _, file := range files {
+		file.content.Close()
+	}
+}
@@ -0,0 +1,133 @@
+package native
+
+import (
+	"bufio"
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroup is the cgroup v2 directory of a single sandbox.
+type cgroup struct {
+	path string
+	file *os.File
+}
+
+func isCgroup2(path string) bool {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return false
+	}
+	return statfs.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// enableControllers makes the memory and pids controllers available to the
+// cgroups created below root.
+func enableControllers(root string) error {
+	return os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+memory +pids"), 0644)
+}
+
+func newCgroup(root, name string, memoryLimit int64, maxProcesses int) (error, *cgroup) {
+	path := filepath.Join(root, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return err, nil
+	}
+
+	settings := map[string]string{}
+	if memoryLimit > 0 {
+		settings["memory.max"] = strconv.FormatInt(memoryLimit, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if maxProcesses > 0 {
+		settings["pids.max"] = strconv.Itoa(maxProcesses)
+	}
+	for file, value := range settings {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil {
+			os.Remove(path)
+			return err, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		os.Remove(path)
+		return err, nil
+	}
+
+	return nil, &cgroup{
+		path: path,
+		file: file,
+	}
+}
+
+func (c *cgroup) oomKilled() bool {
+	file, err := os.Open(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// remove kills whatever is left in the cgroup and deletes it.
+func (c *cgroup) remove() error {
+	c.file.Close()
+	if err := c.kill(); err != nil {
+		return err
+	}
+
+	// Removal fails with EBUSY until the killed processes are gone
+	var err error
+	for range 50 {
+		err = os.Remove(c.path)
+		if !errors.Is(err, unix.EBUSY) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// kill kills every process of the cgroup, including those which left the
+// process group of the job.
+func (c *cgroup) kill() error {
+	err := os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0644)
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// cgroup.kill exists since Linux 5.14, older kernels need the processes
+	// killed one by one. Those forked meanwhile are found by the next round.
+	for range 50 {
+		content, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+		if err != nil {
+			return err
+		}
+		pids := strings.Fields(string(content))
+		if len(pids) == 0 {
+			return nil
+		}
+		for _, pid := range pids {
+			if pid, err := strconv.Atoi(pid); err == nil {
+				unix.Kill(pid, unix.SIGKILL)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("processes keep running after being killed")
+}
@@ -0,0 +1,97 @@
+package native
+
+import (
+	"flag"
+	"fmt"
+	"github.com/docker/docker/pkg/reexec"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// initName is the argv[0] under which the engine binary re-executes itself
+// to isolate the file system and apply resource limits before running a job
+// command. Go cannot do either between fork and exec, so this small
+// trampoline does it instead.
+const initName = "execution-engine-native-init"
+
+func init() {
+	reexec.Register(initName, nativeInit)
+}
+
+// rootArguments make the trampoline enter a root file system built on root,
+// see enterRoot.
+func rootArguments(root, workspace string) []string {
+	return []string{
+		"-root=" + root,
+		"-workspace=" + workspace,
+	}
+}
+
+func limitArguments(cpuSeconds, addressSpace, fileSize int64, processes int) []string {
+	return []string{
+		fmt.Sprintf("-cpu=%d", cpuSeconds),
+		fmt.Sprintf("-as=%d", addressSpace),
+		fmt.Sprintf("-fsize=%d", fileSize),
+		fmt.Sprintf("-nproc=%d", processes),
+		"--",
+	}
+}
+
+func nativeInit() {
+	flags := flag.NewFlagSet(initName, flag.ExitOnError)
+	cpuSeconds := flags.Uint64("cpu", 0, "")
+	addressSpace := flags.Uint64("as", 0, "")
+	fileSize := flags.Uint64("fsize", 0, "")
+	processes := flags.Uint64("nproc", 0, "")
+	root := flags.String("root", "", "")
+	workspace := flags.String("workspace", "", "")
+	flags.Parse(os.Args[1:])
+
+	if *root != "" {
+		if err := enterRoot(*root, *workspace); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot isolate the file system: %s\n", err)
+			os.Exit(126)
+		}
+		if err := dropCapabilities(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot drop capabilities: %s\n", err)
+			os.Exit(126)
+		}
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, *cpuSeconds},
+		{unix.RLIMIT_AS, *addressSpace},
+		{unix.RLIMIT_FSIZE, *fileSize},
+		{unix.RLIMIT_NPROC, *processes},
+		{unix.RLIMIT_CORE, 0},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 && limit.resource != unix.RLIMIT_CORE {
+			continue
+		}
+		rlimit := &unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Setrlimit(limit.resource, rlimit); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot set resource limit %d: %s\n", limit.resource, err)
+			os.Exit(126)
+		}
+	}
+
+	command := flags.Args()
+	if len(command) == 0 {
+		fmt.Fprintln(os.Stderr, "no command given")
+		os.Exit(126)
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(127)
+	}
+	err = syscall.Exec(path, command, os.Environ())
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(126)
+}
@@ -0,0 +1,27 @@
+package native
+
+import (
+	"time"
+)
+
+type Options struct {
+	// WorkDirectory holds one temporary directory per sandbox
+	WorkDirectory string
+	// Namespaces isolates jobs in new user, PID, mount, IPC, UTS and network
+	// namespaces, with a root file system showing the host directories
+	// read-only. NewRuntime fails when the kernel does not allow it.
+	Namespaces bool
+	// CgroupRoot is a delegated cgroup v2 directory under which one cgroup per
+	// sandbox is created, empty disables cgroups. Jobs run without namespaces
+	// need cgroups.
+	CgroupRoot string
+	// UID and GID jobs are run as, -1 keeps the identity of the engine, which
+	// is refused when the engine runs as root
+	UID int
+	GID int
+	// Limits applied to every process, zero means unlimited. The address
+	// space is limited by the memory limit of the sandbox.
+	CPUTime      time.Duration
+	MaxFileSize  int64
+	MaxProcesses int
+}
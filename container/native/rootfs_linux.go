@@ -0,0 +1,188 @@
+package native
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+)
+
+// rootDirectoryName is the directory of the work directory on which each job
+// mounts its root file system. Every job has its own mount namespace, so they
+// all use the same mount point.
+const rootDirectoryName = "rootfs"
+
+// hostDirectories are bound read-only into the root file system of jobs so
+// they can use the tools installed on the host.
+var hostDirectories = []string{"/bin", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/opt", "/sbin", "/usr"}
+
+var hostDevices = []string{"/dev/full", "/dev/null", "/dev/random", "/dev/urandom", "/dev/zero"}
+
+// enterRoot builds a root file system on a tmpfs mounted on root and pivots
+// into it. Jobs see the host directories read-only, their workspace under its
+// host path and private /tmp, /dev and /proc. It must run inside new user,
+// mount and PID namespaces.
+func enterRoot(root, workspace string) error {
+	// Nothing mounted here may propagate to the host
+	if err := mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	if err := mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return err
+	}
+
+	for _, directory := range hostDirectories {
+		info, err := os.Lstat(directory)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Merged /usr layouts link /bin and others into /usr
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(directory)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, filepath.Join(root, directory)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := bindMount(directory, filepath.Join(root, directory), true); err != nil {
+			return err
+		}
+	}
+
+	filesystems := []struct {
+		target string
+		fstype string
+		flags  uintptr
+		data   string
+	}{
+		{"/tmp", "tmpfs", unix.MS_NOSUID | unix.MS_NODEV, "mode=1777"},
+		{"/dev", "tmpfs", unix.MS_NOSUID | unix.MS_NOEXEC, "mode=0755"},
+		{"/dev/shm", "tmpfs", unix.MS_NOSUID | unix.MS_NODEV, "mode=1777"},
+		{"/proc", "proc", unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC, ""},
+	}
+	for _, filesystem := range filesystems {
+		target := filepath.Join(root, filesystem.target)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := mount(filesystem.fstype, target, filesystem.fstype, filesystem.flags, filesystem.data); err != nil {
+			return err
+		}
+	}
+	// After /tmp, which usually holds the workspace
+	if err := bindMount(workspace, filepath.Join(root, workspace), false); err != nil {
+		return err
+	}
+	for _, device := range hostDevices {
+		if err := bindMount(device, filepath.Join(root, device), false); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"} {
+		if err := os.Symlink(target, filepath.Join(root, "dev", name)); err != nil {
+			return err
+		}
+	}
+
+	// Stacks the new root on the old one, which is then detached
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return err
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount the root read-only: %w", err)
+	}
+	return unix.Chdir(workspace)
+}
+
+func mount(source, target, fstype string, flags uintptr, data string) error {
+	if err := unix.Mount(source, target, fstype, flags, data); err != nil {
+		return fmt.Errorf("mount %s on %s: %w", source, target, err)
+	}
+	return nil
+}
+
+// bindMount mounts source on target, which is created first. Mount flags of
+// the source such as nosuid are kept, the kernel refuses to clear them in a
+// user namespace.
+func bindMount(source, target string, readOnly bool) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if err := mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	if !readOnly {
+		return nil
+	}
+
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(source, &statfs); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY | unix.MS_NOSUID)
+	for statfsFlag, mountFlag := range map[int64]uintptr{
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if statfs.Flags&statfsFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+	return mount("", target, "", flags, "")
+}
+
+// dropCapabilities leaves the job without the capabilities it holds as root
+// of its user namespace, so it cannot undo its mounts.
+func dropCapabilities() error {
+	for capability := 0; ; capability++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			// Past the last capability of the kernel
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return err
+	}
+
+	// Permitted capabilities are recomputed from the bounding and inheritable
+	// sets on exec
+	header := &unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(header, &data[0]); err != nil {
+		return err
+	}
+	data[0].Inheritable, data[1].Inheritable = 0, 0
+	if err := unix.Capset(header, &data[0]); err != nil {
+		return err
+	}
+	return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+}
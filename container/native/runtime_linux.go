@@ -0,0 +1,490 @@
+package native
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/log"
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/pkg/reexec"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// waitDelay bounds how long output pipes held open by orphaned processes can
+// delay the end of an execution.
+const waitDelay = 250 * time.Millisecond
+
+const nativeImageID = "native"
+
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+type sandbox struct {
+	directory     string
+	memoryLimit   int64
+	networkAccess bool
+	cgroup        *cgroup
+	running       bool
+	processes     map[*os.Process]struct{}
+}
+
+type nativeRuntime struct {
+	options    Options
+	namespaces bool
+	cgroups    bool
+	lock       sync.Mutex
+	sandboxes  map[string]*sandbox
+}
+
+// NewRuntime returns a container.Runtime running jobs as plain processes on
+// the host, each sandbox being a temporary directory. Images are ignored,
+// jobs see the tools installed on the host. The /exit.sh protocol of the
+// Docker image is not available, the exit code of the run script is used.
+func NewRuntime(options *Options) (error, container.Runtime) {
+	if os.Geteuid() == 0 && (options.UID <= 0 || options.GID <= 0) {
+		return errors.New("refusing to run jobs as root, set an unprivileged uid and gid"), nil
+	}
+	if err := os.MkdirAll(filepath.Join(options.WorkDirectory, rootDirectoryName), 0711); err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err), nil
+	}
+
+	r := &nativeRuntime{
+		options:   *options,
+		sandboxes: map[string]*sandbox{},
+	}
+
+	if options.Namespaces {
+		// Runs a command the way jobs are run, mounts included
+		arguments := append([]string{initName}, rootArguments(r.rootDirectory(), options.WorkDirectory)...)
+		probe := reexec.Command(append(append(arguments, limitArguments(0, 0, 0, 0)...), "true")...)
+		probe.Dir = options.WorkDirectory
+		probe.SysProcAttr = r.processAttributes(nil)
+		if output, err := probe.CombinedOutput(); err != nil {
+			return fmt.Errorf("linux namespaces are not available: %w: %s", err, output), nil
+		}
+		r.namespaces = true
+	} else {
+		log.L().Warn("Running jobs without namespaces, they see the file system of the host")
+	}
+
+	if options.CgroupRoot != "" {
+		if !isCgroup2(options.CgroupRoot) {
+			log.L().Warn("Cgroup root is not a cgroup v2 hierarchy, running jobs without cgroups", zap.String("cgroupRoot", options.CgroupRoot))
+		} else if err := enableControllers(options.CgroupRoot); err != nil {
+			log.L().Warn("Cannot enable cgroup controllers, running jobs without cgroups", zap.Error(err))
+		} else {
+			r.cgroups = true
+		}
+	}
+	// Processes calling setsid leave the process group of the job, only the
+	// PID namespace or the cgroup of the sandbox still holds them
+	if !r.namespaces && !r.cgroups {
+		return errors.New("jobs run without namespaces need cgroups, set a cgroup root"), nil
+	}
+
+	return nil, r
+}
+
+func (r *nativeRuntime) Create(ctx context.Context, spec *container.SandboxSpec) (error, string) {
+	directory, err := os.MkdirTemp(r.options.WorkDirectory, "sandbox-")
+	if err != nil {
+		return err, ""
+	}
+	if err := r.chown(directory); err != nil {
+		os.RemoveAll(directory)
+		return err, ""
+	}
+	sandboxID := filepath.Base(directory)
+
+	s := &sandbox{
+		directory:     directory,
+		memoryLimit:   spec.MemoryLimit,
+		networkAccess: spec.NetworkAccess,
+		processes:     map[*os.Process]struct{}{},
+	}
+	if r.cgroups {
+		err, s.cgroup = newCgroup(r.options.CgroupRoot, sandboxID, spec.MemoryLimit, r.options.MaxProcesses)
+		if err != nil {
+			os.RemoveAll(directory)
+			return fmt.Errorf("failed to create cgroup: %w", err), ""
+		}
+	}
+
+	r.lock.Lock()
+	r.sandboxes[sandboxID] = s
+	r.lock.Unlock()
+
+	return nil, sandboxID
+}
+
+func (r *nativeRuntime) Start(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+	s.running = true
+
+	return nil
+}
+
+func (r *nativeRuntime) CopyTo(ctx context.Context, sandboxID, directory string, archive io.Reader) error {
+	r.lock.Lock()
+	err, s := r.sandbox(sandboxID)
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err, target := resolve(s.directory, directory)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err, path := resolve(target, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, os.FileMode(header.Mode).Perm())
+		case tar.TypeReg:
+			err = writeFile(path, tarReader, os.FileMode(header.Mode).Perm())
+		default:
+			err = fmt.Errorf("unsupported archive entry %s", header.Name)
+		}
+		if err == nil {
+			err = r.chown(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CopyFrom archives directories and regular files, other entries such as
+// symbolic links are skipped.
+func (r *nativeRuntime) CopyFrom(ctx context.Context, sandboxID, name string) (error, io.ReadCloser) {
+	r.lock.Lock()
+	err, s := r.sandbox(sandboxID)
+	r.lock.Unlock()
+	if err != nil {
+		return err, nil
+	}
+
+	err, source := resolve(s.directory, name)
+	if err != nil {
+		return err, nil
+	}
+	if _, err := os.Stat(source); err != nil {
+		return err, nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeArchive(ctx, source, writer))
+	}()
+	return nil, reader
+}
+
+func (r *nativeRuntime) Exec(ctx context.Context, sandboxID string, options *container.ExecOptions) (error, *container.ExecResult) {
+	r.lock.Lock()
+	err, s := r.sandbox(sandboxID)
+	if err == nil && !s.running {
+		err = fmt.Errorf("sandbox %s is not running", sandboxID)
+	}
+	r.lock.Unlock()
+	if err != nil {
+		return err, nil
+	}
+
+	arguments := []string{initName}
+	if r.namespaces {
+		arguments = append(arguments, rootArguments(r.rootDirectory(), s.directory)...)
+	}
+	arguments = append(arguments, limitArguments(
+		int64(r.options.CPUTime.Seconds()),
+		s.memoryLimit,
+		r.options.MaxFileSize,
+		r.options.MaxProcesses,
+	)...)
+	command := reexec.Command(append(arguments, options.Command...)...)
+	command.Dir = s.directory
+	command.Env = append([]string{defaultPath, "HOME=" + s.directory}, options.EnvironmentVariables...)
+	command.Stdin = options.Stdin
+	command.Stdout = options.Stdout
+	command.Stderr = options.Stderr
+	command.SysProcAttr = r.processAttributes(s)
+	command.WaitDelay = waitDelay
+
+	if err := command.Start(); err != nil {
+		return err, nil
+	}
+	r.lock.Lock()
+	s.processes[command.Process] = struct{}{}
+	r.lock.Unlock()
+	defer func() {
+		// Nothing started by the command may outlive it
+		s.kill(command.Process)
+		r.lock.Lock()
+		delete(s.processes, command.Process)
+		r.lock.Unlock()
+	}()
+
+	waitErrorChannel := make(chan error, 1)
+	go func() {
+		waitErrorChannel <- command.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.kill(command.Process)
+		<-waitErrorChannel
+		return ctx.Err(), nil
+	case err := <-waitErrorChannel:
+		var exitError *exec.ExitError
+		if err != nil && !errors.As(err, &exitError) && !errors.Is(err, exec.ErrWaitDelay) {
+			return err, nil
+		}
+		// Includes the descendants the command waited for. With namespaces
+		// the command reaps every orphan as the init of its PID namespace.
+		return nil, &container.ExecResult{
+			ExitCode: exitCode(command.ProcessState),
+			CPUTime:  command.ProcessState.UserTime() + command.ProcessState.SystemTime(),
+		}
+	}
+}
+
+func (r *nativeRuntime) Inspect(ctx context.Context, sandboxID string) (error, *container.SandboxState) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err, nil
+	}
+
+	state := &container.SandboxState{
+		Running: s.running,
+	}
+	if s.cgroup != nil && s.cgroup.oomKilled() {
+		state.OOMKilled = true
+		state.ExitCode = 137
+	}
+	return nil, state
+}
+
+func (r *nativeRuntime) Kill(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err, s := r.sandbox(sandboxID)
+	if err != nil {
+		return err
+	}
+	for process := range s.processes {
+		s.kill(process)
+	}
+	s.running = false
+
+	return nil
+}
+
+func (r *nativeRuntime) Remove(ctx context.Context, sandboxID string) error {
+	if err := r.Kill(ctx, sandboxID); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	s := r.sandboxes[sandboxID]
+	delete(r.sandboxes, sandboxID)
+	r.lock.Unlock()
+
+	var cgroupError error
+	if s.cgroup != nil {
+		cgroupError = s.cgroup.remove()
+	}
+	return errors.Join(os.RemoveAll(s.directory), cgroupError)
+}
+
+// ImageID is constant since jobs use whatever is installed on the host.
+func (r *nativeRuntime) ImageID(ctx context.Context, image string) (error, string) {
+	return nil, nativeImageID
+}
+
+// sandbox must be called with lock held.
+func (r *nativeRuntime) sandbox(sandboxID string) (error, *sandbox) {
+	s, ok := r.sandboxes[sandboxID]
+	if !ok {
+		return fmt.Errorf("no such sandbox: %s", sandboxID), nil
+	}
+	return nil, s
+}
+
+// processAttributes isolates a job process. The sandbox may be nil when
+// probing for namespace support.
+func (r *nativeRuntime) processAttributes(s *sandbox) *syscall.SysProcAttr {
+	attributes := &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	uid, gid := r.options.UID, r.options.GID
+	if uid < 0 {
+		uid = os.Getuid()
+	}
+	if gid < 0 {
+		gid = os.Getgid()
+	}
+	if r.namespaces || s == nil {
+		// The job is root inside its user namespace only
+		attributes.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if s == nil || !s.networkAccess {
+			attributes.Cloneflags |= syscall.CLONE_NEWNET
+		}
+		attributes.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+		attributes.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+		// Without switching, the process keeps the identity of the engine,
+		// unmapped in the namespace
+		attributes.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}
+	} else if uid != os.Getuid() || gid != os.Getgid() {
+		attributes.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+
+	if s != nil && s.cgroup != nil {
+		attributes.UseCgroupFD = true
+		attributes.CgroupFD = int(s.cgroup.file.Fd())
+	}
+	return attributes
+}
+
+func (r *nativeRuntime) rootDirectory() string {
+	return filepath.Join(r.options.WorkDirectory, rootDirectoryName)
+}
+
+// chown hands a sandbox path over to the user jobs are run as.
+func (r *nativeRuntime) chown(path string) error {
+	if r.options.UID < 0 && r.options.GID < 0 {
+		return nil
+	}
+	return os.Lchown(path, r.options.UID, r.options.GID)
+}
+
+// resolve joins a relative path to root, refusing paths escaping it.
+func resolve(root, name string) (error, string) {
+	path := filepath.Join(root, name)
+	if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return fmt.Errorf("path %s escapes the sandbox", name), ""
+	}
+	return nil, path
+}
+
+func writeFile(path string, content io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeArchive(ctx context.Context, source string, archive io.Writer) error {
+	tarWriter := tar.NewWriter(archive)
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if path == source && entry.IsDir() || !(entry.IsDir() || entry.Type().IsRegular()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		// A file archived alone is named after itself
+		name := entry.Name()
+		if path != source {
+			if name, err = filepath.Rel(source, path); err != nil {
+				return err
+			}
+		}
+		header.Name = filepath.ToSlash(name)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+// kill kills process and everything it started. With namespaces the job is
+// the init of its PID namespace, which takes every other process down with
+// it.
+func (s *sandbox) kill(process *os.Process) {
+	syscall.Kill(-process.Pid, syscall.SIGKILL)
+	if s.cgroup != nil {
+		if err := s.cgroup.kill(); err != nil {
+			log.L().Warn("Failed to kill the processes of a sandbox", zap.String("cgroup", s.cgroup.path), zap.Error(err))
+		}
+	}
+}
+
+// exitCode follows the shell convention of 128 + signal for killed processes.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,241 @@
+package native
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/proto/job"
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/docker/docker/pkg/reexec"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Job processes are started through the test binary itself
+	if reexec.Init() {
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func newTestRuntime(t *testing.T, namespaces bool) container.Runtime {
+	t.Helper()
+
+	if !namespaces {
+		t.Skip("jobs run without namespaces need a cgroup root")
+	}
+	options := &Options{
+		WorkDirectory: t.TempDir(),
+		Namespaces:    namespaces,
+		UID:           -1,
+		GID:           -1,
+		MaxFileSize:   1 << 20,
+	}
+	if os.Geteuid() == 0 {
+		// Jobs are run as nobody, who must reach the work directory
+		options.UID, options.GID = 65534, 65534
+		if err := os.Chmod(filepath.Dir(options.WorkDirectory), 0711); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err, runtime := NewRuntime(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime
+}
+
+func TestNewRuntimeRefusesRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("the engine does not run as root")
+	}
+	if err, _ := NewRuntime(&Options{WorkDirectory: t.TempDir(), Namespaces: true, UID: -1, GID: -1}); err == nil {
+		t.Error("jobs would run as root")
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		runScript   string
+		timeLimit   int64
+		status      string
+		runExitCode int32
+		runStdout   string
+	}{
+		{"stdout and stdin", "cat main.txt; cat", 5000, container.StatusFinished, 0, "source\ninput"},
+		{"exit code", "exit 7", 5000, container.StatusFinished, 7, ""},
+		{"environment", "echo -n $GREETING", 5000, container.StatusFinished, 0, "hello"},
+		{"working directory", "echo -n $(basename $PWD)", 5000, container.StatusFinished, 0, ""},
+		{"time limit", "sleep 5", 100, container.StatusTimeLimitExceeded, -1, ""},
+		{"file size limit", "head -c 2000000 /dev/zero > big", 5000, container.StatusFinished, 128 + 25, ""},
+	}
+
+	for _, namespaces := range []bool{false, true} {
+		t.Run(fmt.Sprintf("namespaces %t", namespaces), func(t *testing.T) {
+			runtime := newTestRuntime(t, namespaces)
+			for _, test := range tests {
+				err, response := container.Run(context.Background(), runtime, "", &job.JobRequest{
+					SourceCodeFileName:   "main.txt",
+					SourceCode:           "source\n",
+					RunScript:            test.runScript,
+					Stdin:                "input",
+					EnvironmentVariables: []string{"GREETING=hello"},
+					ResourceLimits:       &job.ResourceLimits{MaxExecutionTime: test.timeLimit},
+				}, nil, nil)
+				if err != nil {
+					t.Fatalf("%s: Run returned error: %v", test.name, err)
+				}
+				if response.Status != test.status {
+					t.Errorf("%s: status = %q, want %q (stderr %q)", test.name, response.Status, test.status, response.RunStderr)
+				}
+				if response.RunExitCode != test.runExitCode {
+					t.Errorf("%s: run exit code = %d, want %d (stderr %q)", test.name, response.RunExitCode, test.runExitCode, response.RunStderr)
+				}
+				if test.name == "working directory" {
+					if !strings.HasPrefix(response.RunStdout, "sandbox-") {
+						t.Errorf("%s: working directory = %q, want the sandbox directory", test.name, response.RunStdout)
+					}
+				} else if response.RunStdout != test.runStdout {
+					t.Errorf("%s: run stdout = %q, want %q", test.name, response.RunStdout, test.runStdout)
+				}
+			}
+		})
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	runtime := newTestRuntime(t, true)
+	script := `touch /etc/x /usr/x 2>/dev/null && echo host writable
+test -e /root && echo host visible
+setsid sleep 4242 &
+touch /tmp/x main.txt && echo -n private`
+
+	err, response := container.Run(context.Background(), runtime, "", &job.JobRequest{
+		SourceCodeFileName: "main.txt",
+		RunScript:          script,
+		ResourceLimits:     &job.ResourceLimits{MaxExecutionTime: 5000},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RunStdout != "private" {
+		t.Errorf("run stdout = %q, stderr %q, want only the private directories writable", response.RunStdout, response.RunStderr)
+	}
+
+	// The process left the process group of the job, it dies with the job
+	// nonetheless
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if !running("sleep\x004242\x00") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("a process started by the job outlived it")
+		}
+	}
+}
+
+func running(commandLine string) bool {
+	entries, _ := os.ReadDir("/proc")
+	for _, entry := range entries {
+		content, _ := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if string(content) == commandLine {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRemoveDeletesDirectory(t *testing.T) {
+	runtime := newTestRuntime(t, true).(*nativeRuntime)
+
+	err, sandboxID := runtime.Create(context.Background(), &container.SandboxSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := runtime.sandboxes[sandboxID].directory
+	if err := runtime.Remove(context.Background(), sandboxID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(directory); !os.IsNotExist(err) {
+		t.Errorf("sandbox directory still exists: %v", err)
+	}
+}
+
+func TestCopyFromRestoresWorkspace(t *testing.T) {
+	runtime := newTestRuntime(t, true)
+	ctx := context.Background()
+
+	sandboxes := make([]string, 2)
+	for i := range sandboxes {
+		err, sandboxID := runtime.Create(ctx, &container.SandboxSpec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer runtime.Remove(ctx, sandboxID)
+		if err := runtime.Start(ctx, sandboxID); err != nil {
+			t.Fatal(err)
+		}
+		sandboxes[i] = sandboxID
+	}
+
+	err := container.WriteTextFiles(ctx, runtime, sandboxes[0], []container.TextFile{
+		{Name: "build.sh", Content: "mkdir -p out && echo built > out/binary && ln -s out/binary link", Mode: 0644},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, result := container.ExecuteScript(ctx, runtime, sandboxes[0], "build.sh", nil, nil)
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("build failed: %v, %s", err, result.Stderr)
+	}
+
+	err, archive := runtime.CopyFrom(ctx, sandboxes[0], ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runtime.CopyTo(ctx, sandboxes[1], ".", archive)
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := runtime.(*nativeRuntime).sandboxes[sandboxes[1]].directory
+	content, err := os.ReadFile(filepath.Join(directory, "out", "binary"))
+	if err != nil || string(content) != "built\n" {
+		t.Errorf("restored file = %q, %v", content, err)
+	}
+	if _, err := os.Lstat(filepath.Join(directory, "link")); !os.IsNotExist(err) {
+		t.Errorf("symbolic link was copied: %v", err)
+	}
+
+	err, archive = runtime.CopyFrom(ctx, sandboxes[0], "out/binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	tarReader := tar.NewReader(archive)
+	header, err := tarReader.Next()
+	if err != nil || header.Name != "binary" || header.Size != int64(len("built\n")) {
+		t.Errorf("file archive entry = %+v, %v, want binary", header, err)
+	}
+	if _, err := tarReader.Next(); err != io.EOF {
+		t.Errorf("file archive has more entries: %v", err)
+	}
+}
+
+func TestResolveRejectsEscapingPaths(t *testing.T) {
+	for _, name := range []string{"../evil", "a/../../evil", "/../evil"} {
+		if err, _ := resolve("/tmp/sandbox", name); err == nil {
+			t.Errorf("resolve(%q) succeeded, want an error", name)
+		}
+	}
+	if err, path := resolve("/tmp/sandbox", "dir/file"); err != nil || path != "/tmp/sandbox/dir/file" {
+		t.Errorf("resolve(dir/file) = %v, %q", err, path)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package native
+
+import (
+	"ExecutionEngine/container"
+	"errors"
+)
+
+func NewRuntime(options *Options) (error, container.Runtime) {
+	return errors.New("the native runtime is only available on Linux"), nil
+}
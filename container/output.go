@@ -0,0 +1,35 @@
+package container
+
+import (
+	"context"
+)
+
+// OutputFunc receives the output of the scripts of a job while they run. The
+// chunk is only valid during the call.
+type OutputFunc func(phase, stream string, chunk []byte)
+
+type outputKey struct{}
+
+// WithOutputFunc returns a copy of ctx whose jobs pass their output to output
+// as it is produced.
+func WithOutputFunc(ctx context.Context, output OutputFunc) context.Context {
+	return context.WithValue(ctx, outputKey{}, output)
+}
+
+func outputFuncFromContext(ctx context.Context) OutputFunc {
+	output, _ := ctx.Value(outputKey{}).(OutputFunc)
+	return output
+}
+
+type outputWriter struct {
+	output OutputFunc
+	phase  string
+	stream string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.output(w.phase, w.stream, p)
+	}
+	return len(p), nil
+}
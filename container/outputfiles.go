@@ -0,0 +1,120 @@
+package container
+
+import (
+	"ExecutionEngine/proto/job"
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxListingSize bounds the names of the files of a workspace read to match
+// them against the output file patterns.
+const maxListingSize = 1 << 20
+
+// collectOutputFiles returns the regular files of the working directory of a
+// sandbox matching any of patterns, in the syntax of path.Match. Only the
+// matching files are copied out of the sandbox, and only their first maxSize
+// bytes overall, the content of the remaining files is cut. On error the
+// files collected so far are returned along with it.
+func collectOutputFiles(ctx context.Context, runtime Runtime, sandboxID string, patterns []string, maxSize int64) (error, []*job.OutputFile) {
+	err, names := listFiles(ctx, runtime, sandboxID)
+	if err != nil {
+		return err, nil
+	}
+
+	var files []*job.OutputFile
+	remaining := maxSize
+	for _, name := range names {
+		if !matchesAny(patterns, name) {
+			continue
+		}
+		err, file := copyOutputFile(ctx, runtime, sandboxID, name, max(remaining, 0))
+		if err != nil {
+			return err, files
+		}
+		if file == nil {
+			// Replaced by something else than a regular file since listed
+			continue
+		}
+		remaining -= int64(len(file.Content))
+		files = append(files, file)
+	}
+	return nil, files
+}
+
+// listFiles returns the sorted names of the regular files of the working
+// directory of a sandbox. Names past maxListingSize bytes are left out.
+func listFiles(ctx context.Context, runtime Runtime, sandboxID string) (error, []string) {
+	var stdout, stderr bytes.Buffer
+	listing := &limitedWriter{writer: &stdout, remaining: maxListingSize}
+	err, result := runtime.Exec(ctx, sandboxID, &ExecOptions{
+		Command: []string{"find", ".", "-type", "f", "-print0"},
+		Stdout:  listing,
+		Stderr:  &limitedWriter{writer: &stderr, remaining: 1024},
+	})
+	if err != nil {
+		return err, nil
+	}
+	// find fails on unreadable directories, but still lists the others
+	if result.ExitCode != 0 && stdout.Len() == 0 {
+		return fmt.Errorf("list the files of the sandbox: exit code %d: %s", result.ExitCode, strings.TrimSpace(stderr.String())), nil
+	}
+
+	entries := strings.Split(stdout.String(), "\x00")
+	// The last entry is empty or was cut by the limit
+	entries = entries[:len(entries)-1]
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, path.Clean(entry))
+	}
+	sort.Strings(names)
+	return nil, names
+}
+
+// copyOutputFile copies the first maxSize bytes of the file name out of a
+// sandbox. It returns no file when name is not a regular file.
+func copyOutputFile(ctx context.Context, runtime Runtime, sandboxID, name string, maxSize int64) (error, *job.OutputFile) {
+	err, archive := runtime.CopyFrom(ctx, sandboxID, name)
+	if err != nil {
+		return err, nil
+	}
+	defer archive.Close()
+
+	tarReader := tar.NewReader(archive)
+	header, err := tarReader.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return err, nil
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil, nil
+	}
+
+	content, err := io.ReadAll(io.LimitReader(tarReader, maxSize))
+	if err != nil {
+		return err, nil
+	}
+	return nil, &job.OutputFile{
+		Name:      name,
+		Content:   content,
+		Size:      header.Size,
+		Truncated: int64(len(content)) < header.Size,
+	}
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
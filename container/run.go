@@ -3,195 +3,304 @@ package container
 import (
 	"ExecutionEngine/log"
 	"ExecutionEngine/proto/job"
+	"ExecutionEngine/tracing"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-func Run(ctx context.Context, cli *client.Client, image string, request *job.JobRequest) (error, *job.JobResponse) {
-	log.L().Debug("Creating Docker container", zap.String("request", request.String()))
-	err, containerID := CreateContainer(ctx, cli, image, request.EnvironmentVariables, "")
+var tracer = otel.Tracer("ExecutionEngine/container")
+
+// Run executes a job in a new sandbox. artifacts is optional, without it
+// every job runs its setup and compile scripts. blobs is only needed by
+// requests referring to blobs.
+func Run(ctx context.Context, runtime Runtime, image string, request *job.JobRequest, artifacts ArtifactCache, blobs BlobStore) (error, *job.JobResponse) {
+	log.FromContext(ctx).Debug("Creating sandbox", zap.String("request", request.String()))
+	prepareStartTime := time.Now()
+	prepareContext, prepareSpan := tracer.Start(ctx, PhasePrepare)
+	err, sandboxID := runtime.Create(prepareContext, &SandboxSpec{
+		Image:         image,
+		MemoryLimit:   request.GetResourceLimits().GetMaxMemory(),
+		NetworkAccess: request.NetworkAccess,
+	})
 	if err != nil {
-		return err, nil
+		tracing.EndSpan(prepareSpan, err)
+		return runtimeError(ctx, "create sandbox", err), nil
 	}
+	prepareSpan.SetAttributes(attribute.String("sandbox_id", sandboxID))
+	// Everything logged from here on is about this sandbox
+	ctx = log.With(ctx, zap.String("containerID", sandboxID))
+	prepareContext = log.WithContext(prepareContext, log.FromContext(ctx))
+	defer func() {
+		// The job context may already be cancelled, cleanup must happen anyway
+		if err := runtime.Remove(context.WithoutCancel(ctx), sandboxID); err != nil {
+			log.FromContext(ctx).Warn("Cannot remove sandbox", zap.Error(err))
+		}
+	}()
 
-	log.L().Debug("Starting Docker container", zap.String("containerID", containerID))
-	if err := StartContainer(ctx, cli, containerID); err != nil {
-		return err, nil
+	log.FromContext(ctx).Debug("Starting sandbox")
+	if err := runtime.Start(prepareContext, sandboxID); err != nil {
+		tracing.EndSpan(prepareSpan, err)
+		return runtimeError(ctx, "start sandbox", err), nil
 	}
 
-	log.L().Debug("Copying source code to container", zap.String("containerID", containerID))
-	if err := WriteTextToContainer(ctx, cli, containerID, containerWorkingDirectory, request.SourceCodeFileName, request.SourceCode, 0644); err != nil {
-		return err, nil
+	// The restored workspace holds the scripts of an earlier job, they are
+	// overwritten by the files of this one.
+	restored, artifactKey := false, ""
+	if artifacts != nil {
+		restored, artifactKey = restoreArtifact(prepareContext, runtime, artifacts, sandboxID, image, request)
 	}
+	prepareSpan.SetAttributes(attribute.Bool("compile_cached", restored))
 
-	// Write scripts to the container
-	log.L().Debug("Copying setup script to container", zap.String("containerID", containerID))
-	if err := WriteTextToContainer(ctx, cli, containerID, containerWorkingDirectory, setupScriptFileName, request.SetupScript, 0644); err != nil {
-		return err, nil
-	}
-	log.L().Debug("Copying compile script to container", zap.String("containerID", containerID))
-	if err := WriteTextToContainer(ctx, cli, containerID, containerWorkingDirectory, compileScriptFileName, request.CompileScript, 0644); err != nil {
-		return err, nil
-	}
-	log.L().Debug("Copying run script to container", zap.String("containerID", containerID))
-	if err := WriteTextToContainer(ctx, cli, containerID, containerWorkingDirectory, runScriptFileName, request.RunScript, 0644); err != nil {
-		return err, nil
-	}
-
-	log.L().Debug("Executing setup script", zap.String("containerID", containerID))
-	err, setupScriptResult := ExecuteScriptInContainerSync(ctx, cli, containerID, setupScriptPath)
+	log.FromContext(ctx).Debug("Copying source code, scripts and files to sandbox")
+	err = writeJobFiles(prepareContext, runtime, sandboxID, request, blobs)
+	tracing.EndSpan(prepareSpan, err)
 	if err != nil {
-		return err, nil
-	}
-	log.L().Debug("Executed setup script", zap.String("containerID", containerID))
-	if setupScriptResult.ExitCode != 0 {
-		err := fmt.Errorf("setup script exited with non-zero code")
-		return err, &job.JobResponse{
-			Status:             "Internal Error",
-			ErrorString:        err.Error(),
-			SetupStdout:        setupScriptResult.Stdout.String(),
-			SetupStderr:        setupScriptResult.Stderr.String(),
-			SetupExitCode:      int32(setupScriptResult.ExitCode),
-			CompileStdout:      "",
-			CompileStderr:      "",
-			CompileExitCode:    -1,
-			RunStdout:          "",
-			RunStderr:          "",
-			RunExitCode:        -1,
-			ResourceStatistics: nil,
-		}
-	}
-
-	err, compileScriptResult := ExecuteScriptInContainerSync(ctx, cli, containerID, compileScriptPath)
-	if err != nil {
-		return err, nil
-	}
-	log.L().Debug("Executed compile script", zap.String("compileScriptResult", fmt.Sprintf("%#v", compileScriptResult)))
-	if compileScriptResult.ExitCode != 0 {
-		err := fmt.Errorf("compile script exited with non-zero code")
-		return err, &job.JobResponse{
-			Status:             "Compile Error",
-			ErrorString:        err.Error(),
-			SetupStdout:        setupScriptResult.Stdout.String(),
-			SetupStderr:        setupScriptResult.Stderr.String(),
-			SetupExitCode:      int32(setupScriptResult.ExitCode),
-			CompileStdout:      compileScriptResult.Stdout.String(),
-			CompileStderr:      compileScriptResult.Stderr.String(),
-			CompileExitCode:    int32(compileScriptResult.ExitCode),
-			RunStdout:          "",
-			RunStderr:          "",
-			RunExitCode:        -1,
-			ResourceStatistics: nil,
-		}
-	}
-
-	log.L().Debug("Executed run script", zap.String("compileScriptResult", fmt.Sprintf("%#v", compileScriptResult)))
-	cancelContext, cancel := context.WithTimeout(ctx, time.Duration(request.ResourceLimits.MaxExecutionTime)*time.Millisecond)
-	startTime := time.Now()
-	err, _, hijackedResponse := ExecuteScriptInContainerAsync(cancelContext, cli, containerID, runScriptPath)
-	if err != nil {
-		cancel()
-		return err, nil
+		return runtimeError(ctx, "copy files", err), nil
 	}
-	defer hijackedResponse.Close()
-
-	containerWaitChannel, containerErrorChannel := cli.ContainerWait(cancelContext, containerID, container.WaitConditionNotRunning)
+	prepare := NewPhaseTiming(PhasePrepare, prepareStartTime, time.Since(prepareStartTime))
 
-	// Monitor and collect data from the execution of run script
-	goroutineErrorChannel := make(chan error)
-
-	go func() {
-		_, err = io.Copy(hijackedResponse.Conn, bytes.NewReader([]byte(request.Stdin)))
+	var setupScriptResult, compileScriptResult *ScriptExecutionResult
+	if !restored {
+		log.FromContext(ctx).Debug("Executing setup script")
+		err, setupScriptResult = executeCompilePhase(ctx, PhaseSetup, runtime, sandboxID, setupScriptFileName, request)
+		if compileTimeExceeded(ctx, err) {
+			killSandbox(ctx, runtime, sandboxID)
+			return nil, newResponse(StatusSetupError, "setup script exceeded the time limit", prepare, setupScriptResult, nil, nil)
+		}
 		if err != nil {
-			goroutineErrorChannel <- err
-			cancel()
+			return runtimeError(ctx, "execute setup script", err), nil
+		}
+		log.FromContext(ctx).Debug("Executed setup script")
+		if setupScriptResult.ExitCode != 0 {
+			return nil, newResponse(StatusSetupError, "setup script exited with non-zero code", prepare, setupScriptResult, nil, nil)
+		}
+
+		err, compileScriptResult = executeCompilePhase(ctx, PhaseCompile, runtime, sandboxID, compileScriptFileName, request)
+		if compileTimeExceeded(ctx, err) {
+			killSandbox(ctx, runtime, sandboxID)
+			return nil, newResponse(StatusCompileError, "compile script exceeded the time limit", prepare, setupScriptResult, compileScriptResult, nil)
 		}
-		err := hijackedResponse.CloseWrite()
 		if err != nil {
-			goroutineErrorChannel <- err
-			cancel()
+			return runtimeError(ctx, "execute compile script", err), nil
+		}
+		log.FromContext(ctx).Debug("Executed compile script", zap.Int("exitCode", compileScriptResult.ExitCode))
+		if compileScriptResult.ExitCode != 0 {
+			return nil, newResponse(StatusCompileError, "compile script exited with non-zero code", prepare, setupScriptResult, compileScriptResult, nil)
 		}
-	}()
 
-	runScriptStdoutBuffer := &bytes.Buffer{}
-	runScriptStderrBuffer := &bytes.Buffer{}
-	go func() {
-		_, err := stdcopy.StdCopy(runScriptStdoutBuffer, runScriptStderrBuffer, hijackedResponse.Conn)
+		if artifactKey != "" {
+			storeArtifact(ctx, runtime, artifacts, sandboxID, artifactKey)
+		}
+	}
+
+	var stdin io.Reader = strings.NewReader(request.Stdin)
+	switch {
+	case len(request.StdinBytes) > 0:
+		stdin = bytes.NewReader(request.StdinBytes)
+	case request.StdinBlob != "":
+		if blobs == nil {
+			return runtimeError(ctx, "open stdin", errNoBlobStore), nil
+		}
+		err, content, _ := blobs.Open(request.StdinBlob)
 		if err != nil {
-			goroutineErrorChannel <- err
-			cancel()
+			return runtimeError(ctx, "open stdin", fmt.Errorf("blob %s: %w", request.StdinBlob, err)), nil
 		}
-	}()
+		defer content.Close()
+		stdin = content
+	}
 
-	for {
-		select {
-		case waitResponse := <-containerWaitChannel:
-			errorString := ""
-			if waitResponse.Error != nil {
-				errorString = waitResponse.Error.Message
-			}
-			return nil, &job.JobResponse{
-				Status:          "Finished",
-				ErrorString:     errorString,
-				SetupStdout:     setupScriptResult.Stdout.String(),
-				SetupStderr:     setupScriptResult.Stderr.String(),
-				SetupExitCode:   int32(setupScriptResult.ExitCode),
-				CompileStdout:   compileScriptResult.Stdout.String(),
-				CompileStderr:   compileScriptResult.Stderr.String(),
-				CompileExitCode: int32(compileScriptResult.ExitCode),
-				RunStdout:       runScriptStdoutBuffer.String(),
-				RunStderr:       runScriptStderrBuffer.String(),
-				RunExitCode:     int32(waitResponse.StatusCode),
-				ResourceStatistics: &job.ResourceStatistics{
-					ExecutionTime: time.Since(startTime).Milliseconds(),
-					MaxMemoryUsed: -1,
-				},
-			}
-		case err := <-containerErrorChannel:
-			cancel()
-			return err, &job.JobResponse{
-				Status:          "Aborted",
-				ErrorString:     err.Error(),
-				SetupStdout:     setupScriptResult.Stdout.String(),
-				SetupStderr:     setupScriptResult.Stderr.String(),
-				SetupExitCode:   int32(setupScriptResult.ExitCode),
-				CompileStdout:   compileScriptResult.Stdout.String(),
-				CompileStderr:   compileScriptResult.Stderr.String(),
-				CompileExitCode: int32(compileScriptResult.ExitCode),
-				RunStdout:       runScriptStdoutBuffer.String(),
-				RunStderr:       runScriptStderrBuffer.String(),
-				RunExitCode:     -1,
-				ResourceStatistics: &job.ResourceStatistics{
-					ExecutionTime: time.Since(startTime).Milliseconds(),
-					MaxMemoryUsed: -1,
-				},
+	runContext, cancel := context.WithTimeout(ctx, time.Duration(request.GetResourceLimits().GetMaxExecutionTime())*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	err, runScriptResult := executePhase(runContext, PhaseRun, runtime, sandboxID, runScriptFileName, request.EnvironmentVariables, stdin, request.GetResourceLimits().GetMaxOutputSize())
+	executionTime := time.Since(startTime)
+	log.FromContext(ctx).Debug("Executed run script", zap.Duration("executionTime", executionTime))
+
+	var response *job.JobResponse
+	// Output files can only be listed in a sandbox that still runs
+	sandboxRunning := false
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up, the job itself did nothing wrong
+		response = newResponse(StatusAborted, ctx.Err().Error(), prepare, setupScriptResult, compileScriptResult, runScriptResult)
+		err = ctx.Err()
+	case errors.Is(err, context.DeadlineExceeded):
+		killSandbox(ctx, runtime, sandboxID)
+		response = newResponse(StatusTimeLimitExceeded, "run script exceeded the time limit", prepare, setupScriptResult, compileScriptResult, runScriptResult)
+		err = nil
+	case err != nil:
+		err = newInfrastructureError("execute run script", err)
+		response = newResponse(StatusAborted, err.Error(), prepare, setupScriptResult, compileScriptResult, runScriptResult)
+	default:
+		// Run scripts may stop the whole sandbox through /exit.sh, in which
+		// case the exit code of the sandbox is the one that matters.
+		err, state := runtime.Inspect(ctx, sandboxID)
+		if err != nil {
+			return runtimeError(ctx, "inspect sandbox", err), nil
+		}
+		if !state.Running {
+			runScriptResult.ExitCode = state.ExitCode
+		}
+		sandboxRunning = state.Running
+		if state.OOMKilled {
+			response = newResponse(StatusMemoryLimitExceeded, "sandbox ran out of memory", prepare, setupScriptResult, compileScriptResult, runScriptResult)
+		} else {
+			response = newResponse(StatusFinished, "", prepare, setupScriptResult, compileScriptResult, runScriptResult)
+		}
+	}
+	// Files are collected even when the run script failed, they may tell why.
+	// Failing to collect them does not change the verdict.
+	if err == nil && len(request.OutputFiles) > 0 {
+		if sandboxRunning {
+			log.FromContext(ctx).Debug("Collecting output files", zap.Strings("patterns", request.OutputFiles))
+			var collectErr error
+			collectErr, response.OutputFiles = collectOutputFiles(ctx, runtime, sandboxID, request.OutputFiles, request.GetResourceLimits().GetMaxOutputFilesSize())
+			if collectErr != nil {
+				log.FromContext(ctx).Warn("Cannot collect output files", zap.Error(collectErr))
 			}
-		case err := <-goroutineErrorChannel:
-			cancel()
-			return err, &job.JobResponse{
-				Status:          "Aborted",
-				ErrorString:     err.Error(),
-				SetupStdout:     setupScriptResult.Stdout.String(),
-				SetupStderr:     setupScriptResult.Stderr.String(),
-				SetupExitCode:   int32(setupScriptResult.ExitCode),
-				CompileStdout:   compileScriptResult.Stdout.String(),
-				CompileStderr:   compileScriptResult.Stderr.String(),
-				CompileExitCode: int32(compileScriptResult.ExitCode),
-				RunStdout:       runScriptStdoutBuffer.String(),
-				RunStderr:       runScriptStderrBuffer.String(),
-				RunExitCode:     -1,
-				ResourceStatistics: &job.ResourceStatistics{
-					ExecutionTime: time.Since(startTime).Milliseconds(),
-					MaxMemoryUsed: -1,
-				},
+		} else {
+			log.FromContext(ctx).Debug("Not collecting output files of a stopped sandbox", zap.String("status", response.Status))
+		}
+	}
+	if restored {
+		response.CompileCached = true
+		response.SetupExitCode = 0
+		response.CompileExitCode = 0
+	}
+	response.ResourceStatistics = &job.ResourceStatistics{
+		ExecutionTime: executionTime.Milliseconds(),
+		MaxMemoryUsed: -1,
+		CpuTime:       -1,
+	}
+	if runScriptResult.CPUTime >= 0 {
+		response.ResourceStatistics.CpuTime = runScriptResult.CPUTime.Milliseconds()
+	}
+
+	return err, response
+}
+
+// executeCompilePhase runs the setup or the compile script within the
+// max_compile_time of request, when it has one.
+func executeCompilePhase(ctx context.Context, phase string, runtime Runtime, sandboxID, scriptFileName string, request *job.JobRequest) (error, *ScriptExecutionResult) {
+	if maxCompileTime := request.GetResourceLimits().GetMaxCompileTime(); maxCompileTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(maxCompileTime)*time.Millisecond)
+		defer cancel()
+	}
+	return executePhase(ctx, phase, runtime, sandboxID, scriptFileName, request.EnvironmentVariables, nil, request.GetResourceLimits().GetMaxOutputSize())
+}
+
+// compileTimeExceeded reports whether err comes from the time limit of a
+// setup or compile script rather than from the job context.
+func compileTimeExceeded(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded)
+}
+
+// killSandbox stops the commands still running in a sandbox abandoned on a
+// time limit.
+func killSandbox(ctx context.Context, runtime Runtime, sandboxID string) {
+	if err := runtime.Kill(context.WithoutCancel(ctx), sandboxID); err != nil {
+		log.FromContext(ctx).Warn("Cannot kill sandbox", zap.Error(err))
+	}
+}
+
+func executePhase(ctx context.Context, phase string, runtime Runtime, sandboxID, scriptFileName string, environmentVariables []string, stdin io.Reader, maxOutputSize int64) (error, *ScriptExecutionResult) {
+	ctx, span := tracer.Start(ctx, phase, trace.WithAttributes(attribute.String("sandbox_id", sandboxID)))
+	var stdout, stderr io.Writer
+	if output := outputFuncFromContext(ctx); output != nil {
+		stdout = &outputWriter{output: output, phase: phase, stream: StreamStdout}
+		stderr = &outputWriter{output: output, phase: phase, stream: StreamStderr}
+	}
+	err, result := executeScript(ctx, runtime, sandboxID, scriptFileName, environmentVariables, stdin, stdout, stderr, maxOutputSize)
+	span.SetAttributes(attribute.Int("exit_code", result.ExitCode))
+	tracing.EndSpan(span, err)
+	return err, result
+}
+
+// newResponse assembles a response from the phases that were executed, phases
+// that never ran are reported with an exit code of -1.
+func newResponse(status, errorString string, prepare *job.PhaseTiming, setup, compile, run *ScriptExecutionResult) *job.JobResponse {
+	response := &job.JobResponse{
+		Status:          status,
+		ErrorString:     errorString,
+		SetupExitCode:   -1,
+		CompileExitCode: -1,
+		RunExitCode:     -1,
+		Phases:          []*job.PhaseTiming{prepare},
+	}
+	for _, phase := range []struct {
+		name   string
+		result *ScriptExecutionResult
+	}{{PhaseSetup, setup}, {PhaseCompile, compile}, {PhaseRun, run}} {
+		if phase.result != nil {
+			response.Phases = append(response.Phases, NewPhaseTiming(phase.name, phase.result.StartedAt, phase.result.Duration))
+		}
+	}
+	if setup != nil {
+		setOutput(response, "setup_stdout", setup.Stdout.Bytes(), setup.StdoutTruncated, &response.SetupStdout, &response.SetupStdoutBytes)
+		setOutput(response, "setup_stderr", setup.Stderr.Bytes(), setup.StderrTruncated, &response.SetupStderr, &response.SetupStderrBytes)
+		response.SetupExitCode = int32(setup.ExitCode)
+	}
+	if compile != nil {
+		setOutput(response, "compile_stdout", compile.Stdout.Bytes(), compile.StdoutTruncated, &response.CompileStdout, &response.CompileStdoutBytes)
+		setOutput(response, "compile_stderr", compile.Stderr.Bytes(), compile.StderrTruncated, &response.CompileStderr, &response.CompileStderrBytes)
+		response.CompileExitCode = int32(compile.ExitCode)
+	}
+	if run != nil {
+		setOutput(response, "run_stdout", run.Stdout.Bytes(), run.StdoutTruncated, &response.RunStdout, &response.RunStdoutBytes)
+		setOutput(response, "run_stderr", run.Stderr.Bytes(), run.StderrTruncated, &response.RunStderr, &response.RunStderrBytes)
+		response.RunExitCode = int32(run.ExitCode)
+	}
+	return response
+}
+
+// setOutput stores output in a string field. Protobuf strings must be valid
+// UTF-8, other output is also kept as is in a bytes field and field is added
+// to the non-UTF-8 outputs of the response. Truncated output is added to the
+// truncated outputs.
+func setOutput(response *job.JobResponse, field string, output []byte, truncated bool, text *string, raw *[]byte) {
+	if truncated {
+		response.TruncatedOutputs = append(response.TruncatedOutputs, field)
+		// The cut may split the last character
+		for cut := 1; cut < utf8.UTFMax && cut <= len(output) && !utf8.Valid(output); cut++ {
+			if utf8.Valid(output[:len(output)-cut]) {
+				output = output[:len(output)-cut]
+				break
 			}
 		}
 	}
+	if utf8.Valid(output) {
+		*text = string(output)
+		return
+	}
+	*text = strings.ToValidUTF8(string(output), "\uFFFD")
+	*raw = bytes.Clone(output)
+	response.NonUtf8Outputs = append(response.NonUtf8Outputs, field)
+}
+
+// runtimeError classifies a failed runtime call, calls failing because the
+// job was cancelled are not infrastructure failures.
+func runtimeError(ctx context.Context, operation string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return newInfrastructureError(operation, err)
+}
+
+func NewPhaseTiming(name string, startedAt time.Time, duration time.Duration) *job.PhaseTiming {
+	return &job.PhaseTiming{
+		Name:      name,
+		StartedAt: startedAt.UnixMilli(),
+		Duration:  duration.Milliseconds(),
+	}
 }
@@ -0,0 +1,453 @@
+package container_test
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/container/fake"
+	"ExecutionEngine/proto/job"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRequest() *job.JobRequest {
+	return &job.JobRequest{
+		SourceCodeFileName: "main.c",
+		SourceCode:         "int main() { return 0; }",
+		SetupScript:        "true",
+		CompileScript:      "gcc main.c",
+		RunScript:          "./a.out",
+		Stdin:              "input",
+		ResourceLimits: &job.ResourceLimits{
+			MaxExecutionTime: 200,
+			MaxMemory:        64 << 20,
+			MaxCompileTime:   200,
+		},
+	}
+}
+
+func TestRunVerdicts(t *testing.T) {
+	tests := []struct {
+		name            string
+		behaviors       map[string]fake.Behavior
+		status          string
+		setupExitCode   int32
+		compileExitCode int32
+		runExitCode     int32
+		runStdout       string
+		runStderr       string
+	}{
+		{
+			name:      "finished",
+			behaviors: map[string]fake.Behavior{"run.sh": {Stdout: "out", Stderr: "err"}},
+			status:    container.StatusFinished,
+			runStdout: "out",
+			runStderr: "err",
+		},
+		{
+			name:      "stdin is forwarded",
+			behaviors: map[string]fake.Behavior{"run.sh": {EchoStdin: true}},
+			status:    container.StatusFinished,
+			runStdout: "input",
+		},
+		{
+			name:        "non-zero exit code",
+			behaviors:   map[string]fake.Behavior{"run.sh": {ExitCode: 3}},
+			status:      container.StatusFinished,
+			runExitCode: 3,
+		},
+		{
+			name:        "sandbox exit code wins",
+			behaviors:   map[string]fake.Behavior{"run.sh": {ExitCode: 42, ExitSandbox: true}},
+			status:      container.StatusFinished,
+			runExitCode: 42,
+		},
+		{
+			name:            "setup error",
+			behaviors:       map[string]fake.Behavior{"setup.sh": {ExitCode: 1}},
+			status:          container.StatusSetupError,
+			setupExitCode:   1,
+			compileExitCode: -1,
+			runExitCode:     -1,
+		},
+		{
+			name:            "compile error",
+			behaviors:       map[string]fake.Behavior{"compile.sh": {ExitCode: 1, Stderr: "syntax error"}},
+			status:          container.StatusCompileError,
+			compileExitCode: 1,
+			runExitCode:     -1,
+		},
+		{
+			name:            "setup time limit exceeded",
+			behaviors:       map[string]fake.Behavior{"setup.sh": {Delay: time.Second}},
+			status:          container.StatusSetupError,
+			setupExitCode:   -1,
+			compileExitCode: -1,
+			runExitCode:     -1,
+		},
+		{
+			name:            "compile time limit exceeded",
+			behaviors:       map[string]fake.Behavior{"compile.sh": {Delay: time.Second}},
+			status:          container.StatusCompileError,
+			compileExitCode: -1,
+			runExitCode:     -1,
+		},
+		{
+			name:        "time limit exceeded",
+			behaviors:   map[string]fake.Behavior{"run.sh": {Delay: time.Second}},
+			status:      container.StatusTimeLimitExceeded,
+			runExitCode: -1,
+		},
+		{
+			name:        "memory limit exceeded",
+			behaviors:   map[string]fake.Behavior{"run.sh": {OOMKilled: true}},
+			status:      container.StatusMemoryLimitExceeded,
+			runExitCode: 137,
+		},
+		{
+			name:      "slow but in time",
+			behaviors: map[string]fake.Behavior{"run.sh": {Delay: 20 * time.Millisecond, Stdout: "late"}},
+			status:    container.StatusFinished,
+			runStdout: "late",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runtime := fake.NewRuntime()
+			for command, behavior := range test.behaviors {
+				runtime.SetBehavior(command, behavior)
+			}
+
+			request := newRequest()
+			// Collecting files never changes the verdict, even when the
+			// sandbox stopped
+			request.OutputFiles = []string{"*.csv"}
+			err, response := container.Run(context.Background(), runtime, "image", request, nil, nil)
+			if err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if response.Status != test.status {
+				t.Errorf("status = %q, want %q", response.Status, test.status)
+			}
+			if response.SetupExitCode != test.setupExitCode {
+				t.Errorf("setup exit code = %d, want %d", response.SetupExitCode, test.setupExitCode)
+			}
+			if response.CompileExitCode != test.compileExitCode {
+				t.Errorf("compile exit code = %d, want %d", response.CompileExitCode, test.compileExitCode)
+			}
+			if response.RunExitCode != test.runExitCode {
+				t.Errorf("run exit code = %d, want %d", response.RunExitCode, test.runExitCode)
+			}
+			if response.RunStdout != test.runStdout {
+				t.Errorf("run stdout = %q, want %q", response.RunStdout, test.runStdout)
+			}
+			if response.RunStderr != test.runStderr {
+				t.Errorf("run stderr = %q, want %q", response.RunStderr, test.runStderr)
+			}
+			if runtime.LiveSandboxes() != 0 {
+				t.Errorf("%d sandboxes were not removed", runtime.LiveSandboxes())
+			}
+		})
+	}
+}
+
+func TestRunInfrastructureErrors(t *testing.T) {
+	operations := []string{
+		fake.OperationCreate,
+		fake.OperationStart,
+		fake.OperationCopyTo,
+		fake.OperationExec,
+		fake.OperationInspect,
+	}
+
+	for _, operation := range operations {
+		t.Run(operation, func(t *testing.T) {
+			runtime := fake.NewRuntime()
+			runtime.FailNext(operation, 1)
+
+			err, _ := container.Run(context.Background(), runtime, "image", newRequest(), nil, nil)
+			if !container.IsInfrastructureError(err) {
+				t.Fatalf("error = %v, want an infrastructure error", err)
+			}
+			if !errors.Is(err, fake.ErrInjected) {
+				t.Errorf("error = %v, want it to wrap the runtime error", err)
+			}
+			if runtime.LiveSandboxes() != 0 {
+				t.Errorf("%d sandboxes were not removed", runtime.LiveSandboxes())
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request := newRequest()
+	request.ResourceLimits.MaxExecutionTime = 10_000
+
+	err, response := container.Run(ctx, runtime, "image", request, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) || container.IsInfrastructureError(err) {
+		t.Fatalf("error = %v, want the context error", err)
+	}
+	if response.Status != container.StatusAborted {
+		t.Errorf("status = %q, want %q", response.Status, container.StatusAborted)
+	}
+}
+
+func TestRunCopiesFiles(t *testing.T) {
+	runtime := fake.NewRuntime()
+	request := newRequest()
+
+	err, _ := container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	files := map[string]string{
+		"main.c":     request.SourceCode,
+		"setup.sh":   request.SetupScript,
+		"compile.sh": request.CompileScript,
+		"run.sh":     request.RunScript,
+	}
+	for name, want := range files {
+		err, content := runtime.File("fake-1", name)
+		if err != nil {
+			t.Errorf("file %s: %v", name, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("file %s = %q, want %q", name, content, want)
+		}
+	}
+
+	err, spec := runtime.Spec("fake-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Image != "image" || spec.MemoryLimit != request.ResourceLimits.MaxMemory {
+		t.Errorf("spec = %+v, want image and memory limit of the request", spec)
+	}
+}
+
+func TestRunStreamsOutput(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("compile.sh", fake.Behavior{Stderr: "warning"})
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "result"})
+
+	var chunks []string
+	ctx := container.WithOutputFunc(context.Background(), func(phase, stream string, chunk []byte) {
+		chunks = append(chunks, phase+" "+stream+" "+string(chunk))
+	})
+	err, response := container.Run(ctx, runtime, "image", newRequest(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"compile stderr warning", "run stdout result"}
+	if fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+	if response.RunStdout != "result" {
+		t.Errorf("run stdout = %q, want the streamed output too", response.RunStdout)
+	}
+}
+
+func TestRunCollectsOutputFiles(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{ExitCode: 1, Files: map[string]string{
+		"results.csv":    "a,b\n",
+		"plots/loss.png": "png-bytes",
+		"notes.txt":      "not collected",
+	}})
+	request := newRequest()
+	request.OutputFiles = []string{"*.csv", "plots/*.png"}
+	request.ResourceLimits.MaxOutputFilesSize = 12
+
+	err, response := container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, file := range response.OutputFiles {
+		files = append(files, fmt.Sprintf("%s=%q/%d/%v", file.Name, file.Content, file.Size, file.Truncated))
+	}
+	// The size limit cuts the file collected last
+	want := []string{`plots/loss.png="png-bytes"/9/false`, `results.csv="a,b"/4/true`}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("output files = %s, want %s", files, want)
+	}
+	// Only the matching files leave the sandbox
+	if copied := runtime.CopiedFiles(); fmt.Sprint(copied) != "[plots/loss.png results.csv]" {
+		t.Errorf("copied files = %v, want the matching ones only", copied)
+	}
+
+	runtime.FailNext(fake.OperationCopyFrom, 2)
+	err, response = container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil || response.Status != container.StatusFinished || len(response.OutputFiles) != 0 {
+		t.Errorf("error = %v, status %q, %d files, want the verdict without files when they cannot be copied", err, response.GetStatus(), len(response.GetOutputFiles()))
+	}
+
+	// The sandbox of a job over its time limit is killed, its files are lost
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: time.Second, Files: map[string]string{"results.csv": "a,b\n"}})
+	err, response = container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil || response.Status != container.StatusTimeLimitExceeded || len(response.OutputFiles) != 0 {
+		t.Errorf("error = %v, status %q, %d files, want a time limit without files", err, response.GetStatus(), len(response.GetOutputFiles()))
+	}
+}
+
+func TestRunBinaryOutput(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{EchoStdin: true, Stderr: "text"})
+	request := newRequest()
+	request.Stdin = ""
+	request.StdinBytes = []byte{0, 0xff, 'a'}
+
+	err, response := container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RunStdout != "\x00\uFFFDa" || !bytes.Equal(response.RunStdoutBytes, request.StdinBytes) {
+		t.Errorf("run stdout = %q, bytes %q, want the replaced text and the raw bytes", response.RunStdout, response.RunStdoutBytes)
+	}
+	if response.RunStderr != "text" || response.RunStderrBytes != nil {
+		t.Errorf("run stderr = %q, bytes %q, want the text only", response.RunStderr, response.RunStderrBytes)
+	}
+	if fmt.Sprint(response.NonUtf8Outputs) != "[run_stdout]" {
+		t.Errorf("non-UTF-8 outputs = %v, want [run_stdout]", response.NonUtf8Outputs)
+	}
+}
+
+func TestRunLimitsOutput(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "héllo" + strings.Repeat(" world", 1000), Stderr: "ok"})
+	request := newRequest()
+	request.ResourceLimits.MaxOutputSize = 2
+
+	err, response := container.Run(context.Background(), runtime, "image", request, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cut splits é, which is dropped
+	if response.RunStdout != "h" || response.RunStdoutBytes != nil {
+		t.Errorf("run stdout = %q, bytes %q, want the first character only", response.RunStdout, response.RunStdoutBytes)
+	}
+	if response.RunStderr != "ok" {
+		t.Errorf("run stderr = %q, want ok", response.RunStderr)
+	}
+	if fmt.Sprint(response.TruncatedOutputs) != "[run_stdout]" || len(response.NonUtf8Outputs) != 0 {
+		t.Errorf("truncated outputs = %v, non-UTF-8 outputs = %v, want [run_stdout] only", response.TruncatedOutputs, response.NonUtf8Outputs)
+	}
+}
+
+type memoryArtifacts map[string][]byte
+
+func (m memoryArtifacts) Get(key string) (error, io.ReadCloser) {
+	archive, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	return nil, io.NopCloser(bytes.NewReader(archive))
+}
+
+func (m memoryArtifacts) Put(key string, archive io.Reader) error {
+	content, err := io.ReadAll(archive)
+	m[key] = content
+	return err
+}
+
+func TestRunRestoresCompileArtifact(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("compile.sh", fake.Behavior{Files: map[string]string{"a.out": "binary"}})
+	artifacts := memoryArtifacts{}
+
+	err, response := container.Run(context.Background(), runtime, "image", newRequest(), artifacts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.CompileCached || len(artifacts) != 1 {
+		t.Fatalf("compile cached = %v with %d artifacts, want a fresh compile", response.CompileCached, len(artifacts))
+	}
+
+	// A failing compile script proves that it is skipped
+	runtime.SetBehavior("compile.sh", fake.Behavior{ExitCode: 1})
+	request := newRequest()
+	request.RunScript = "./a.out --fast"
+	err, response = container.Run(context.Background(), runtime, "image", request, artifacts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != container.StatusFinished || !response.CompileCached || response.CompileExitCode != 0 {
+		t.Errorf("response = %v, want a finished job with a cached compile", response)
+	}
+	for name, want := range map[string]string{"a.out": "binary", "run.sh": request.RunScript} {
+		if err, content := runtime.File("fake-2", name); err != nil || string(content) != want {
+			t.Errorf("file %s = %q, %v, want %q", name, content, err, want)
+		}
+	}
+
+	request.SourceCode = "int main() { return 1; }"
+	err, response = container.Run(context.Background(), runtime, "image", request, artifacts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != container.StatusCompileError {
+		t.Errorf("status = %q, changed source must be compiled", response.Status)
+	}
+
+	runtime.SetBehavior("compile.sh", fake.Behavior{})
+	runtime.RebuildImage()
+	err, response = container.Run(context.Background(), runtime, "image", newRequest(), artifacts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.CompileCached {
+		t.Error("artifact compiled in a previous image was restored")
+	}
+}
+
+type memoryBlobs map[string]string
+
+func (m memoryBlobs) Open(digest string) (error, io.ReadCloser, int64) {
+	content, ok := m[digest]
+	if !ok {
+		return errors.New("blob not found"), nil, 0
+	}
+	return nil, io.NopCloser(strings.NewReader(content)), int64(len(content))
+}
+
+func TestRunStreamsBlobs(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{EchoStdin: true})
+	blobs := memoryBlobs{"input": "blob input", "expected": "expected output"}
+	request := newRequest()
+	request.Stdin = ""
+	request.StdinBlob = "input"
+	request.Files = []*job.InputFile{{Name: "tests/expected.txt", Blob: "expected"}}
+
+	err, response := container.Run(context.Background(), runtime, "image", request, nil, blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RunStdout != "blob input" {
+		t.Errorf("run stdout = %q, want the stdin blob", response.RunStdout)
+	}
+	if err, content := runtime.File("fake-1", "tests/expected.txt"); err != nil || string(content) != "expected output" {
+		t.Errorf("file = %q, %v, want the blob", content, err)
+	}
+
+	request.Files[0].Blob = "evicted"
+	err, _ = container.Run(context.Background(), runtime, "image", request, nil, blobs)
+	if !container.IsInfrastructureError(err) {
+		t.Errorf("error = %v, want an infrastructure error", err)
+	}
+	if runtime.LiveSandboxes() != 0 {
+		t.Errorf("%d sandboxes were not removed", runtime.LiveSandboxes())
+	}
+}
@@ -0,0 +1,59 @@
+package container
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Runtime is a backend able to run jobs inside isolated sandboxes. Paths and
+// commands are resolved relative to the working directory of the sandbox.
+type Runtime interface {
+	Create(ctx context.Context, spec *SandboxSpec) (error, string)
+	Start(ctx context.Context, sandboxID string) error
+	// CopyTo extracts a tar archive into the given directory of the sandbox.
+	CopyTo(ctx context.Context, sandboxID, path string, archive io.Reader) error
+	// CopyFrom returns a tar archive of the given directory of the sandbox
+	// with entries relative to it, or of the given file with a single entry
+	// named after it.
+	CopyFrom(ctx context.Context, sandboxID, path string) (error, io.ReadCloser)
+	// Exec runs a command to completion while streaming its standard
+	// streams. When ctx is done the command is abandoned and ctx.Err() is
+	// returned.
+	Exec(ctx context.Context, sandboxID string, options *ExecOptions) (error, *ExecResult)
+	Inspect(ctx context.Context, sandboxID string) (error, *SandboxState)
+	Kill(ctx context.Context, sandboxID string) error
+	Remove(ctx context.Context, sandboxID string) error
+	// ImageID identifies the exact content of an image, it changes whenever
+	// the image is rebuilt.
+	ImageID(ctx context.Context, image string) (error, string)
+}
+
+type SandboxSpec struct {
+	Image       string
+	MemoryLimit int64 // in bytes, 0 means unlimited
+	// NetworkAccess lets the sandbox reach the network even when the
+	// backend isolates sandboxes from it by default
+	NetworkAccess bool
+}
+
+type ExecOptions struct {
+	Command              []string
+	EnvironmentVariables []string
+	Stdin                io.Reader
+	Stdout               io.Writer
+	Stderr               io.Writer
+}
+
+type ExecResult struct {
+	ExitCode int
+	// CPUTime is the processor time used by the command and the processes it
+	// started, negative when the runtime cannot measure it
+	CPUTime time.Duration
+}
+
+type SandboxState struct {
+	Running   bool
+	ExitCode  int
+	OOMKilled bool
+}
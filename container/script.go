@@ -0,0 +1,110 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+type ScriptExecutionResult struct {
+	ExitCode int
+	Stdout   *bytes.Buffer
+	Stderr   *bytes.Buffer
+	// The output past the limit of the script is dropped
+	StdoutTruncated bool
+	StderrTruncated bool
+	StartedAt       time.Time
+	Duration        time.Duration
+	// CPUTime is negative when the runtime cannot measure it
+	CPUTime time.Duration
+}
+
+type TextFile struct {
+	Name    string
+	Content string
+	Mode    int64
+}
+
+// WriteTextFiles copies files into the working directory of a sandbox using
+// a single archive.
+func WriteTextFiles(ctx context.Context, runtime Runtime, sandboxID string, files []TextFile) error {
+	streamedFiles := make([]streamedFile, len(files))
+	for i, file := range files {
+		streamedFiles[i] = streamedFile{file.Name, file.Mode, int64(len(file.Content)), io.NopCloser(strings.NewReader(file.Content))}
+	}
+	return writeStreamedFiles(ctx, runtime, sandboxID, streamedFiles)
+}
+
+func ExecuteScript(ctx context.Context, runtime Runtime, sandboxID, scriptFileName string, environmentVariables []string, stdin io.Reader) (error, *ScriptExecutionResult) {
+	return executeScript(ctx, runtime, sandboxID, scriptFileName, environmentVariables, stdin, nil, nil, 0)
+}
+
+// executeScript also copies the output to stdout and stderr unless they are
+// nil. Only the first maxOutputSize bytes of each output are kept, zero keeps
+// everything.
+func executeScript(ctx context.Context, runtime Runtime, sandboxID, scriptFileName string, environmentVariables []string, stdin io.Reader, stdout, stderr io.Writer, maxOutputSize int64) (error, *ScriptExecutionResult) {
+	result := &ScriptExecutionResult{
+		ExitCode:  -1,
+		Stdout:    &bytes.Buffer{},
+		Stderr:    &bytes.Buffer{},
+		StartedAt: time.Now(),
+		CPUTime:   -1,
+	}
+	execOptions := &ExecOptions{
+		Command:              []string{"/bin/bash", scriptFileName},
+		EnvironmentVariables: environmentVariables,
+		Stdin:                stdin,
+		Stdout:               result.Stdout,
+		Stderr:               result.Stderr,
+	}
+	if stdout != nil {
+		execOptions.Stdout = io.MultiWriter(result.Stdout, stdout)
+	}
+	if stderr != nil {
+		execOptions.Stderr = io.MultiWriter(result.Stderr, stderr)
+	}
+	var limitedStdout, limitedStderr *limitedWriter
+	if maxOutputSize > 0 {
+		limitedStdout = &limitedWriter{writer: execOptions.Stdout, remaining: maxOutputSize}
+		limitedStderr = &limitedWriter{writer: execOptions.Stderr, remaining: maxOutputSize}
+		execOptions.Stdout, execOptions.Stderr = limitedStdout, limitedStderr
+	}
+	err, execResult := runtime.Exec(ctx, sandboxID, execOptions)
+	result.Duration = time.Since(result.StartedAt)
+	if maxOutputSize > 0 {
+		result.StdoutTruncated, result.StderrTruncated = limitedStdout.truncated, limitedStderr.truncated
+	}
+	if err != nil {
+		return err, result
+	}
+	result.ExitCode = execResult.ExitCode
+	result.CPUTime = execResult.CPUTime
+
+	return nil, result
+}
+
+// limitedWriter forwards the first remaining bytes written to it and drops
+// the rest. Writes never fail because of the limit, so the command does not
+// block on its output.
+type limitedWriter struct {
+	writer    io.Writer
+	remaining int64
+	truncated bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	written := p
+	if int64(len(p)) > w.remaining {
+		written = p[:w.remaining]
+		w.truncated = true
+	}
+	w.remaining -= int64(len(written))
+	if len(written) > 0 {
+		if _, err := w.writer.Write(written); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"ExecutionEngine/tracing"
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+type tracedRuntime struct {
+	inner Runtime
+}
+
+// InstrumentRuntime records a span for every call to inner. Calls of the
+// Docker client additionally record spans of the HTTP requests they make.
+func InstrumentRuntime(inner Runtime) Runtime {
+	return &tracedRuntime{
+		inner: inner,
+	}
+}
+
+func (r *tracedRuntime) Create(ctx context.Context, spec *SandboxSpec) (error, string) {
+	ctx, span := tracer.Start(ctx, "runtime.Create", trace.WithAttributes(
+		attribute.String("image", spec.Image),
+		attribute.Int64("memory_limit", spec.MemoryLimit),
+	))
+	err, sandboxID := r.inner.Create(ctx, spec)
+	span.SetAttributes(attribute.String("sandbox_id", sandboxID))
+	tracing.EndSpan(span, err)
+	return err, sandboxID
+}
+
+func (r *tracedRuntime) Start(ctx context.Context, sandboxID string) error {
+	ctx, span := r.start(ctx, "runtime.Start", sandboxID)
+	err := r.inner.Start(ctx, sandboxID)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (r *tracedRuntime) CopyTo(ctx context.Context, sandboxID, path string, archive io.Reader) error {
+	ctx, span := r.start(ctx, "runtime.CopyTo", sandboxID)
+	err := r.inner.CopyTo(ctx, sandboxID, path, archive)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+// CopyFrom only covers the call, not reading the returned archive.
+func (r *tracedRuntime) CopyFrom(ctx context.Context, sandboxID, path string) (error, io.ReadCloser) {
+	ctx, span := r.start(ctx, "runtime.CopyFrom", sandboxID)
+	err, archive := r.inner.CopyFrom(ctx, sandboxID, path)
+	tracing.EndSpan(span, err)
+	return err, archive
+}
+
+func (r *tracedRuntime) Exec(ctx context.Context, sandboxID string, options *ExecOptions) (error, *ExecResult) {
+	ctx, span := r.start(ctx, "runtime.Exec", sandboxID)
+	span.SetAttributes(attribute.StringSlice("command", options.Command))
+	err, result := r.inner.Exec(ctx, sandboxID, options)
+	if result != nil {
+		span.SetAttributes(attribute.Int("exit_code", result.ExitCode))
+	}
+	tracing.EndSpan(span, err)
+	return err, result
+}
+
+func (r *tracedRuntime) Inspect(ctx context.Context, sandboxID string) (error, *SandboxState) {
+	ctx, span := r.start(ctx, "runtime.Inspect", sandboxID)
+	err, state := r.inner.Inspect(ctx, sandboxID)
+	tracing.EndSpan(span, err)
+	return err, state
+}
+
+func (r *tracedRuntime) Kill(ctx context.Context, sandboxID string) error {
+	ctx, span := r.start(ctx, "runtime.Kill", sandboxID)
+	err := r.inner.Kill(ctx, sandboxID)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (r *tracedRuntime) Remove(ctx context.Context, sandboxID string) error {
+	ctx, span := r.start(ctx, "runtime.Remove", sandboxID)
+	err := r.inner.Remove(ctx, sandboxID)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (r *tracedRuntime) ImageID(ctx context.Context, image string) (error, string) {
+	ctx, span := tracer.Start(ctx, "runtime.ImageID", trace.WithAttributes(attribute.String("image", image)))
+	err, imageID := r.inner.ImageID(ctx, image)
+	tracing.EndSpan(span, err)
+	return err, imageID
+}
+
+func (r *tracedRuntime) start(ctx context.Context, name, sandboxID string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("sandbox_id", sandboxID)))
+}
@@ -0,0 +1,205 @@
+package warm
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/log"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// replenishRetryInterval is how long to wait before creating sandboxes again
+// after the underlying runtime failed.
+const replenishRetryInterval = time.Second
+
+type Options struct {
+	// Size is the number of started sandboxes kept ready for every spec
+	Size  int
+	Specs []container.SandboxSpec
+}
+
+// Runtime keeps pre-started sandboxes of the configured specs ready so jobs
+// skip creation and startup. Sandboxes are never reused: a job may leave
+// anything behind, so a used sandbox is removed and replaced in the
+// background. Requests for other specs go straight to the wrapped runtime.
+type Runtime struct {
+	container.Runtime
+
+	options     Options
+	lock        sync.Mutex
+	ready       map[container.SandboxSpec][]string
+	pending     map[container.SandboxSpec]int
+	handedOut   map[string]struct{}
+	wakeUp      chan struct{}
+	stopContext context.Context
+	stop        context.CancelFunc
+	stopped     sync.WaitGroup
+}
+
+func NewRuntime(runtime container.Runtime, options *Options) *Runtime {
+	stopContext, stop := context.WithCancel(context.Background())
+	r := &Runtime{
+		Runtime:     runtime,
+		options:     *options,
+		ready:       map[container.SandboxSpec][]string{},
+		pending:     map[container.SandboxSpec]int{},
+		handedOut:   map[string]struct{}{},
+		wakeUp:      make(chan struct{}, 1),
+		stopContext: stopContext,
+		stop:        stop,
+	}
+
+	r.stopped.Add(1)
+	go r.replenish()
+	r.signal()
+
+	return r
+}
+
+func (r *Runtime) Create(ctx context.Context, spec *container.SandboxSpec) (error, string) {
+	for {
+		r.lock.Lock()
+		ready := r.ready[*spec]
+		if len(ready) == 0 {
+			r.lock.Unlock()
+			return r.Runtime.Create(ctx, spec)
+		}
+		sandboxID := ready[0]
+		r.ready[*spec] = ready[1:]
+		r.lock.Unlock()
+		r.signal()
+
+		// Sandboxes may have died while waiting, e.g. when the daemon restarted
+		err, state := r.Runtime.Inspect(ctx, sandboxID)
+		if err == nil && state.Running {
+			r.lock.Lock()
+			r.handedOut[sandboxID] = struct{}{}
+			r.lock.Unlock()
+			return nil, sandboxID
+		}
+		log.FromContext(ctx).Warn("Discarding dead warm sandbox", zap.Error(err), zap.String("containerID", sandboxID))
+		r.discard(sandboxID)
+	}
+}
+
+func (r *Runtime) Start(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	_, started := r.handedOut[sandboxID]
+	r.lock.Unlock()
+	if started {
+		return nil
+	}
+	return r.Runtime.Start(ctx, sandboxID)
+}
+
+func (r *Runtime) Remove(ctx context.Context, sandboxID string) error {
+	r.lock.Lock()
+	delete(r.handedOut, sandboxID)
+	r.lock.Unlock()
+	return r.Runtime.Remove(ctx, sandboxID)
+}
+
+// ReadySandboxes returns how many sandboxes are waiting for a job.
+func (r *Runtime) ReadySandboxes() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	count := 0
+	for _, ready := range r.ready {
+		count += len(ready)
+	}
+	return count
+}
+
+// Close stops replenishing and removes the sandboxes nobody used.
+func (r *Runtime) Close() error {
+	r.stop()
+	r.stopped.Wait()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var errs []error
+	for spec, ready := range r.ready {
+		for _, sandboxID := range ready {
+			errs = append(errs, r.Runtime.Remove(context.Background(), sandboxID))
+		}
+		delete(r.ready, spec)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Runtime) signal() {
+	select {
+	case r.wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runtime) replenish() {
+	defer r.stopped.Done()
+
+	var creators sync.WaitGroup
+	defer creators.Wait()
+
+	for {
+		select {
+		case <-r.stopContext.Done():
+			return
+		case <-r.wakeUp:
+		}
+
+		r.lock.Lock()
+		for _, spec := range r.options.Specs {
+			for missing := r.options.Size - len(r.ready[spec]) - r.pending[spec]; missing > 0; missing-- {
+				r.pending[spec]++
+				creators.Add(1)
+				go func() {
+					defer creators.Done()
+					r.create(spec)
+				}()
+			}
+		}
+		r.lock.Unlock()
+	}
+}
+
+func (r *Runtime) create(spec container.SandboxSpec) {
+	err, sandboxID := r.Runtime.Create(r.stopContext, &spec)
+	if err == nil {
+		if err = r.Runtime.Start(r.stopContext, sandboxID); err != nil {
+			r.discard(sandboxID)
+		}
+	}
+
+	r.lock.Lock()
+	r.pending[spec]--
+	keep := err == nil && r.stopContext.Err() == nil
+	if keep {
+		r.ready[spec] = append(r.ready[spec], sandboxID)
+	}
+	r.lock.Unlock()
+
+	switch {
+	case err != nil:
+		log.L().Warn("Cannot create warm sandbox", zap.Error(err), zap.String("image", spec.Image))
+		select {
+		case <-r.stopContext.Done():
+			return
+		case <-time.After(replenishRetryInterval):
+		}
+	case !keep:
+		// Close is running, nobody will hand this sandbox out anymore
+		r.discard(sandboxID)
+		return
+	}
+	r.signal()
+}
+
+func (r *Runtime) discard(sandboxID string) {
+	if err := r.Runtime.Remove(context.Background(), sandboxID); err != nil {
+		log.L().Warn("Cannot remove warm sandbox", zap.Error(err), zap.String("containerID", sandboxID))
+	}
+}
@@ -0,0 +1,115 @@
+package warm
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/container/fake"
+	"context"
+	"testing"
+	"time"
+)
+
+var spec = container.SandboxSpec{Image: "image", MemoryLimit: 64 << 20}
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWarmSandboxesAreHandedOutAndReplaced(t *testing.T) {
+	inner := fake.NewRuntime()
+	r := NewRuntime(inner, &Options{Size: 2, Specs: []container.SandboxSpec{spec}})
+	defer r.Close()
+	waitFor(t, "warm sandboxes", func() bool { return r.ReadySandboxes() == 2 })
+
+	requested := spec
+	err, sandboxID := r.Create(context.Background(), &requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background(), sandboxID); err != nil {
+		t.Fatal(err)
+	}
+	err, state := r.Inspect(context.Background(), sandboxID)
+	if err != nil || !state.Running {
+		t.Fatalf("handed out sandbox is not running: %v", err)
+	}
+
+	waitFor(t, "replenishment", func() bool { return r.ReadySandboxes() == 2 })
+	if err := r.Remove(context.Background(), sandboxID); err != nil {
+		t.Fatal(err)
+	}
+	if inner.CreatedSandboxes() != 3 || inner.LiveSandboxes() != 2 {
+		t.Errorf("created %d, live %d sandboxes, want 3 and 2", inner.CreatedSandboxes(), inner.LiveSandboxes())
+	}
+}
+
+func TestOtherSpecsAreCreatedCold(t *testing.T) {
+	inner := fake.NewRuntime()
+	r := NewRuntime(inner, &Options{Size: 1, Specs: []container.SandboxSpec{spec}})
+	defer r.Close()
+	waitFor(t, "warm sandboxes", func() bool { return r.ReadySandboxes() == 1 })
+
+	err, sandboxID := r.Create(context.Background(), &container.SandboxSpec{Image: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, state := r.Inspect(context.Background(), sandboxID)
+	if err != nil || state.Running {
+		t.Errorf("cold sandbox should not be started before Start: %v", err)
+	}
+	if r.ReadySandboxes() != 1 {
+		t.Errorf("%d ready sandboxes, want the warm one untouched", r.ReadySandboxes())
+	}
+}
+
+func TestDeadWarmSandboxesAreDiscarded(t *testing.T) {
+	inner := fake.NewRuntime()
+	r := NewRuntime(inner, &Options{Size: 1, Specs: []container.SandboxSpec{spec}})
+	defer r.Close()
+	waitFor(t, "warm sandboxes", func() bool { return r.ReadySandboxes() == 1 })
+
+	r.lock.Lock()
+	dead := r.ready[spec][0]
+	r.lock.Unlock()
+	if err := inner.Kill(context.Background(), dead); err != nil {
+		t.Fatal(err)
+	}
+
+	requested := spec
+	err, sandboxID := r.Create(context.Background(), &requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sandboxID == dead {
+		t.Error("dead sandbox was handed out")
+	}
+}
+
+func TestCloseRemovesReadySandboxes(t *testing.T) {
+	inner := fake.NewRuntime()
+	r := NewRuntime(inner, &Options{Size: 3, Specs: []container.SandboxSpec{spec}})
+	waitFor(t, "warm sandboxes", func() bool { return r.ReadySandboxes() == 3 })
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if inner.LiveSandboxes() != 0 {
+		t.Errorf("%d sandboxes left after Close", inner.LiveSandboxes())
+	}
+}
+
+func TestFailuresAreRetried(t *testing.T) {
+	inner := fake.NewRuntime()
+	inner.FailNext(fake.OperationCreate, 1)
+	r := NewRuntime(inner, &Options{Size: 1, Specs: []container.SandboxSpec{spec}})
+	defer r.Close()
+
+	waitFor(t, "warm sandboxes", func() bool { return r.ReadySandboxes() == 1 })
+}
@@ -0,0 +1,349 @@
+package gateway
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/proto/job"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var tracer = otel.Tracer("ExecutionEngine/gateway")
+
+// eventBufferSize is how many output events may wait for a slow client before
+// the job itself has to wait.
+const eventBufferSize = 64
+
+type Options struct {
+	// Interceptor is the interceptor of the gRPC server, every call goes
+	// through it so that both share authentication
+	Interceptor grpc.UnaryServerInterceptor
+	// MaxRequestBytes bounds the body of a request
+	MaxRequestBytes int64
+}
+
+type gateway struct {
+	server  job.JobServer
+	options Options
+}
+
+// NewHandler serves the Job service as JSON over HTTP:
+//
+//	POST   /jobs       submits a JobRequest and returns its JobResponse, or
+//	                   streams the output as server-sent events when the
+//	                   client accepts text/event-stream
+//	GET    /jobs       lists jobs filtered by the state, callback_state,
+//	                   tenant, limit, created_after and created_before query
+//	                   parameters
+//	GET    /jobs/{id}  returns the JobRecord of a job
+//	DELETE /jobs/{id}  cancels a job
+func NewHandler(server job.JobServer, options *Options) http.Handler {
+	g := &gateway{server: server, options: *options}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", g.submit)
+	mux.HandleFunc("GET /jobs", g.listJobs)
+	mux.HandleFunc("GET /jobs/{id}", g.getJob)
+	mux.HandleFunc("DELETE /jobs/{id}", g.cancelJob)
+	return mux
+}
+
+// call runs handler as if request came in through gRPC with the headers of r
+// as metadata.
+func (g *gateway) call(ctx context.Context, r *http.Request, method string, request proto.Message, handler grpc.UnaryHandler) (interface{}, error) {
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		md.Append(strings.ToLower(name), values...)
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, r.Method+" "+r.Pattern)
+	defer span.End()
+
+	if g.options.Interceptor == nil {
+		return handler(ctx, request)
+	}
+	return g.options.Interceptor(ctx, request, &grpc.UnaryServerInfo{Server: g.server, FullMethod: method}, handler)
+}
+
+func (g *gateway) submit(w http.ResponseWriter, r *http.Request) {
+	request := &job.JobRequest{}
+	if err := g.readRequest(r, request); err != nil {
+		writeError(w, err)
+		return
+	}
+	handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.Submit(ctx, request.(*job.JobRequest))
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		response, err := g.call(r.Context(), r, job.Job_Submit_FullMethodName, request, handler)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeMessage(w, response.(proto.Message))
+		return
+	}
+	g.streamSubmit(w, r, request, handler)
+}
+
+// outputEvent is the data of an output event. Chunks that are not valid
+// UTF-8 are sent in base64 as data_base64 instead of data.
+type outputEvent struct {
+	Phase      string `json:"phase"`
+	Stream     string `json:"stream"`
+	Data       string `json:"data,omitempty"`
+	DataBase64 []byte `json:"data_base64,omitempty"`
+}
+
+func newOutputEvent(phase, stream string, chunk []byte) outputEvent {
+	event := outputEvent{Phase: phase, Stream: stream}
+	if utf8.Valid(chunk) {
+		event.Data = string(chunk)
+	} else {
+		event.DataBase64 = bytes.Clone(chunk)
+	}
+	return event
+}
+
+type result struct {
+	response interface{}
+	err      error
+}
+
+// streamSubmit sends the output of the job as output events while it runs,
+// followed by a response or an error event. Errors before the first event
+// are plain HTTP errors.
+func (g *gateway) streamSubmit(w http.ResponseWriter, r *http.Request, request *job.JobRequest, handler grpc.UnaryHandler) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	events := make(chan outputEvent, eventBufferSize)
+	ctx = container.WithOutputFunc(ctx, func(phase, stream string, chunk []byte) {
+		select {
+		case events <- newOutputEvent(phase, stream, chunk):
+		case <-ctx.Done():
+		}
+	})
+	results := make(chan result, 1)
+	go func() {
+		response, err := g.call(ctx, r, job.Job_Submit_FullMethodName, request, handler)
+		results <- result{response, err}
+	}()
+
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+	writeOutput := func(event outputEvent) {
+		start()
+		data, _ := json.Marshal(event)
+		writeEvent(w, "output", data)
+	}
+
+	for {
+		select {
+		case event := <-events:
+			writeOutput(event)
+		case result := <-results:
+			for len(events) > 0 {
+				writeOutput(<-events)
+			}
+			if result.err != nil && !started {
+				writeError(w, result.err)
+				return
+			}
+			start()
+			if result.err != nil {
+				data, _ := protojson.Marshal(status.Convert(result.err).Proto())
+				writeEvent(w, "error", data)
+				return
+			}
+			data, _ := protojson.Marshal(result.response.(proto.Message))
+			writeEvent(w, "response", data)
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gateway) getJob(w http.ResponseWriter, r *http.Request) {
+	request := &job.GetJobRequest{JobId: r.PathValue("id")}
+	record, err := g.call(r.Context(), r, job.Job_GetJob_FullMethodName, request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.GetJob(ctx, request.(*job.GetJobRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, record.(proto.Message))
+}
+
+func (g *gateway) listJobs(w http.ResponseWriter, r *http.Request) {
+	err, request := listJobsRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	response, err := g.call(r.Context(), r, job.Job_ListJobs_FullMethodName, request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.ListJobs(ctx, request.(*job.ListJobsRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, response.(proto.Message))
+}
+
+func listJobsRequest(r *http.Request) (error, *job.ListJobsRequest) {
+	query := r.URL.Query()
+	request := &job.ListJobsRequest{Tenant: query.Get("tenant")}
+	if state := query.Get("state"); state != "" {
+		value, ok := job.JobState_value[state]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "unknown state %q", state), nil
+		}
+		request.State = job.JobState(value)
+	}
+	if state := query.Get("callback_state"); state != "" {
+		value, ok := job.CallbackState_value[state]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "unknown callback state %q", state), nil
+		}
+		request.CallbackState = job.CallbackState(value)
+	}
+	for _, parameter := range []struct {
+		name  string
+		value *int64
+	}{
+		{"created_after", &request.CreatedAfter},
+		{"created_before", &request.CreatedBefore},
+	} {
+		if text := query.Get(parameter.name); text != "" {
+			value, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return status.Errorf(codes.InvalidArgument, "%s is not a number", parameter.name), nil
+			}
+			*parameter.value = value
+		}
+	}
+	if text := query.Get("limit"); text != "" {
+		limit, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "limit is not a number"), nil
+		}
+		request.Limit = int32(limit)
+	}
+	return nil, request
+}
+
+func (g *gateway) cancelJob(w http.ResponseWriter, r *http.Request) {
+	request := &job.CancelJobRequest{JobId: r.PathValue("id")}
+	response, err := g.call(r.Context(), r, job.Job_CancelJob_FullMethodName, request, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return g.server.CancelJob(ctx, request.(*job.CancelJobRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, response.(proto.Message))
+}
+
+func (g *gateway) readRequest(r *http.Request, message proto.Message) error {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, g.options.MaxRequestBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return status.Errorf(codes.ResourceExhausted, "request is larger than %d bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := protojson.Unmarshal(body, message); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+	}
+	return nil
+}
+
+func writeMessage(w http.ResponseWriter, message proto.Message) {
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		writeError(w, status.Error(codes.Internal, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// writeError responds with the google.rpc.Status of err and the HTTP status
+// matching its code.
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := math.Ceil(retryInfo.RetryDelay.AsDuration().Seconds())
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+		}
+	}
+	data, _ := protojson.Marshal(st.Proto())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(st.Code()))
+	w.Write(data)
+}
+
+// httpStatus maps gRPC codes like the gRPC HTTP/JSON transcoding does.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
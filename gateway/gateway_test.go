@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubServer records the requests it gets and fails with err when set.
+type stubServer struct {
+	job.UnimplementedJobServer
+	request proto.Message
+	err     error
+}
+
+func (s *stubServer) Submit(_ context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+	s.request = request
+	return &job.JobResponse{JobId: "job-1"}, s.err
+}
+
+func (s *stubServer) ListJobs(_ context.Context, request *job.ListJobsRequest) (*job.ListJobsResponse, error) {
+	s.request = request
+	return &job.ListJobsResponse{}, s.err
+}
+
+func (s *stubServer) CancelJob(_ context.Context, request *job.CancelJobRequest) (*job.CancelJobResponse, error) {
+	s.request = request
+	return &job.CancelJobResponse{}, s.err
+}
+
+func serve(t *testing.T, server job.JobServer, options *Options, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	NewHandler(server, options).ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func TestRequests(t *testing.T) {
+	tests := []struct {
+		method  string
+		target  string
+		body    string
+		request proto.Message
+	}{
+		{http.MethodPost, "/jobs", `{"runScript": "run", "stdin": "hello"}`, &job.JobRequest{RunScript: "run", Stdin: "hello"}},
+		{http.MethodGet, "/jobs?state=JOB_STATE_FAILED&callback_state=CALLBACK_STATE_FAILED&tenant=course-1&limit=5&created_after=10&created_before=20", "", &job.ListJobsRequest{
+			State:         job.JobState_JOB_STATE_FAILED,
+			CallbackState: job.CallbackState_CALLBACK_STATE_FAILED,
+			Tenant:        "course-1",
+			Limit:         5,
+			CreatedAfter:  10,
+			CreatedBefore: 20,
+		}},
+		{http.MethodDelete, "/jobs/job-1", "", &job.CancelJobRequest{JobId: "job-1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			server := &stubServer{}
+			recorder := serve(t, server, &Options{MaxRequestBytes: 1 << 10}, test.method, test.target, test.body)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+			}
+			if !proto.Equal(server.request, test.request) {
+				t.Errorf("request = %v, want %v", server.request, test.request)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	quotaError, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(1500 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		err        error
+		code       int
+		retryAfter string
+	}{
+		{"invalid JSON", "/jobs", `{"runScript": 1}`, nil, http.StatusBadRequest, ""},
+		{"unknown field", "/jobs", `{"script": "run"}`, nil, http.StatusBadRequest, ""},
+		{"too large", "/jobs", `{"stdin": "` + strings.Repeat("x", 100) + `"}`, nil, http.StatusTooManyRequests, ""},
+		{"not found", "/jobs", `{}`, status.Error(codes.NotFound, "missing"), http.StatusNotFound, ""},
+		{"quota", "/jobs", `{}`, quotaError.Err(), http.StatusTooManyRequests, "2"},
+		{"unknown state", "/jobs?state=DONE", "", nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := http.MethodPost
+			if test.body == "" {
+				method = http.MethodGet
+			}
+			recorder := serve(t, &stubServer{err: test.err}, &Options{MaxRequestBytes: 64}, method, test.target, test.body)
+			if recorder.Code != test.code {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.code, recorder.Body)
+			}
+			if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != test.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, test.retryAfter)
+			}
+			if !strings.Contains(recorder.Body.String(), `"code"`) {
+				t.Errorf("body = %s, want a status", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	var apiKeys []string
+	options := &Options{
+		MaxRequestBytes: 1 << 10,
+		Interceptor: func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if info.FullMethod != job.Job_Submit_FullMethodName {
+				t.Errorf("method = %s, want Submit", info.FullMethod)
+			}
+			md, _ := metadata.FromIncomingContext(ctx)
+			apiKeys = md.Get("x-api-key")
+			if len(apiKeys) == 0 {
+				return nil, status.Error(codes.Unauthenticated, "no API key")
+			}
+			return handler(ctx, request)
+		},
+	}
+	handler := NewHandler(&stubServer{}, options)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("{}")))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status without key = %d, want 401", recorder.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("{}"))
+	request.Header.Set("X-Api-Key", "secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || len(apiKeys) != 1 || apiKeys[0] != "secret" {
+		t.Errorf("status = %d, API keys = %v, want the header as metadata", recorder.Code, apiKeys)
+	}
+}
@@ -0,0 +1,187 @@
+package loadgen
+
+import (
+	"ExecutionEngine/proto/job"
+	"bufio"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubmitFunc runs one job, over gRPC or in the process.
+type SubmitFunc func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error)
+
+type Result struct {
+	// Index is the position of the request in the submitted requests
+	Index    int
+	Request  *job.JobRequest
+	Response *job.JobResponse
+	Err      error
+	Latency  time.Duration
+}
+
+type Options struct {
+	// Concurrency is the number of jobs submitted at once
+	Concurrency int
+	// Duration makes Run submit the requests over and over until it elapsed,
+	// zero submits every request once
+	Duration time.Duration
+	// OnResult is called with every result as soon as it is known, from the
+	// goroutine that submitted the job
+	OnResult func(result *Result)
+}
+
+// Run submits every request, at most Concurrency at a time, until all are
+// done or ctx is done. Jobs already submitted when the duration elapses are
+// waited for.
+func Run(ctx context.Context, submit SubmitFunc, requests []*job.JobRequest, options *Options) *Stats {
+	stats := newStats()
+	if len(requests) == 0 {
+		return stats
+	}
+	indices := make(chan int)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for range max(options.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				submitted := time.Now()
+				response, err := submit(ctx, requests[index])
+				result := &Result{
+					Index:    index,
+					Request:  requests[index],
+					Response: response,
+					Err:      err,
+					Latency:  time.Since(submitted),
+				}
+				lock.Lock()
+				stats.add(result)
+				lock.Unlock()
+				if options.OnResult != nil {
+					options.OnResult(result)
+				}
+			}
+		}()
+	}
+
+	var elapsed <-chan time.Time
+	if options.Duration > 0 {
+		timer := time.NewTimer(options.Duration)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+feed:
+	for index := 0; options.Duration > 0 || index < len(requests); index++ {
+		select {
+		case indices <- index % len(requests):
+		case <-elapsed:
+			break feed
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+	stats.Duration = time.Since(start)
+	slices.Sort(stats.Latencies)
+	for _, latencies := range stats.Phases {
+		slices.Sort(latencies)
+	}
+	return stats
+}
+
+// Stats summarize the results of a run.
+type Stats struct {
+	Jobs int
+	// Failures counts the jobs whose submission failed, jobs with a verdict
+	// count as successful whatever the verdict
+	Failures int
+	Verdicts map[string]int
+	// Errors counts the failures by gRPC code
+	Errors   map[string]int
+	Duration time.Duration
+	// Latencies of the successful jobs, sorted
+	Latencies []time.Duration
+	// Phases holds the sorted durations of every phase the engine reported,
+	// including the time jobs waited in the queue
+	Phases map[string][]time.Duration
+}
+
+func newStats() *Stats {
+	return &Stats{
+		Verdicts: map[string]int{},
+		Errors:   map[string]int{},
+		Phases:   map[string][]time.Duration{},
+	}
+}
+
+func (s *Stats) add(result *Result) {
+	s.Jobs++
+	if result.Err != nil {
+		s.Failures++
+		s.Errors[status.Code(result.Err).String()]++
+		return
+	}
+	s.Verdicts[result.Response.Status]++
+	s.Latencies = append(s.Latencies, result.Latency)
+	for _, phase := range result.Response.Phases {
+		s.Phases[phase.Name] = append(s.Phases[phase.Name], time.Duration(phase.Duration)*time.Millisecond)
+	}
+}
+
+// Throughput returns the successful jobs per second, failed submissions do
+// not count.
+func (s *Stats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Jobs-s.Failures) / s.Duration.Seconds()
+}
+
+// Percentile returns the latency below which p percent of the successful
+// jobs finished, using the nearest rank.
+func (s *Stats) Percentile(p float64) time.Duration {
+	return percentile(s.Latencies, p)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// ReadRequests parses one JobRequest in protobuf JSON per line, blank lines
+// are skipped.
+func ReadRequests(r io.Reader) (error, []*job.JobRequest) {
+	var requests []*job.JobRequest
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		request := &job.JobRequest{}
+		if err := protojson.Unmarshal([]byte(text), request); err != nil {
+			return fmt.Errorf("line %d: %w", line, err), nil
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		return err, nil
+	}
+	return nil, requests
+}
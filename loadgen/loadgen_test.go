@@ -0,0 +1,106 @@
+package loadgen
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	submit := func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if request.Stdin == "fail" {
+			return nil, errors.New("unavailable")
+		}
+		return &job.JobResponse{Status: request.Stdin}, nil
+	}
+	requests := []*job.JobRequest{{Stdin: "Finished"}, {Stdin: "Finished"}, {Stdin: "Compile Error"}, {Stdin: "fail"}, {Stdin: "Finished"}}
+
+	var results atomic.Int32
+	stats := Run(context.Background(), submit, requests, &Options{
+		Concurrency: 2,
+		OnResult:    func(*Result) { results.Add(1) },
+	})
+	if stats.Jobs != 5 || stats.Failures != 1 || int(results.Load()) != 5 {
+		t.Errorf("jobs = %d, failures = %d, results = %d", stats.Jobs, stats.Failures, results.Load())
+	}
+	if stats.Verdicts["Finished"] != 3 || stats.Verdicts["Compile Error"] != 1 {
+		t.Errorf("verdicts = %v", stats.Verdicts)
+	}
+	if maxRunning.Load() != 2 {
+		t.Errorf("%d jobs ran at once, want 2", maxRunning.Load())
+	}
+	if len(stats.Latencies) != 4 || stats.Throughput() <= 0 {
+		t.Errorf("latencies = %v, throughput = %f", stats.Latencies, stats.Throughput())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	stats := &Stats{}
+	for i := 1; i <= 100; i++ {
+		stats.Latencies = append(stats.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{0: time.Millisecond, 50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := stats.Percentile(p); got != want {
+			t.Errorf("p%v = %v, want %v", p, got, want)
+		}
+	}
+	if got := (&Stats{}).Percentile(50); got != 0 {
+		t.Errorf("percentile without jobs = %v", got)
+	}
+}
+
+func TestReadRequests(t *testing.T) {
+	err, requests := ReadRequests(strings.NewReader(`{"runScript": "a"}
+
+{"run_script": "b", "stdin": "x"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[0].RunScript != "a" || requests[1].Stdin != "x" {
+		t.Errorf("requests = %v", requests)
+	}
+
+	err, _ = ReadRequests(strings.NewReader("{\"runScript\": \"a\"}\n{\"runScript\": 1}\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("error = %v, want one naming line 2", err)
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	submit := func(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
+		time.Sleep(time.Millisecond)
+		if request.Stdin == "fail" {
+			return nil, status.Error(codes.ResourceExhausted, "queue full")
+		}
+		return &job.JobResponse{Status: "Finished", Phases: []*job.PhaseTiming{{Name: "queue", Duration: 2}, {Name: "run", Duration: 5}}}, nil
+	}
+	requests := []*job.JobRequest{{}, {Stdin: "fail"}}
+
+	stats := Run(context.Background(), submit, requests, &Options{Concurrency: 2, Duration: 50 * time.Millisecond})
+	if stats.Jobs <= len(requests) {
+		t.Errorf("%d jobs ran, want the requests submitted more than once", stats.Jobs)
+	}
+	if stats.Errors[codes.ResourceExhausted.String()] != stats.Failures || stats.Failures == 0 {
+		t.Errorf("errors = %v, failures = %d", stats.Errors, stats.Failures)
+	}
+	if len(stats.Phases["queue"]) != stats.Jobs-stats.Failures || stats.Phases["run"][0] != 5*time.Millisecond {
+		t.Errorf("phases = %v", stats.Phases)
+	}
+}
@@ -0,0 +1,149 @@
+package loadgen
+
+import (
+	"ExecutionEngine/proto/job"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"math/rand/v2"
+	"slices"
+)
+
+// Kind is a kind of job of a mix, drawn with a probability proportional to
+// its weight.
+type Kind struct {
+	Name    string
+	Weight  int
+	Request *job.JobRequest
+}
+
+type Mix []Kind
+
+// Kinds of jobs the default image can run.
+var (
+	kindHello = Kind{Name: "hello", Request: &job.JobRequest{
+		SourceCodeFileName: "main.py",
+		SourceCode:         "print('hello')\n",
+		RunScript:          "python3 main.py",
+	}}
+	kindCPU = Kind{Name: "cpu", Request: &job.JobRequest{
+		SourceCodeFileName: "main.py",
+		SourceCode:         "print(sum(i * i for i in range(3_000_000)))\n",
+		RunScript:          "python3 main.py",
+	}}
+	kindCompile = Kind{Name: "compile", Request: &job.JobRequest{
+		SourceCodeFileName: "main.c",
+		SourceCode:         "#include <stdio.h>\nint main(void) { int n; if (scanf(\"%d\", &n) == 1) printf(\"%d\\n\", n * n); return 0; }\n",
+		CompileScript:      "gcc -O2 -o main main.c",
+		RunScript:          "./main",
+		Stdin:              "12\n",
+	}}
+	kindMemory = Kind{Name: "memory", Request: &job.JobRequest{
+		SourceCodeFileName: "main.py",
+		SourceCode:         "data = bytearray(96 << 20)\nprint(len(data))\n",
+		RunScript:          "python3 main.py",
+	}}
+	kindTimeout = Kind{Name: "timeout", Request: &job.JobRequest{
+		SourceCodeFileName: "main.py",
+		SourceCode:         "while True:\n    pass\n",
+		RunScript:          "python3 main.py",
+		ResourceLimits:     &job.ResourceLimits{MaxExecutionTime: 500},
+	}}
+)
+
+func weighted(kind Kind, weight int) Kind {
+	kind.Weight = weight
+	return kind
+}
+
+var builtinMixes = map[string]Mix{
+	"hello":   {weighted(kindHello, 1)},
+	"cpu":     {weighted(kindCPU, 1)},
+	"compile": {weighted(kindCompile, 1)},
+	"mixed": {
+		weighted(kindHello, 5),
+		weighted(kindCPU, 2),
+		weighted(kindCompile, 2),
+		weighted(kindMemory, 1),
+		weighted(kindTimeout, 1),
+	},
+}
+
+// BuiltinMix returns the mix called name.
+func BuiltinMix(name string) (Mix, bool) {
+	mix, ok := builtinMixes[name]
+	return mix, ok
+}
+
+// BuiltinMixNames returns the names of the built-in mixes, sorted.
+func BuiltinMixNames() []string {
+	var names []string
+	for name := range builtinMixes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ReadMix parses a JSON array of objects with a name, a weight and a request
+// in protobuf JSON.
+func ReadMix(r io.Reader) (error, Mix) {
+	var kinds []struct {
+		Name    string          `json:"name"`
+		Weight  int             `json:"weight"`
+		Request json.RawMessage `json:"request"`
+	}
+	if err := json.NewDecoder(r).Decode(&kinds); err != nil {
+		return err, nil
+	}
+
+	var mix Mix
+	for i, kind := range kinds {
+		request := &job.JobRequest{}
+		if err := protojson.Unmarshal(kind.Request, request); err != nil {
+			return fmt.Errorf("request of job %d: %w", i+1, err), nil
+		}
+		if kind.Name == "" {
+			kind.Name = fmt.Sprintf("job-%d", i+1)
+		}
+		mix = append(mix, Kind{Name: kind.Name, Weight: kind.Weight, Request: request})
+	}
+	return mix.validate(), mix
+}
+
+func (m Mix) validate() error {
+	if len(m) == 0 {
+		return errors.New("the mix has no jobs")
+	}
+	for _, kind := range m {
+		if kind.Weight <= 0 {
+			return fmt.Errorf("job %s of the mix needs a positive weight", kind.Name)
+		}
+	}
+	return nil
+}
+
+// Requests draws n requests from the mix, random decides which. The requests
+// are copies that can be modified.
+func (m Mix) Requests(n int, random *rand.Rand) []*job.JobRequest {
+	total := 0
+	for _, kind := range m {
+		total += kind.Weight
+	}
+
+	requests := make([]*job.JobRequest, n)
+	for i := range requests {
+		draw := random.IntN(total)
+		for _, kind := range m {
+			if draw < kind.Weight {
+				requests[i] = proto.Clone(kind.Request).(*job.JobRequest)
+				break
+			}
+			draw -= kind.Weight
+		}
+	}
+	return requests
+}
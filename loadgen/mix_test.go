@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestMixRequests(t *testing.T) {
+	mix := Mix{
+		{Name: "a", Weight: 3, Request: kindHello.Request},
+		{Name: "b", Weight: 1, Request: kindCPU.Request},
+	}
+	requests := mix.Requests(4000, rand.New(rand.NewPCG(1, 0)))
+	hello := 0
+	for _, request := range requests {
+		if request.SourceCode == kindHello.Request.SourceCode {
+			hello++
+		}
+	}
+	if hello < 2800 || hello > 3200 {
+		t.Errorf("%d of 4000 requests are of the kind weighted 3 out of 4", hello)
+	}
+
+	requests[0].Stdin = "changed"
+	if kindHello.Request.Stdin != "" || kindCPU.Request.Stdin != "" {
+		t.Error("modifying a request changed the mix")
+	}
+}
+
+func TestBuiltinMixes(t *testing.T) {
+	for _, name := range BuiltinMixNames() {
+		mix, ok := BuiltinMix(name)
+		if !ok {
+			t.Fatalf("mix %s is listed but missing", name)
+		}
+		if err := mix.validate(); err != nil {
+			t.Errorf("mix %s: %v", name, err)
+		}
+	}
+	if _, ok := BuiltinMix("unknown"); ok {
+		t.Error("found an unknown mix")
+	}
+}
+
+func TestReadMix(t *testing.T) {
+	err, mix := ReadMix(strings.NewReader(`[
+		{"name": "hello", "weight": 2, "request": {"runScript": "echo hello"}},
+		{"weight": 1, "request": {"run_script": "true"}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mix) != 2 || mix[0].Name != "hello" || mix[0].Weight != 2 || mix[0].Request.RunScript != "echo hello" || mix[1].Name != "job-2" {
+		t.Errorf("mix = %v", mix)
+	}
+
+	for input, want := range map[string]string{
+		`[]`:                             "no jobs",
+		`[{"name": "a", "request": {}}]`: "positive weight",
+		`[{"weight": 1, "request": {"runScript": 1}}]`: "request of job 1",
+		`{"name": "a"}`: "cannot unmarshal",
+	} {
+		if err, _ := ReadMix(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error for %s = %v, want one containing %q", input, err, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package loadgen
+
+import (
+	"ExecutionEngine/container"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// reportPhases are the phases of the CSV report, in the order jobs go
+// through them.
+var reportPhases = []string{container.PhaseQueue, container.PhasePrepare, container.PhaseSetup, container.PhaseCompile, container.PhaseRun}
+
+// Report is the outcome of a benchmark in a form meant to be compared across
+// runs.
+type Report struct {
+	StartedAt time.Time `json:"started_at"`
+	// Target is "in-process" or the address of the engine
+	Target string `json:"target"`
+	Mix    string `json:"mix"`
+	// Workers is the size of the worker pool, only known in process
+	Workers     int `json:"workers,omitempty"`
+	Concurrency int `json:"concurrency"`
+
+	Jobs            int                `json:"jobs"`
+	Failures        int                `json:"failures"`
+	FailureRate     float64            `json:"failure_rate"`
+	Errors          map[string]int     `json:"errors"`
+	Verdicts        map[string]int     `json:"verdicts"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	Throughput      float64            `json:"throughput"`
+	Latency         Latency            `json:"latency"`
+	Phases          map[string]Latency `json:"phases"`
+}
+
+// Latency summarizes durations in milliseconds.
+type Latency struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+func summarize(sorted []time.Duration) Latency {
+	if len(sorted) == 0 {
+		return Latency{}
+	}
+	var total time.Duration
+	for _, duration := range sorted {
+		total += duration
+	}
+	milliseconds := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return Latency{
+		Count: len(sorted),
+		Mean:  milliseconds(total / time.Duration(len(sorted))),
+		P50:   milliseconds(percentile(sorted, 50)),
+		P90:   milliseconds(percentile(sorted, 90)),
+		P99:   milliseconds(percentile(sorted, 99)),
+		Max:   milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+// NewReport fills the results of a report from stats, the caller sets what
+// was benchmarked.
+func NewReport(stats *Stats) *Report {
+	report := &Report{
+		Jobs:            stats.Jobs,
+		Failures:        stats.Failures,
+		Errors:          stats.Errors,
+		Verdicts:        stats.Verdicts,
+		DurationSeconds: stats.Duration.Seconds(),
+		Throughput:      stats.Throughput(),
+		Latency:         summarize(stats.Latencies),
+		Phases:          map[string]Latency{},
+	}
+	if stats.Jobs > 0 {
+		report.FailureRate = float64(stats.Failures) / float64(stats.Jobs)
+	}
+	for phase, durations := range stats.Phases {
+		report.Phases[phase] = summarize(durations)
+	}
+	return report
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes a single row, preceded by the header when header is set,
+// so that the rows of several runs can be collected in one file.
+func (r *Report) WriteCSV(w io.Writer, header bool) error {
+	columns := []string{"started_at", "target", "mix", "workers", "concurrency", "jobs", "failures", "failure_rate", "duration_seconds", "throughput",
+		"latency_mean_ms", "latency_p50_ms", "latency_p90_ms", "latency_p99_ms", "latency_max_ms"}
+	for _, phase := range reportPhases {
+		columns = append(columns, phase+"_p50_ms", phase+"_p99_ms")
+	}
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 3, 64)
+	}
+	row := []string{
+		r.StartedAt.UTC().Format(time.RFC3339),
+		r.Target,
+		r.Mix,
+		strconv.Itoa(r.Workers),
+		strconv.Itoa(r.Concurrency),
+		strconv.Itoa(r.Jobs),
+		strconv.Itoa(r.Failures),
+		format(r.FailureRate),
+		format(r.DurationSeconds),
+		format(r.Throughput),
+		format(r.Latency.Mean),
+		format(r.Latency.P50),
+		format(r.Latency.P90),
+		format(r.Latency.P99),
+		format(r.Latency.Max),
+	}
+	for _, phase := range reportPhases {
+		row = append(row, format(r.Phases[phase].P50), format(r.Phases[phase].P99))
+	}
+
+	writer := csv.NewWriter(w)
+	if header {
+		writer.Write(columns)
+	}
+	writer.Write(row)
+	writer.Flush()
+	return writer.Error()
+}
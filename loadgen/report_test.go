@@ -0,0 +1,63 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	stats := &Stats{
+		Jobs:      4,
+		Failures:  1,
+		Verdicts:  map[string]int{"Finished": 3},
+		Errors:    map[string]int{"Unavailable": 1},
+		Duration:  2 * time.Second,
+		Latencies: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond},
+		Phases:    map[string][]time.Duration{"run": {4 * time.Millisecond, 8 * time.Millisecond}},
+	}
+	report := NewReport(stats)
+	report.Target = "in-process"
+	report.Mix = "hello"
+	if report.FailureRate != 0.25 || report.Throughput != 1.5 {
+		t.Errorf("failure rate = %v, throughput = %v", report.FailureRate, report.Throughput)
+	}
+	if failed := NewReport(&Stats{Jobs: 4, Failures: 4, Duration: 2 * time.Second}); failed.Throughput != 0 {
+		t.Errorf("throughput of failed jobs = %v, want 0", failed.Throughput)
+	}
+	if report.Latency != (Latency{Count: 3, Mean: 20, P50: 20, P90: 30, P99: 30, Max: 30}) {
+		t.Errorf("latency = %+v", report.Latency)
+	}
+	if report.Phases["run"].Max != 8 {
+		t.Errorf("phases = %+v", report.Phases)
+	}
+
+	var buffer bytes.Buffer
+	if err := report.WriteJSON(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Jobs != 4 || decoded.Errors["Unavailable"] != 1 || decoded.Phases["run"].P50 != 4 {
+		t.Errorf("decoded report = %+v", decoded)
+	}
+
+	buffer.Reset()
+	if err := report.WriteCSV(&buffer, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.WriteCSV(&buffer, false); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "started_at" || rows[1][1] != "in-process" || rows[1][5] != "4" {
+		t.Errorf("rows = %v", rows)
+	}
+}
@@ -0,0 +1,136 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+type Options struct {
+	// Format is "json" or "console", empty keeps the default of the build
+	Format string
+	// Level is a zap level such as "debug" or "info", empty keeps the
+	// default of the build
+	Level string
+}
+
+type contextKey struct{}
+
+var level = zap.NewAtomicLevelAt(defaultLevel)
+var logger atomic.Pointer[zap.Logger]
+var format atomic.Value
+
+func init() {
+	logger.Store(newLogger(defaultFormat))
+	format.Store(defaultFormat)
+}
+
+// L returns the global logger, prefer FromContext inside jobs.
+func L() *zap.Logger {
+	return logger.Load()
+}
+
+// Configure replaces the global logger. Loggers derived earlier keep their
+// format but follow level changes.
+func Configure(options *Options) error {
+	newFormat := options.Format
+	if newFormat == "" {
+		newFormat = defaultFormat
+	}
+	if newFormat != FormatJSON && newFormat != FormatConsole {
+		return fmt.Errorf("log format must be %q or %q", FormatJSON, FormatConsole)
+	}
+	if options.Level != "" {
+		if err := SetLevel(options.Level); err != nil {
+			return err
+		}
+	} else {
+		level.SetLevel(defaultLevel)
+	}
+
+	logger.Store(newLogger(newFormat))
+	format.Store(newFormat)
+	return nil
+}
+
+// Configured reports whether the global logger already has the format and
+// level Configure would give it.
+func Configured(options *Options) bool {
+	wantedFormat, wantedLevel := options.Format, defaultLevel
+	if wantedFormat == "" {
+		wantedFormat = defaultFormat
+	}
+	if options.Level != "" {
+		parsed, err := zapcore.ParseLevel(options.Level)
+		if err != nil {
+			return false
+		}
+		wantedLevel = parsed
+	}
+	return wantedFormat == Format() && wantedLevel == level.Level()
+}
+
+// SetLevel changes the level of all loggers at once.
+func SetLevel(name string) error {
+	parsed, err := zapcore.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(parsed)
+	return nil
+}
+
+func Level() string {
+	return level.Level().String()
+}
+
+// Format returns the format of the global logger.
+func Format() string {
+	return format.Load().(string)
+}
+
+// WithContext returns a copy of ctx carrying logger.
+func WithContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// With returns a copy of ctx whose logger adds fields to every entry.
+func With(ctx context.Context, fields ...zap.Field) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(fields...))
+}
+
+// FromContext returns the logger carried by ctx, or the global logger.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return L()
+}
+
+func newLogger(format string) *zap.Logger {
+	var encoder zapcore.Encoder
+	if format == FormatJSON {
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewConsoleEncoder(consoleEncoderConfig())
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), level)
+	return zap.New(core, buildOptions...)
+}
+
+// durationEncoder prints durations like 1.5s instead of a float.
+func durationEncoder(duration time.Duration, encoder zapcore.PrimitiveArrayEncoder) {
+	encoder.AppendString(duration.String())
+}
@@ -4,14 +4,14 @@ package log
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-var logger *zap.Logger
+const defaultFormat = FormatConsole
+const defaultLevel = zapcore.DebugLevel
 
-func init() {
-	logger = zap.Must(zap.NewDevelopment())
-}
+var buildOptions = []zap.Option{zap.Development(), zap.AddCaller(), zap.AddStacktrace(zapcore.WarnLevel)}
 
-func L() *zap.Logger {
-	return logger
+func consoleEncoderConfig() zapcore.EncoderConfig {
+	return zap.NewDevelopmentEncoderConfig()
 }
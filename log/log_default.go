@@ -0,0 +1,22 @@
+//go:build !debug && !release
+
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Builds without a debug or release tag log structured entries meant for
+// log collectors.
+const defaultFormat = FormatJSON
+const defaultLevel = zapcore.InfoLevel
+
+var buildOptions = []zap.Option{zap.AddCaller()}
+
+func consoleEncoderConfig() zapcore.EncoderConfig {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeDuration = durationEncoder
+	return encoderConfig
+}
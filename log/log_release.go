@@ -9,24 +9,20 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-var logger *zap.Logger
+const defaultFormat = FormatConsole
+const defaultLevel = zapcore.InfoLevel
 
-func init() {
-	logConfig := zap.NewProductionConfig()
-	logConfig.Encoding = "console"
-	logConfig.EncoderConfig.LevelKey = ""
-	logConfig.EncoderConfig.CallerKey = ""
-	logConfig.EncoderConfig.FunctionKey = ""
-	logConfig.EncoderConfig.StacktraceKey = ""
-	logConfig.EncoderConfig.EncodeTime = func(time time.Time, encoder zapcore.PrimitiveArrayEncoder) {
+var buildOptions = []zap.Option{}
+
+func consoleEncoderConfig() zapcore.EncoderConfig {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.LevelKey = ""
+	encoderConfig.CallerKey = ""
+	encoderConfig.FunctionKey = ""
+	encoderConfig.StacktraceKey = ""
+	encoderConfig.EncodeTime = func(time time.Time, encoder zapcore.PrimitiveArrayEncoder) {
 		encoder.AppendString(time.Format("15:04:05.000"))
 	}
-	logConfig.EncoderConfig.EncodeDuration = func(Duration time.Duration, encoder zapcore.PrimitiveArrayEncoder) {
-		encoder.AppendString(Duration.String())
-	}
-	logger = zap.Must(logConfig.Build())
-}
-
-func L() *zap.Logger {
-	return logger
+	encoderConfig.EncodeDuration = durationEncoder
+	return encoderConfig
 }
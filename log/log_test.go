@@ -0,0 +1,80 @@
+package log
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != L() {
+		t.Error("context without logger does not fall back to the global logger")
+	}
+
+	core, entries := observer.New(zapcore.DebugLevel)
+	ctx := WithContext(context.Background(), zap.New(core))
+	ctx = With(ctx, zap.String("jobID", "job-1"))
+	ctx = With(ctx, zap.String("containerID", "sandbox-1"))
+	FromContext(ctx).Info("Running job")
+
+	logged := entries.All()
+	if len(logged) != 1 {
+		t.Fatalf("%d entries logged, want 1", len(logged))
+	}
+	fields := logged[0].ContextMap()
+	if fields["jobID"] != "job-1" || fields["containerID"] != "sandbox-1" {
+		t.Errorf("fields = %v, want job and container IDs", fields)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	previousLevel := Level()
+	t.Cleanup(func() { SetLevel(previousLevel) })
+
+	if err := SetLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	if Level() != "warn" || L().Core().Enabled(zapcore.InfoLevel) {
+		t.Errorf("level = %s, info entries enabled = %v", Level(), L().Core().Enabled(zapcore.InfoLevel))
+	}
+	if err := SetLevel("loud"); err == nil {
+		t.Error("unknown level was accepted")
+	}
+	if Level() != "warn" {
+		t.Errorf("level = %s after a failed change, want warn", Level())
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	previousLevel := Level()
+	t.Cleanup(func() {
+		Configure(&Options{Level: previousLevel})
+	})
+
+	if err := Configure(&Options{Format: "xml"}); err == nil {
+		t.Error("unknown format was accepted")
+	}
+	if err := Configure(&Options{Format: FormatJSON, Level: "error"}); err != nil {
+		t.Fatal(err)
+	}
+	if Level() != "error" {
+		t.Errorf("level = %s, want error", Level())
+	}
+	if !Configured(&Options{Format: FormatJSON, Level: "error"}) {
+		t.Error("logger does not follow the options it was configured with")
+	}
+
+	// A level changed since follows the options no more
+	SetLevel("warn")
+	if Configured(&Options{Format: FormatJSON, Level: "error"}) {
+		t.Error("logger still follows the options after a level change")
+	}
+	if err := Configure(&Options{Format: FormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if Level() != defaultLevel.String() || !Configured(&Options{Format: FormatJSON}) {
+		t.Errorf("level = %s without one in the options, want the default %s", Level(), defaultLevel)
+	}
+}
@@ -1,9 +1,118 @@
 package main
 
-import server "ExecutionEngine/server"
+import (
+	"ExecutionEngine/config"
+	"ExecutionEngine/log"
+	server "ExecutionEngine/server"
+	"flag"
+	"fmt"
+	"github.com/docker/docker/pkg/reexec"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// overrides collects repeated -set flags.
+type overrides []string
+
+func (o *overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
 
 func main() {
-	s := server.NewServer()
+	// The native runtime starts job processes through this binary
+	if reexec.Init() {
+		return
+	}
+
+	var settings overrides
+	configPath := flag.String("config", "", "path to the YAML or TOML configuration file")
+	flag.Var(&settings, "set", "override a setting as key=value, e.g. pool.workers=4 (repeatable)")
+	listenAddress := flag.String("listen-address", "", "address of the gRPC server, overrides server.listen_address")
+	workers := flag.Int("workers", 0, "number of concurrent jobs, overrides pool.workers")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [dump-config | benchmark [benchmark flags]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *listenAddress != "" {
+		settings = append(settings, "server.listen_address="+*listenAddress)
+	}
+	if *workers != 0 {
+		settings = append(settings, "pool.workers="+strconv.Itoa(*workers))
+	}
+
+	err, cfg := config.Load(*configPath, settings)
+	if err != nil {
+		log.L().Fatal("Cannot load configuration", zap.Error(err))
+	}
+
+	if err := log.Configure(&log.Options{Format: cfg.Log.Format, Level: cfg.Log.Level}); err != nil {
+		log.L().Fatal("Cannot configure logger", zap.Error(err))
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "benchmark":
+		if err := benchmark(cfg, flag.Args()[1:]); err != nil {
+			log.L().Fatal("Benchmark failed", zap.Error(err))
+		}
+		return
+	case "dump-config":
+		err, content := cfg.Dump()
+		if err != nil {
+			log.L().Fatal("Cannot dump configuration", zap.Error(err))
+		}
+		os.Stdout.Write(content)
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s := server.NewServer(cfg)
 	s.Initialize()
+	go reloadOnHangup(s, *configPath, settings)
+	go drainOnTermination(s)
 	s.Serve()
 }
+
+// drainOnTermination drains the server on SIGTERM or SIGINT, a second signal
+// exits immediately.
+func drainOnTermination(s *server.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+	go func() {
+		<-signals
+		log.L().Fatal("Terminated while draining")
+	}()
+	s.Drain()
+}
+
+// reloadOnHangup re-reads the configuration file whenever SIGHUP is received,
+// the environment and flags still take precedence.
+func reloadOnHangup(s *server.Server, configPath string, settings []string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.L().Info("Reloading configuration", zap.String("configPath", configPath))
+		err, cfg := config.Load(configPath, settings)
+		if err != nil {
+			log.L().Error("Cannot reload configuration", zap.Error(err))
+			continue
+		}
+		if err := s.Reload(cfg); err != nil {
+			log.L().Error("Cannot apply reloaded configuration", zap.Error(err))
+		}
+	}
+}
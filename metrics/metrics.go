@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"ExecutionEngine/proto/job"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "execution_engine"
+
+// statusError labels jobs that failed without a verdict.
+const statusError = "error"
+
+// PoolStatistics is the part of a worker pool that is exported as gauges.
+type PoolStatistics interface {
+	WorkerCount() int
+	TaskCount() int
+	BusyWorkers() int
+}
+
+// Metrics owns a registry, so that several servers in one process do not
+// share their metrics.
+type Metrics struct {
+	registry       *prometheus.Registry
+	jobs           *prometheus.CounterVec
+	phaseDurations *prometheus.HistogramVec
+	runtimeErrors  *prometheus.CounterVec
+	liveSandboxes  prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_total",
+			Help:      "Finished jobs by verdict.",
+		}, []string{"status"}),
+		phaseDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Duration of the phases of jobs, including the wait in the queue.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"phase"}),
+		runtimeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runtime_errors_total",
+			Help:      "Failed calls to the container runtime by operation.",
+		}, []string{"operation"}),
+		liveSandboxes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "live_sandboxes",
+			Help:      "Sandboxes created and not yet removed, including warm ones.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.jobs,
+		m.phaseDurations,
+		m.runtimeErrors,
+		m.liveSandboxes,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterPool exports the state of pool, which is read on every scrape.
+func (m *Metrics) RegisterPool(pool PoolStatistics) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "workers",
+			Help:      "Workers of the job pool.",
+		}, func() float64 { return float64(pool.WorkerCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "busy_workers",
+			Help:      "Workers currently running a job.",
+		}, func() float64 { return float64(pool.BusyWorkers()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_depth",
+			Help:      "Jobs waiting for a free worker.",
+		}, func() float64 { return float64(pool.TaskCount() - pool.BusyWorkers()) }),
+	)
+}
+
+// ObserveJob counts a finished job and records the durations of its phases.
+// response is nil when the job failed without a verdict.
+func (m *Metrics) ObserveJob(response *job.JobResponse) {
+	if response == nil {
+		m.jobs.WithLabelValues(statusError).Inc()
+		return
+	}
+	m.jobs.WithLabelValues(response.Status).Inc()
+	for _, phase := range response.Phases {
+		m.phaseDurations.WithLabelValues(phase.Name).Observe(float64(phase.Duration) / 1000)
+	}
+}
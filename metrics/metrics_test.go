@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"ExecutionEngine/container"
+	"ExecutionEngine/container/fake"
+	"ExecutionEngine/proto/job"
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type poolStub struct {
+	workers, tasks, busy int
+}
+
+func (p *poolStub) WorkerCount() int { return p.workers }
+func (p *poolStub) TaskCount() int   { return p.tasks }
+func (p *poolStub) BusyWorkers() int { return p.busy }
+
+func TestObserveJob(t *testing.T) {
+	m := New()
+	m.ObserveJob(&job.JobResponse{
+		Status: container.StatusFinished,
+		Phases: []*job.PhaseTiming{
+			{Name: container.PhaseQueue, Duration: 20},
+			{Name: container.PhaseRun, Duration: 1500},
+		},
+	})
+	m.ObserveJob(&job.JobResponse{Status: container.StatusCompileError})
+	m.ObserveJob(nil)
+
+	for status, want := range map[string]float64{container.StatusFinished: 1, container.StatusCompileError: 1, statusError: 1} {
+		if got := testutil.ToFloat64(m.jobs.WithLabelValues(status)); got != want {
+			t.Errorf("jobs with status %q = %v, want %v", status, got, want)
+		}
+	}
+	if count := testutil.CollectAndCount(m.phaseDurations); count != 2 {
+		t.Errorf("%d phase histograms, want 2", count)
+	}
+}
+
+func TestRegisterPool(t *testing.T) {
+	m := New()
+	m.RegisterPool(&poolStub{workers: 4, tasks: 7, busy: 4})
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"execution_engine_workers 4", "execution_engine_busy_workers 4", "execution_engine_queue_depth 3"} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics do not contain %q", line)
+		}
+	}
+}
+
+func TestInstrumentRuntime(t *testing.T) {
+	m := New()
+	inner := fake.NewRuntime()
+	runtime := m.InstrumentRuntime(inner)
+	ctx := context.Background()
+
+	err, sandboxID := runtime.Create(ctx, &container.SandboxSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.Create(ctx, &container.SandboxSpec{})
+	if got := testutil.ToFloat64(m.liveSandboxes); got != 2 {
+		t.Errorf("live sandboxes = %v, want 2", got)
+	}
+	runtime.Remove(ctx, sandboxID)
+	if got := testutil.ToFloat64(m.liveSandboxes); got != 1 {
+		t.Errorf("live sandboxes = %v, want 1", got)
+	}
+
+	inner.FailNext(fake.OperationCreate, 2)
+	runtime.Create(ctx, &container.SandboxSpec{})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	runtime.Create(cancelled, &container.SandboxSpec{})
+	if got := testutil.ToFloat64(m.runtimeErrors.WithLabelValues(operationCreate)); got != 1 {
+		t.Errorf("create errors = %v, want 1 as cancelled calls are not counted", got)
+	}
+	if got := testutil.ToFloat64(m.liveSandboxes); got != 1 {
+		t.Errorf("live sandboxes = %v after failed creates, want 1", got)
+	}
+}
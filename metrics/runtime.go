@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"ExecutionEngine/container"
+	"context"
+	"io"
+)
+
+// Runtime operations counted by runtime_errors_total.
+const (
+	operationCreate   = "create"
+	operationStart    = "start"
+	operationCopyTo   = "copy_to"
+	operationCopyFrom = "copy_from"
+	operationExec     = "exec"
+	operationInspect  = "inspect"
+	operationKill     = "kill"
+	operationRemove   = "remove"
+	operationImageID  = "image_id"
+)
+
+type instrumentedRuntime struct {
+	inner   container.Runtime
+	metrics *Metrics
+}
+
+// InstrumentRuntime counts the failed calls and live sandboxes of inner.
+// Calls failing because their context is done are not counted.
+func (m *Metrics) InstrumentRuntime(inner container.Runtime) container.Runtime {
+	return &instrumentedRuntime{
+		inner:   inner,
+		metrics: m,
+	}
+}
+
+func (r *instrumentedRuntime) Create(ctx context.Context, spec *container.SandboxSpec) (error, string) {
+	err, sandboxID := r.inner.Create(ctx, spec)
+	if r.observe(ctx, operationCreate, err) {
+		r.metrics.liveSandboxes.Inc()
+	}
+	return err, sandboxID
+}
+
+func (r *instrumentedRuntime) Start(ctx context.Context, sandboxID string) error {
+	err := r.inner.Start(ctx, sandboxID)
+	r.observe(ctx, operationStart, err)
+	return err
+}
+
+func (r *instrumentedRuntime) CopyTo(ctx context.Context, sandboxID, path string, archive io.Reader) error {
+	err := r.inner.CopyTo(ctx, sandboxID, path, archive)
+	r.observe(ctx, operationCopyTo, err)
+	return err
+}
+
+func (r *instrumentedRuntime) CopyFrom(ctx context.Context, sandboxID, path string) (error, io.ReadCloser) {
+	err, archive := r.inner.CopyFrom(ctx, sandboxID, path)
+	r.observe(ctx, operationCopyFrom, err)
+	return err, archive
+}
+
+func (r *instrumentedRuntime) Exec(ctx context.Context, sandboxID string, options *container.ExecOptions) (error, *container.ExecResult) {
+	err, result := r.inner.Exec(ctx, sandboxID, options)
+	r.observe(ctx, operationExec, err)
+	return err, result
+}
+
+func (r *instrumentedRuntime) Inspect(ctx context.Context, sandboxID string) (error, *container.SandboxState) {
+	err, state := r.inner.Inspect(ctx, sandboxID)
+	r.observe(ctx, operationInspect, err)
+	return err, state
+}
+
+func (r *instrumentedRuntime) Kill(ctx context.Context, sandboxID string) error {
+	err := r.inner.Kill(ctx, sandboxID)
+	r.observe(ctx, operationKill, err)
+	return err
+}
+
+func (r *instrumentedRuntime) Remove(ctx context.Context, sandboxID string) error {
+	err := r.inner.Remove(ctx, sandboxID)
+	if r.observe(ctx, operationRemove, err) {
+		r.metrics.liveSandboxes.Dec()
+	}
+	return err
+}
+
+func (r *instrumentedRuntime) ImageID(ctx context.Context, image string) (error, string) {
+	err, imageID := r.inner.ImageID(ctx, image)
+	r.observe(ctx, operationImageID, err)
+	return err, imageID
+}
+
+// observe reports whether the call succeeded.
+func (r *instrumentedRuntime) observe(ctx context.Context, operation string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if ctx.Err() == nil {
+		r.metrics.runtimeErrors.WithLabelValues(operation).Inc()
+	}
+	return false
+}
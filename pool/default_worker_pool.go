@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 )
 
 type workerStatus uint
@@ -15,9 +16,13 @@ const (
 
 type defaultWorkerPool[I interface{}, O interface{}] struct {
 	workerCount   int
+	nextWorkerID  int
 	status        workerStatus
+	statusLock    sync.Mutex
 	taskQueue     chan *Task[I, O]
+	quitChannel   chan struct{}
 	taskCount     int
+	busyCount     int
 	taskCountLock sync.RWMutex
 	workerContext context.Context
 	workerCancel  context.CancelFunc
@@ -32,6 +37,7 @@ func NewDefaultWorkerPool[I interface{}, O interface{}](workerCount int) WorkerP
 		workerCount:   workerCount,
 		status:        statusStopped,
 		taskQueue:     make(chan *Task[I, O]),
+		quitChannel:   make(chan struct{}),
 		taskCount:     0,
 		taskCountLock: sync.RWMutex{},
 		workerContext: workerContext,
@@ -44,31 +50,56 @@ func NewDefaultWorkerPool[I interface{}, O interface{}](workerCount int) WorkerP
 }
 
 func (w *defaultWorkerPool[I, O]) Submit(task *Task[I, O]) error {
-	if w.status != statusStarted {
+	w.statusLock.Lock()
+	started := w.status == statusStarted
+	w.statusLock.Unlock()
+	if !started {
 		return errors.New("no new tasks are accepted for stopped or paused worker pool")
 	}
 
+	// The counter must not stay locked while waiting for a free worker,
+	// otherwise a finishing worker could never decrement it.
 	w.taskCountLock.Lock()
-	defer w.taskCountLock.Unlock()
-
-	w.taskQueue <- task
 	w.taskCount++
+	w.taskCountLock.Unlock()
+
+	select {
+	case w.taskQueue <- task:
+		return nil
+	case <-w.workerContext.Done():
+		w.cancelTask()
+		return errors.New("worker pool was stopped before the task could be scheduled")
+	case <-task.Context.Done():
+		w.cancelTask()
+		return task.Context.Err()
+	}
+}
 
-	return nil
+func (w *defaultWorkerPool[I, O]) cancelTask() {
+	w.taskCountLock.Lock()
+	defer w.taskCountLock.Unlock()
+
+	w.taskCount--
 }
 
 func (w *defaultWorkerPool[I, O]) Start() {
+	w.statusLock.Lock()
+	defer w.statusLock.Unlock()
+
 	if w.status != statusStopped {
 		return
 	}
 
-	for i := range w.workerCount {
-		go w.worker(i)
+	for range w.workerCount {
+		w.spawnWorker()
 	}
 	w.status = statusStarted
 }
 
 func (w *defaultWorkerPool[I, O]) Stop() {
+	w.statusLock.Lock()
+	defer w.statusLock.Unlock()
+
 	if w.status != statusStarted {
 		return
 	}
@@ -78,6 +109,44 @@ func (w *defaultWorkerPool[I, O]) Stop() {
 	w.status = statusStopped
 }
 
+func (w *defaultWorkerPool[I, O]) Resize(workerCount int) error {
+	if workerCount < 1 {
+		return errors.New("worker pool must have at least one worker")
+	}
+
+	w.statusLock.Lock()
+	defer w.statusLock.Unlock()
+
+	delta := workerCount - w.workerCount
+	w.workerCount = workerCount
+	if w.status != statusStarted {
+		return nil
+	}
+
+	for ; delta > 0; delta-- {
+		w.spawnWorker()
+	}
+	for ; delta < 0; delta++ {
+		// Whichever worker becomes idle first picks up the quit signal, so
+		// busy workers are never interrupted.
+		go func() {
+			select {
+			case w.quitChannel <- struct{}{}:
+			case <-w.workerContext.Done():
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (w *defaultWorkerPool[I, O]) WorkerCount() int {
+	w.statusLock.Lock()
+	defer w.statusLock.Unlock()
+
+	return w.workerCount
+}
+
 func (w *defaultWorkerPool[I, O]) OutputChannel() chan O {
 	return w.outputChannel
 }
@@ -93,14 +162,34 @@ func (w *defaultWorkerPool[I, O]) TaskCount() int {
 	return w.taskCount
 }
 
+func (w *defaultWorkerPool[I, O]) BusyWorkers() int {
+	w.taskCountLock.RLock()
+	defer w.taskCountLock.RUnlock()
+
+	return w.busyCount
+}
+
+// spawnWorker must be called with statusLock held.
+func (w *defaultWorkerPool[I, O]) spawnWorker() {
+	go w.worker(w.nextWorkerID)
+	w.nextWorkerID++
+}
+
 func (w *defaultWorkerPool[I, O]) worker(id int) {
 	for {
 		select {
 		case <-w.workerContext.Done():
 			return
+		case <-w.quitChannel:
+			return
 		case task := <-w.taskQueue:
-			w.outputChannel <- task.TaskFunction(task.Context, id, task.Input)
 			w.taskCountLock.Lock()
+			w.busyCount++
+			w.taskCountLock.Unlock()
+
+			w.outputChannel <- w.run(task, id)
+			w.taskCountLock.Lock()
+			w.busyCount--
 			w.taskCount--
 			if w.taskCount <= 0 {
 				go func() {
@@ -111,3 +200,23 @@ func (w *defaultWorkerPool[I, O]) worker(id int) {
 		}
 	}
 }
+
+func (w *defaultWorkerPool[I, O]) run(task *Task[I, O], workerID int) O {
+	for attempt := 1; ; attempt++ {
+		output := task.TaskFunction(withAttempt(task.Context, attempt), workerID, task.Input)
+		if task.Retry == nil || attempt >= task.Retry.MaxAttempts || !task.Retry.Retryable(output) {
+			return output
+		}
+
+		timer := time.NewTimer(task.Retry.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-task.Context.Done():
+			timer.Stop()
+			return output
+		case <-w.workerContext.Done():
+			timer.Stop()
+			return output
+		}
+	}
+}
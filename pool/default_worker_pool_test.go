@@ -0,0 +1,264 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe records how many tasks run at the same time.
+type concurrencyProbe struct {
+	running atomic.Int32
+	maximum atomic.Int32
+}
+
+func (p *concurrencyProbe) task(ctx context.Context, workerID int, input time.Duration) int {
+	running := p.running.Add(1)
+	for {
+		maximum := p.maximum.Load()
+		if running <= maximum || p.maximum.CompareAndSwap(maximum, running) {
+			break
+		}
+	}
+	time.Sleep(input)
+	p.running.Add(-1)
+	return workerID
+}
+
+func submitAll[I interface{}, O interface{}](t *testing.T, w WorkerPool[I, O], tasks []*Task[I, O]) []O {
+	t.Helper()
+
+	var wait sync.WaitGroup
+	for _, task := range tasks {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if err := w.Submit(task); err != nil {
+				t.Errorf("Submit returned error: %v", err)
+			}
+		}()
+	}
+
+	outputs := make([]O, 0, len(tasks))
+	for range tasks {
+		select {
+		case output := <-w.OutputChannel():
+			outputs = append(outputs, output)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d tasks finished", len(outputs), len(tasks))
+		}
+	}
+	wait.Wait()
+	return outputs
+}
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	tests := []struct {
+		workers int
+		tasks   int
+	}{
+		{1, 4},
+		{3, 12},
+		{8, 4},
+	}
+
+	for _, test := range tests {
+		probe := &concurrencyProbe{}
+		w := NewDefaultWorkerPool[time.Duration, int](test.workers)
+		w.Start()
+
+		tasks := make([]*Task[time.Duration, int], test.tasks)
+		for i := range tasks {
+			tasks[i] = &Task[time.Duration, int]{Context: context.Background(), TaskFunction: probe.task, Input: 20 * time.Millisecond}
+		}
+		submitAll(t, w, tasks)
+		w.Stop()
+
+		want := int32(min(test.workers, test.tasks))
+		if probe.maximum.Load() != want {
+			t.Errorf("%d workers, %d tasks: maximum concurrency = %d, want %d", test.workers, test.tasks, probe.maximum.Load(), want)
+		}
+		// Outputs are delivered before the task count is decremented
+		deadline := time.Now().Add(time.Second)
+		for w.TaskCount() != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if w.TaskCount() != 0 {
+			t.Errorf("task count = %d after all tasks finished", w.TaskCount())
+		}
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	probe := &concurrencyProbe{}
+	w := NewDefaultWorkerPool[time.Duration, int](1)
+	w.Start()
+	defer w.Stop()
+
+	newTasks := func(count int) []*Task[time.Duration, int] {
+		tasks := make([]*Task[time.Duration, int], count)
+		for i := range tasks {
+			tasks[i] = &Task[time.Duration, int]{Context: context.Background(), TaskFunction: probe.task, Input: 20 * time.Millisecond}
+		}
+		return tasks
+	}
+
+	if err := w.Resize(4); err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, w, newTasks(8))
+	if probe.maximum.Load() != 4 {
+		t.Errorf("maximum concurrency after growing = %d, want 4", probe.maximum.Load())
+	}
+
+	if err := w.Resize(2); err != nil {
+		t.Fatal(err)
+	}
+	// Let the surplus workers pick up their quit signals
+	time.Sleep(20 * time.Millisecond)
+	probe.maximum.Store(0)
+	submitAll(t, w, newTasks(8))
+	if probe.maximum.Load() != 2 {
+		t.Errorf("maximum concurrency after shrinking = %d, want 2", probe.maximum.Load())
+	}
+	if w.WorkerCount() != 2 {
+		t.Errorf("worker count = %d, want 2", w.WorkerCount())
+	}
+
+	if err := w.Resize(0); err == nil {
+		t.Error("Resize(0) succeeded, want an error")
+	}
+}
+
+func TestPoolShrinkKeepsRunningTasks(t *testing.T) {
+	w := NewDefaultWorkerPool[chan struct{}, int](3)
+	w.Start()
+	defer w.Stop()
+
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, workerID int, input chan struct{}) int {
+		<-input
+		return 1
+	}
+	tasks := make([]*Task[chan struct{}, int], 3)
+	for i := range tasks {
+		tasks[i] = &Task[chan struct{}, int]{Context: context.Background(), TaskFunction: blocked, Input: release}
+	}
+
+	go func() {
+		for w.TaskCount() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := w.Resize(1); err != nil {
+			t.Error(err)
+		}
+		close(release)
+	}()
+	outputs := submitAll(t, w, tasks)
+	if len(outputs) != 3 {
+		t.Errorf("%d tasks finished, want 3", len(outputs))
+	}
+}
+
+func TestPoolBusyWorkers(t *testing.T) {
+	w := NewDefaultWorkerPool[chan struct{}, int](2)
+	w.Start()
+	defer w.Stop()
+
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, workerID int, input chan struct{}) int {
+		<-input
+		return 1
+	}
+	tasks := make([]*Task[chan struct{}, int], 3)
+	for i := range tasks {
+		tasks[i] = &Task[chan struct{}, int]{Context: context.Background(), TaskFunction: blocked, Input: release}
+	}
+
+	go func() {
+		deadline := time.Now().Add(time.Second)
+		for (w.TaskCount() < 3 || w.BusyWorkers() < 2) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if w.TaskCount() != 3 || w.BusyWorkers() != 2 {
+			t.Errorf("task count = %d, busy workers = %d, want 3 and 2", w.TaskCount(), w.BusyWorkers())
+		}
+		close(release)
+	}()
+	submitAll(t, w, tasks)
+
+	deadline := time.Now().Add(time.Second)
+	for w.BusyWorkers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if w.BusyWorkers() != 0 {
+		t.Errorf("busy workers = %d after all tasks finished", w.BusyWorkers())
+	}
+}
+
+func TestPoolRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retryable    bool
+		maxAttempts  int
+		wantAttempts int
+	}{
+		{"succeeds first time", 0, true, 3, 1},
+		{"succeeds after retries", 2, true, 3, 3},
+		{"gives up after max attempts", 5, true, 3, 3},
+		{"permanent failures are not retried", 5, false, 3, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := NewDefaultWorkerPool[int, int](1)
+			w.Start()
+			defer w.Stop()
+
+			calls := 0
+			outputs := submitAll(t, w, []*Task[int, int]{{
+				Context: context.Background(),
+				TaskFunction: func(ctx context.Context, workerID int, input int) int {
+					calls++
+					if calls <= input {
+						return -Attempt(ctx)
+					}
+					return Attempt(ctx)
+				},
+				Input: test.failures,
+				Retry: &RetryPolicy[int]{
+					MaxAttempts:    test.maxAttempts,
+					InitialBackoff: time.Millisecond,
+					MaxBackoff:     2 * time.Millisecond,
+					Retryable: func(output int) bool {
+						return test.retryable && output < 0
+					},
+				},
+			}})
+
+			if calls != test.wantAttempts {
+				t.Errorf("task ran %d times, want %d", calls, test.wantAttempts)
+			}
+			attempt := outputs[0]
+			if attempt < 0 {
+				attempt = -attempt
+			}
+			if attempt != test.wantAttempts {
+				t.Errorf("last attempt = %d, want %d", attempt, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy[int]{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, backoff := range want {
+		if got := policy.backoff(i + 1); got != backoff {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, backoff)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy describes how often a task is re-run when its output reports a
+// transient failure. The backoff doubles after every attempt.
+type RetryPolicy[O interface{}] struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Retryable      func(output O) bool
+}
+
+type attemptContextKey struct{}
+
+// Attempt returns the 1-based attempt number of the task owning ctx.
+func Attempt(ctx context.Context) int {
+	attempt, ok := ctx.Value(attemptContextKey{}).(int)
+	if !ok {
+		return 1
+	}
+	return attempt
+}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptContextKey{}, attempt)
+}
+
+func (r *RetryPolicy[O]) backoff(attempt int) time.Duration {
+	backoff := r.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if r.MaxBackoff > 0 && backoff >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	return backoff
+}
@@ -15,13 +15,21 @@ type Task[I interface{}, O interface{}] struct {
 	Context      context.Context
 	TaskFunction TaskFunction[I, O]
 	Input        I
+	// Retry is optional, without it the task is run exactly once
+	Retry *RetryPolicy[O]
 }
 
 type WorkerPool[I interface{}, O interface{}] interface {
 	Submit(task *Task[I, O]) error
 	Start()
 	Stop()
+	// Resize grows or shrinks the pool to workerCount workers. Workers removed
+	// by a shrink finish the task they are running before they exit.
+	Resize(workerCount int) error
+	WorkerCount() int
 	OutputChannel() chan O
 	EventChannel() chan WorkerEvent
+	// TaskCount includes both queued tasks and the BusyWorkers running one
 	TaskCount() int
+	BusyWorkers() int
 }
@@ -0,0 +1,191 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+const (
+	ReasonRate        = "rate"
+	ReasonQueue       = "queued jobs"
+	ReasonDailyBudget = "daily CPU time"
+)
+
+// Limits bound the jobs of one client or tenant, zero values mean no limit.
+type Limits struct {
+	// Rate is the number of jobs per second that can be submitted on
+	// average, Burst how many can be submitted at once
+	Rate  float64
+	Burst int
+	// MaxConcurrentJobs bounds the jobs handed to the worker pool, further
+	// jobs wait for one of them to finish
+	MaxConcurrentJobs int
+	// MaxQueuedJobs bounds the jobs waiting because of MaxConcurrentJobs
+	MaxQueuedJobs int
+	// DailyCPUTime is the processor time the jobs can use per UTC day
+	DailyCPUTime time.Duration
+}
+
+// ExceededError rejects a job. RetryAfter is zero when it is not known when
+// the job would be admitted.
+type ExceededError struct {
+	Key        string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota of %s for %q exceeded", e.Reason, e.Key)
+}
+
+// Manager keeps the usage of every key in memory, usage starts over on
+// restart.
+type Manager struct {
+	lock    sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+type entry struct {
+	limiter *rate.Limiter
+	running int
+	waiting int
+	// finished is closed and replaced whenever a running job finishes
+	finished chan struct{}
+	day      time.Time
+	used     time.Duration
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		entries: map[string]*entry{},
+		now:     time.Now,
+	}
+}
+
+// Acquire admits a job of key, waiting while key has MaxConcurrentJobs jobs
+// running. The returned function must be called once the job is done with the
+// processor time it used.
+func (m *Manager) Acquire(ctx context.Context, key string, limits *Limits) (error, func(cpuTime time.Duration)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	e := m.entry(key, now)
+
+	if limits.DailyCPUTime > 0 && e.used >= limits.DailyCPUTime {
+		return &ExceededError{Key: key, Reason: ReasonDailyBudget, RetryAfter: e.day.AddDate(0, 0, 1).Sub(now)}, nil
+	}
+
+	var reservation *rate.Reservation
+	if limits.Rate > 0 {
+		limit, burst := rate.Limit(limits.Rate), max(limits.Burst, 1)
+		if e.limiter == nil {
+			e.limiter = rate.NewLimiter(limit, burst)
+		} else if e.limiter.Limit() != limit || e.limiter.Burst() != burst {
+			e.limiter.SetLimitAt(now, limit)
+			e.limiter.SetBurstAt(now, burst)
+		}
+		reservation = e.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return &ExceededError{Key: key, Reason: ReasonRate, RetryAfter: delay}, nil
+		}
+	} else {
+		e.limiter = nil
+	}
+
+	if limits.MaxConcurrentJobs > 0 && e.running >= limits.MaxConcurrentJobs {
+		if limits.MaxQueuedJobs > 0 && e.waiting >= limits.MaxQueuedJobs {
+			if reservation != nil {
+				reservation.CancelAt(now)
+			}
+			return &ExceededError{Key: key, Reason: ReasonQueue}, nil
+		}
+
+		e.waiting++
+		for e.running >= limits.MaxConcurrentJobs {
+			finished := e.finished
+			m.lock.Unlock()
+			select {
+			case <-finished:
+				m.lock.Lock()
+			case <-ctx.Done():
+				m.lock.Lock()
+				e.waiting--
+				return ctx.Err(), nil
+			}
+		}
+		e.waiting--
+	}
+
+	e.running++
+	var once sync.Once
+	return nil, func(executionTime time.Duration) {
+		once.Do(func() { m.release(e, executionTime) })
+	}
+}
+
+func (m *Manager) release(e *entry, executionTime time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e.rollOver(m.now())
+	e.used += executionTime
+	e.running--
+	close(e.finished)
+	e.finished = make(chan struct{})
+}
+
+// Usage returns the execution time key used today.
+func (m *Manager) Usage(key string) time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return 0
+	}
+	e.rollOver(m.now())
+	return e.used
+}
+
+// Prune forgets the keys without jobs, usage today and spent rate.
+func (m *Manager) Prune() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	for key, e := range m.entries {
+		e.rollOver(now)
+		if e.running > 0 || e.waiting > 0 || e.used > 0 {
+			continue
+		}
+		if e.limiter != nil && e.limiter.TokensAt(now) < float64(e.limiter.Burst()) {
+			continue
+		}
+		delete(m.entries, key)
+	}
+}
+
+func (m *Manager) entry(key string, now time.Time) *entry {
+	e, ok := m.entries[key]
+	if !ok {
+		e = &entry{finished: make(chan struct{})}
+		m.entries[key] = e
+	}
+	e.rollOver(now)
+	return e
+}
+
+// rollOver starts a new budget when the UTC day changed.
+func (e *entry) rollOver(now time.Time) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(e.day) {
+		e.day = day
+		e.used = 0
+	}
+}
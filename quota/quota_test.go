@@ -0,0 +1,172 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a manager whose clock only moves when the returned
+// function is called.
+func newTestManager() (*Manager, func(time.Duration)) {
+	m := NewManager()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func exceededReason(err error) string {
+	var exceeded *ExceededError
+	if errors.As(err, &exceeded) {
+		return exceeded.Reason
+	}
+	return ""
+}
+
+func TestRate(t *testing.T) {
+	m, advance := newTestManager()
+	limits := &Limits{Rate: 2, Burst: 2}
+
+	for i := range 2 {
+		err, release := m.Acquire(context.Background(), "a", limits)
+		if err != nil {
+			t.Fatalf("job %d: %v", i, err)
+		}
+		release(0)
+	}
+	err, _ := m.Acquire(context.Background(), "a", limits)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Reason != ReasonRate {
+		t.Fatalf("error = %v, want rate exceeded", err)
+	}
+	if exceeded.RetryAfter != 500*time.Millisecond {
+		t.Errorf("retry after %v, want 500ms", exceeded.RetryAfter)
+	}
+	if err, _ := m.Acquire(context.Background(), "b", limits); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+
+	advance(500 * time.Millisecond)
+	if err, _ := m.Acquire(context.Background(), "a", limits); err != nil {
+		t.Errorf("after waiting: %v", err)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	m, _ := newTestManager()
+	limits := &Limits{MaxConcurrentJobs: 1, MaxQueuedJobs: 1}
+
+	err, release := m.Acquire(context.Background(), "a", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan func(time.Duration))
+	go func() {
+		err, release := m.Acquire(context.Background(), "a", limits)
+		if err != nil {
+			t.Error(err)
+		}
+		admitted <- release
+	}()
+	for m.waiting("a") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err, _ := m.Acquire(context.Background(), "a", limits); exceededReason(err) != ReasonQueue {
+		t.Errorf("error = %v, want queue exceeded", err)
+	}
+	select {
+	case <-admitted:
+		t.Fatal("second job was admitted while the first one runs")
+	default:
+	}
+
+	release(0)
+	(<-admitted)(0)
+}
+
+func TestConcurrencyCancelled(t *testing.T) {
+	m, _ := newTestManager()
+	limits := &Limits{MaxConcurrentJobs: 1}
+
+	err, release := m.Acquire(context.Background(), "a", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err, _ := m.Acquire(ctx, "a", limits); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want DeadlineExceeded", err)
+	}
+	if waiting := m.waiting("a"); waiting != 0 {
+		t.Errorf("%d jobs still waiting", waiting)
+	}
+}
+
+func TestDailyBudget(t *testing.T) {
+	m, advance := newTestManager()
+	limits := &Limits{DailyCPUTime: time.Minute}
+
+	err, release := m.Acquire(context.Background(), "a", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(70 * time.Second)
+	release(70 * time.Second)
+	if used := m.Usage("a"); used != 70*time.Second {
+		t.Errorf("usage = %v, want 70s", used)
+	}
+
+	err, _ = m.Acquire(context.Background(), "a", limits)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Reason != ReasonDailyBudget {
+		t.Fatalf("error = %v, want daily budget exceeded", err)
+	}
+	if exceeded.RetryAfter != 12*time.Hour {
+		t.Errorf("retry after %v, want 12h until midnight", exceeded.RetryAfter)
+	}
+
+	advance(12 * time.Hour)
+	if err, _ := m.Acquire(context.Background(), "a", limits); err != nil {
+		t.Errorf("next day: %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	m, advance := newTestManager()
+
+	err, release := m.Acquire(context.Background(), "idle", &Limits{Rate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(0)
+	err, release = m.Acquire(context.Background(), "used", &Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(time.Second)
+
+	m.Prune()
+	if len(m.entries) != 2 {
+		t.Errorf("pruned %v before the rate recovered", m.entries)
+	}
+	advance(time.Second)
+	m.Prune()
+	if _, ok := m.entries["idle"]; ok {
+		t.Error("idle key was not pruned")
+	}
+	if _, ok := m.entries["used"]; !ok {
+		t.Error("key with usage today was pruned")
+	}
+}
+
+func (m *Manager) waiting(key string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.entries[key].waiting
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/admin"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type adminServer struct {
+	admin.UnimplementedAdminServer
+
+	server *Server
+}
+
+func (a *adminServer) ResizePool(ctx context.Context, request *admin.ResizePoolRequest) (*admin.ResizePoolResponse, error) {
+	if err := a.server.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	previousWorkerCount := a.server.pool.WorkerCount()
+	if err := a.server.pool.Resize(int(request.WorkerCount)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &admin.ResizePoolResponse{
+		PreviousWorkerCount: int32(previousWorkerCount),
+		WorkerCount:         int32(a.server.pool.WorkerCount()),
+	}, nil
+}
+
+func (a *adminServer) SetLogLevel(ctx context.Context, request *admin.SetLogLevelRequest) (*admin.SetLogLevelResponse, error) {
+	if err := a.server.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	previousLevel := log.Level()
+	if err := log.SetLevel(request.Level); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &admin.SetLogLevelResponse{
+		PreviousLevel: previousLevel,
+		Level:         log.Level(),
+	}, nil
+}
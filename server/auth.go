@@ -0,0 +1,93 @@
+package server
+
+import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/config"
+	"ExecutionEngine/proto/job"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"slices"
+)
+
+// newAuthenticator returns nil when authentication is disabled.
+func newAuthenticator(cfg *config.Config) (error, *auth.Authenticator) {
+	if !cfg.Auth.Enabled {
+		return nil, nil
+	}
+
+	options := &auth.Options{
+		APIKeyHashes: map[string]string{},
+		JWT: &auth.JWTOptions{
+			Issuer:        cfg.Auth.JWT.Issuer,
+			Audience:      cfg.Auth.JWT.Audience,
+			SecretFile:    cfg.Auth.JWT.SecretFile,
+			PublicKeyFile: cfg.Auth.JWT.PublicKeyFile,
+		},
+	}
+	for _, client := range cfg.Auth.Clients {
+		options.Clients = append(options.Clients, client.Name)
+		for _, hash := range client.APIKeyHashes {
+			options.APIKeyHashes[hash] = client.Name
+		}
+	}
+	return auth.New(options)
+}
+
+func (s *Server) currentAuthenticator() *auth.Authenticator {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
+
+	return s.authenticator
+}
+
+// client returns the permissions of the caller. Without authentication there
+// are none and everything is allowed but network access.
+func (s *Server) client(ctx context.Context, cfg *config.Config) (error, *config.ClientConfig) {
+	if !cfg.Auth.Enabled {
+		return nil, nil
+	}
+	name := auth.ClientFromContext(ctx)
+	client := cfg.Client(name)
+	if client == nil {
+		// The client was removed by a reload after the call was authenticated
+		return status.Errorf(codes.PermissionDenied, "unknown client %q", name), nil
+	}
+	return nil, client
+}
+
+// authorize checks that client may submit request.
+func authorize(request *job.JobRequest, image *config.ImageConfig, client *config.ClientConfig) error {
+	if client == nil {
+		// Only clients granted the network may lift security.network_disabled
+		if request.NetworkAccess {
+			return status.Error(codes.PermissionDenied, "network access needs an authenticated client allowed to use the network")
+		}
+		return nil
+	}
+	if len(client.Images) > 0 && !slices.Contains(client.Images, image.Name) {
+		return status.Errorf(codes.PermissionDenied, "client %q may not use image %q", client.Name, image.Name)
+	}
+	if request.NetworkAccess && !client.NetworkAccess {
+		return status.Errorf(codes.PermissionDenied, "client %q may not use the network", client.Name)
+	}
+	return nil
+}
+
+// authorizeAdmin checks that the caller may administer the server and read
+// the jobs of every client.
+func (s *Server) authorizeAdmin(ctx context.Context) error {
+	err, client := s.client(ctx, s.currentConfig())
+	if err != nil {
+		return err
+	}
+	if client != nil && !client.Admin {
+		return status.Errorf(codes.PermissionDenied, "client %q is not an administrator", client.Name)
+	}
+	return nil
+}
+
+// canRead reports whether client may read the record of a job.
+func canRead(client *config.ClientConfig, record *job.JobRecord) bool {
+	return client == nil || client.Admin || record.Client == client.Name
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"ExecutionEngine/blob"
+	"ExecutionEngine/config"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+func newBlobStore(cfg *config.Config) (error, *blob.Store) {
+	return blob.NewStore(&blob.Options{
+		Directory:    cfg.Blobs.Directory,
+		MaxBytes:     cfg.Blobs.MaxBytes,
+		MaxBlobBytes: cfg.Blobs.MaxBlobBytes,
+	})
+}
+
+// UploadBlob stores the chunks of the stream as one blob. The content is
+// written to disk as it arrives, so blobs may be far larger than a message.
+func (s *Server) UploadBlob(stream grpc.ClientStreamingServer[job.UploadBlobRequest, job.UploadBlobResponse]) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		first = &job.UploadBlobRequest{}
+	} else if err != nil {
+		return uploadError(stream, err)
+	}
+	if first.Sha256 != "" && !blob.ValidDigest(first.Sha256) {
+		return status.Error(codes.InvalidArgument, "sha256 must be a SHA-256 in lowercase hex")
+	}
+
+	err, info := s.blobs.Put(&uploadReader{stream: stream, pending: first.Chunk, done: err != nil}, first.Sha256)
+	switch {
+	case errors.Is(err, blob.ErrTooLarge):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, blob.ErrDigestMismatch):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return uploadError(stream, err)
+	}
+	log.FromContext(ctx).Info("Stored blob", zap.String("sha256", info.Digest), zap.Int64("size", info.Size))
+	return stream.SendAndClose(&job.UploadBlobResponse{Sha256: info.Digest, Size: info.Size})
+}
+
+func uploadError(stream grpc.ServerStream, err error) error {
+	if stream.Context().Err() != nil {
+		return contextError(stream.Context())
+	}
+	log.FromContext(stream.Context()).Error("Cannot store blob", zap.Error(err))
+	return status.Error(codes.Internal, "cannot store blob")
+}
+
+// uploadReader reads the chunks of an upload until the client closes the
+// stream.
+type uploadReader struct {
+	stream  grpc.ClientStreamingServer[job.UploadBlobRequest, job.UploadBlobResponse]
+	pending []byte
+	done    bool
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		request, err := r.stream.Recv()
+		if err != nil {
+			// io.EOF once the client closed the stream
+			return 0, err
+		}
+		r.pending = request.Chunk
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// pinBlobs keeps the blobs request refers to until the returned function is
+// called, so that they cannot be evicted before the job used them. It
+// returns FAILED_PRECONDITION when one of them was never uploaded or was
+// evicted since.
+func (s *Server) pinBlobs(request *job.JobRequest) (error, func()) {
+	references := map[string]string{}
+	if request.StdinBlob != "" {
+		references["stdin_blob"] = request.StdinBlob
+	}
+	for i, file := range request.Files {
+		references[fmt.Sprintf("files[%d].blob", i)] = file.Blob
+	}
+
+	var unpins []func()
+	unpin := func() {
+		for _, unpin := range unpins {
+			unpin()
+		}
+	}
+	for field, digest := range references {
+		err, unpinBlob := s.blobs.Pin(digest)
+		if errors.Is(err, blob.ErrNotFound) {
+			unpin()
+			return status.Errorf(codes.FailedPrecondition, "blob %s of %s is unknown, it must be uploaded again", digest, field), nil
+		} else if err != nil {
+			unpin()
+			return status.Errorf(codes.Internal, "cannot read blob %s", digest), nil
+		}
+		unpins = append(unpins, unpinBlob)
+	}
+	return nil, unpin
+}
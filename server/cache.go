@@ -0,0 +1,86 @@
+package server
+
+import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/cache"
+	"ExecutionEngine/container"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// cacheKey returns an empty key when the result cache is disabled or the
+// image cannot be identified.
+func (s *Server) cacheKey(ctx context.Context, request *job.JobRequest, image string) string {
+	if !s.currentConfig().Cache.Enabled {
+		return ""
+	}
+
+	err, imageID := s.runtime.ImageID(ctx, image)
+	if err != nil {
+		log.FromContext(ctx).Warn("Cannot identify image, skipping result cache", zap.Error(err))
+		return ""
+	}
+	err, key := cache.Key(request, imageID)
+	if err != nil {
+		log.FromContext(ctx).Warn("Cannot hash request, skipping result cache", zap.Error(err))
+		return ""
+	}
+	return key
+}
+
+// lookupCache returns the cached response for key after recording it as a
+// completed job, or nil on a miss.
+func (s *Server) lookupCache(ctx context.Context, key string, jobID string, request *job.JobRequest) *job.JobResponse {
+	response := s.cache.Get(key)
+	if response == nil {
+		return nil
+	}
+	log.FromContext(ctx).Debug("Serving response from result cache")
+
+	response.JobId = jobID
+	response.Cached = true
+	response.Attempts = 0
+	s.metrics.ObserveJob(response)
+
+	now := time.Now().UnixMilli()
+	record := s.updateRecord(ctx, &job.JobRecord{
+		JobId:      jobID,
+		Tenant:     request.Tenant,
+		Client:     auth.ClientFromContext(ctx),
+		State:      job.JobState_JOB_STATE_COMPLETED,
+		Request:    request,
+		Response:   response,
+		CreatedAt:  now,
+		StartedAt:  now,
+		FinishedAt: now,
+	}, func(record *job.JobRecord) {
+		if request.CallbackUrl != "" {
+			record.CallbackState = job.CallbackState_CALLBACK_STATE_PENDING
+		}
+	})
+	s.notify(ctx, record)
+
+	return response
+}
+
+// storeCache keeps verdicts that only depend on the request. Verdicts
+// depending on timing or the state of the host are never cached.
+func (s *Server) storeCache(key string, response *job.JobResponse) {
+	if key == "" || response == nil {
+		return
+	}
+	switch response.Status {
+	case container.StatusFinished, container.StatusCompileError:
+	default:
+		return
+	}
+
+	response = proto.Clone(response).(*job.JobResponse)
+	response.JobId = ""
+	response.Phases = nil
+	s.cache.Put(key, response)
+}
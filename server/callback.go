@@ -0,0 +1,88 @@
+package server
+
+import (
+	"ExecutionEngine/callback"
+	"ExecutionEngine/config"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+func newNotifier(cfg *config.Config) (error, *callback.Notifier) {
+	var secret []byte
+	if cfg.Callback.SecretFile != "" {
+		content, err := os.ReadFile(cfg.Callback.SecretFile)
+		if err != nil {
+			return fmt.Errorf("cannot read callback secret: %w", err), nil
+		}
+		secret = []byte(strings.TrimSpace(string(content)))
+	}
+	return nil, callback.NewNotifier(&callback.Options{
+		Secret:         secret,
+		MaxAttempts:    cfg.Callback.MaxAttempts,
+		InitialBackoff: cfg.Callback.InitialBackoff,
+		MaxBackoff:     cfg.Callback.MaxBackoff,
+		Timeout:        cfg.Callback.Timeout,
+	})
+}
+
+// authorizeCallback checks that the callback URL of request points to an
+// allowed host. The engine usually reaches internal services callers cannot,
+// so no host is allowed unless configured.
+func authorizeCallback(request *job.JobRequest, allowedHosts []string) error {
+	if request.CallbackUrl == "" {
+		return nil
+	}
+	parsed, err := url.Parse(request.CallbackUrl)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !slices.Contains(allowedHosts, parsed.Hostname()) {
+		return status.Errorf(codes.PermissionDenied, "callbacks to %s are not allowed", parsed.Hostname())
+	}
+	return nil
+}
+
+// notify posts the response of a finished job to its callback URL in the
+// background and records the outcome. Deliveries still in progress when the
+// server stops are given up and recorded as failed.
+func (s *Server) notify(ctx context.Context, record *job.JobRecord) {
+	callbackURL := record.Request.GetCallbackUrl()
+	if callbackURL == "" {
+		return
+	}
+	response := record.Response
+	if response == nil {
+		response = &job.JobResponse{JobId: record.JobId, ErrorString: record.ErrorString}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	s.pendingCallbacks.Add(1)
+	go func() {
+		defer s.pendingCallbacks.Done()
+
+		err, attempts := s.callbacks.Deliver(s.callbackContext, callbackURL, response)
+		if err != nil {
+			log.FromContext(ctx).Warn("Cannot deliver callback", zap.Error(err), zap.Int("attempts", attempts))
+		} else {
+			log.FromContext(ctx).Debug("Delivered callback", zap.Int("attempts", attempts))
+		}
+		s.updateRecord(ctx, record, func(record *job.JobRecord) {
+			record.CallbackAttempts = int32(attempts)
+			if err != nil {
+				record.CallbackState = job.CallbackState_CALLBACK_STATE_FAILED
+				record.CallbackError = err.Error()
+			} else {
+				record.CallbackState = job.CallbackState_CALLBACK_STATE_DELIVERED
+			}
+		})
+	}()
+}
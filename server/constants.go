@@ -1,5 +1,8 @@
 package server
 
-const listenAddress = ":8000"
-const dockerBuildContextFolder = "docker/"
-const dockerImageName = "execution-engine-image"
+import (
+	"time"
+)
+
+// purgeInterval is how often job records older than the retention are deleted.
+const purgeInterval = time.Hour
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"time"
+)
+
+// healthServices are the services whose status follows the readiness of the
+// server, the empty name stands for the whole server.
+var healthServices = []string{"", job.Job_ServiceDesc.ServiceName}
+
+// checkReadiness returns why jobs cannot be run right now.
+func (s *Server) checkReadiness(ctx context.Context) error {
+	cfg := s.currentConfig()
+	if s.docker != nil {
+		if _, err := s.docker.Ping(ctx); err != nil {
+			return fmt.Errorf("Docker daemon is unreachable: %w", err)
+		}
+		for _, image := range cfg.Images {
+			if _, _, err := s.docker.ImageInspectWithRaw(ctx, image.Tag); err != nil {
+				return fmt.Errorf("image %s is unavailable: %w", image.Name, err)
+			}
+		}
+	}
+	if maxQueuedJobs := cfg.Health.MaxQueuedJobs; maxQueuedJobs > 0 {
+		if queued := s.pool.TaskCount() - s.pool.BusyWorkers(); queued > maxQueuedJobs {
+			return fmt.Errorf("%d jobs are waiting for a worker", queued)
+		}
+	}
+	return nil
+}
+
+// watchHealth updates the health service with the readiness of the server
+// until ctx is done.
+func (s *Server) watchHealth(ctx context.Context) {
+	var previous healthpb.HealthCheckResponse_ServingStatus
+	for {
+		checkInterval := s.currentConfig().Health.CheckInterval
+		checkContext, cancel := context.WithTimeout(ctx, checkInterval)
+		err := s.checkReadiness(checkContext)
+		cancel()
+
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if servingStatus != previous {
+			if err != nil {
+				log.L().Warn("Server is not ready", zap.Error(err))
+			} else {
+				log.L().Info("Server is ready")
+			}
+			previous = servingStatus
+		}
+		for _, service := range healthServices {
+			s.health.SetServingStatus(service, servingStatus)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(checkInterval):
+		}
+	}
+}
+
+// Drain reports the server as not serving, gives load balancers the drain
+// delay to notice and then stops accepting calls. Serve returns once the calls
+// in progress, including those of the gateway, are done.
+func (s *Server) Drain() {
+	drainDelay := s.currentConfig().Health.DrainDelay
+	log.L().Info("Draining server", zap.Duration("drainDelay", drainDelay))
+	s.health.Shutdown()
+	time.Sleep(drainDelay)
+	if s.gatewayServer != nil {
+		if err := s.gatewayServer.Shutdown(context.Background()); err != nil {
+			log.L().Warn("Cannot shut down gateway", zap.Error(err))
+		}
+	}
+	s.grpcServer.GracefulStop()
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"ExecutionEngine/store"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// errJobCancelled is the cause of the context of jobs cancelled by CancelJob.
+var errJobCancelled = errors.New("job was cancelled")
+
+func (s *Server) GetJob(ctx context.Context, request *job.GetJobRequest) (*job.JobRecord, error) {
+	err, client := s.client(ctx, s.currentConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	err, record := s.store.Get(ctx, request.JobId)
+	// Jobs of other clients are not revealed to exist
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !canRead(client, record)) {
+		return nil, status.Errorf(codes.NotFound, "job %s not found", request.JobId)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return record, nil
+}
+
+func (s *Server) ListJobs(ctx context.Context, request *job.ListJobsRequest) (*job.ListJobsResponse, error) {
+	err, client := s.client(ctx, s.currentConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &store.Filter{
+		State:         request.State,
+		Tenant:        request.Tenant,
+		CallbackState: request.CallbackState,
+		Limit:         int(request.Limit),
+	}
+	if client != nil && !client.Admin {
+		filter.Client = client.Name
+	}
+	if request.CreatedAfter > 0 {
+		filter.CreatedAfter = time.UnixMilli(request.CreatedAfter)
+	}
+	if request.CreatedBefore > 0 {
+		filter.CreatedBefore = time.UnixMilli(request.CreatedBefore)
+	}
+
+	err, records := s.store.List(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &job.ListJobsResponse{
+		Jobs: records,
+	}, nil
+}
+
+func (s *Server) CancelJob(ctx context.Context, request *job.CancelJobRequest) (*job.CancelJobResponse, error) {
+	err, client := s.client(ctx, s.currentConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	err, record := s.store.Get(ctx, request.JobId)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !canRead(client, record)) {
+		return nil, status.Errorf(codes.NotFound, "job %s not found", request.JobId)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	cancel, ok := s.runningJobs.Load(request.JobId)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s already finished", request.JobId)
+	}
+
+	log.FromContext(ctx).Info("Cancelling job", zap.String("jobID", request.JobId))
+	cancel.(context.CancelCauseFunc)(errJobCancelled)
+	return &job.CancelJobResponse{}, nil
+}
+
+// contextError converts the reason the context of a job is done into a
+// status.
+func contextError(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), errJobCancelled) {
+		return status.Error(codes.Canceled, errJobCancelled.Error())
+	}
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+// updateRecord stores a modified copy of record, the original is shared
+// between the Submit call and the worker and must not change. Failing to
+// store a record does not fail the job. It returns the stored record.
+func (s *Server) updateRecord(ctx context.Context, record *job.JobRecord, modify func(record *job.JobRecord)) *job.JobRecord {
+	if modify != nil {
+		record = proto.Clone(record).(*job.JobRecord)
+		modify(record)
+	}
+	if err := s.store.Put(context.WithoutCancel(ctx), record); err != nil {
+		log.FromContext(ctx).Warn("Cannot store job record", zap.Error(err))
+	}
+	return record
+}
+
+// finishRecord stores the outcome of a job and starts its callback.
+func (s *Server) finishRecord(ctx context.Context, record *job.JobRecord, response *job.JobResponse, err error) {
+	finished := s.updateRecord(ctx, record, func(record *job.JobRecord) {
+		if record.Request.GetCallbackUrl() != "" {
+			record.CallbackState = job.CallbackState_CALLBACK_STATE_PENDING
+		}
+		record.FinishedAt = time.Now().UnixMilli()
+		record.Response = response
+		if err != nil {
+			record.State = job.JobState_JOB_STATE_FAILED
+			if errors.Is(context.Cause(ctx), errJobCancelled) {
+				record.State = job.JobState_JOB_STATE_CANCELLED
+			}
+			record.ErrorString = err.Error()
+		} else {
+			record.State = job.JobState_JOB_STATE_COMPLETED
+		}
+	})
+	s.notify(ctx, finished)
+}
+
+// purgeRecords deletes job records older than the retention and forgets idle
+// quotas until ctx is done.
+func (s *Server) purgeRecords(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if retention := s.currentConfig().Store.Retention; retention > 0 {
+			err, purged := s.store.Purge(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.L().Warn("Cannot purge job records", zap.Error(err))
+			} else if purged > 0 {
+				log.L().Info("Purged expired job records", zap.Int("count", purged))
+			}
+		}
+		s.quotas.Prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
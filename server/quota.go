@@ -0,0 +1,89 @@
+package server
+
+import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/config"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/job"
+	"ExecutionEngine/quota"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"strconv"
+	"time"
+)
+
+// retryAfterHeader tells rejected callers how many seconds to wait.
+const retryAfterHeader = "retry-after"
+
+// acquireQuota admits a job of the calling client or tenant. The returned
+// function must be called with the processor time of the job once it is done.
+func (s *Server) acquireQuota(ctx context.Context, request *job.JobRequest, quotas *config.QuotasConfig) (error, func(cpuTime time.Duration)) {
+	key := request.Tenant
+	if quotas.Key == config.QuotaKeyClient {
+		key = auth.ClientFromContext(ctx)
+	}
+	limits := quotas.Quota(key)
+
+	err, release := s.quotas.Acquire(ctx, key, &quota.Limits{
+		Rate:              limits.Rate,
+		Burst:             limits.Burst,
+		MaxConcurrentJobs: limits.MaxConcurrentJobs,
+		MaxQueuedJobs:     limits.MaxQueuedJobs,
+		DailyCPUTime:      limits.DailyCPUTime,
+	})
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		log.FromContext(ctx).Info("Rejected job over quota", zap.String("quota", exceeded.Reason), zap.Duration("retryAfter", exceeded.RetryAfter))
+		return quotaExceeded(ctx, exceeded), nil
+	}
+	if err != nil {
+		return status.FromContextError(err).Err(), nil
+	}
+	return nil, release
+}
+
+// quotaExceeded returns a RESOURCE_EXHAUSTED status and sends the delay after
+// which the job would be admitted as header.
+func quotaExceeded(ctx context.Context, exceeded *quota.ExceededError) error {
+	details := []protoadapt.MessageV1{&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     exceeded.Key,
+			Description: exceeded.Error(),
+		}},
+	}}
+	if exceeded.RetryAfter > 0 {
+		seconds := int64(math.Ceil(exceeded.RetryAfter.Seconds()))
+		// Calls not made through gRPC have no header to set
+		_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterHeader, strconv.FormatInt(seconds, 10)))
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)})
+	}
+
+	rejected := status.New(codes.ResourceExhausted, exceeded.Error())
+	if withDetails, err := rejected.WithDetails(details...); err == nil {
+		rejected = withDetails
+	}
+	return rejected.Err()
+}
+
+// cpuTime is what a job is charged against its daily budget. Jobs whose
+// processor time is unknown, such as the ones exceeding their time limit, are
+// charged their execution time, which they mostly spent computing.
+func cpuTime(response *job.JobResponse) time.Duration {
+	if response == nil || response.Cached {
+		return 0
+	}
+	statistics := response.GetResourceStatistics()
+	if statistics.GetCpuTime() >= 0 {
+		return time.Duration(statistics.GetCpuTime()) * time.Millisecond
+	}
+	return time.Duration(statistics.GetExecutionTime()) * time.Millisecond
+}
@@ -1,47 +1,209 @@
 package server
 
 import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/blob"
+	"ExecutionEngine/cache"
+	"ExecutionEngine/callback"
+	"ExecutionEngine/certificates"
+	"ExecutionEngine/config"
 	"ExecutionEngine/container"
+	"ExecutionEngine/container/docker"
+	"ExecutionEngine/container/native"
+	"ExecutionEngine/container/warm"
+	"ExecutionEngine/gateway"
 	"ExecutionEngine/log"
+	"ExecutionEngine/metrics"
 	"ExecutionEngine/pool"
+	"ExecutionEngine/proto/admin"
 	"ExecutionEngine/proto/job"
+	"ExecutionEngine/quota"
+	"ExecutionEngine/store"
+	"ExecutionEngine/tracing"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/docker/docker/client"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"io"
 	"net"
-	"runtime"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
 )
 
+var tracer = otel.Tracer("ExecutionEngine/server")
+
 type Server struct {
 	job.UnimplementedJobServer
 
-	listener   net.Listener
-	grpcServer *grpc.Server
-	pool       pool.WorkerPool[*taskInput, *taskOutput]
+	config       *config.Config
+	configLock   sync.RWMutex
+	runtime      container.Runtime
+	docker       *client.Client
+	store        store.Store
+	cache        *cache.ResultCache
+	quotas       *quota.Manager
+	artifacts    container.ArtifactCache
+	blobs        *blob.Store
+	listener     net.Listener
+	certificates *certificates.Reloader
+	grpcServer   *grpc.Server
+	health       *health.Server
+	pool         pool.WorkerPool[*taskInput, *taskOutput]
+	pendingTasks sync.Map
+	// started is closed once Serve started the worker pool
+	started chan struct{}
+	// runningJobs maps the IDs of jobs being submitted to the
+	// context.CancelCauseFunc cancelling them
+	runningJobs sync.Map
+
+	metrics         *metrics.Metrics
+	metricsListener net.Listener
+	metricsServer   *http.Server
+
+	gatewayListener net.Listener
+	gatewayServer   *http.Server
+
+	shutdownTracing func(context.Context) error
+
+	// authenticator is replaced on reload and guarded by configLock
+	authenticator *auth.Authenticator
+
+	// callbacks deliver the responses of jobs with a callback URL until
+	// callbackContext is cancelled on shutdown
+	callbacks        *callback.Notifier
+	callbackContext  context.Context
+	stopCallbacks    context.CancelFunc
+	pendingCallbacks sync.WaitGroup
 }
 
-func NewServer() *Server {
-	return &Server{
-		pool: pool.NewDefaultWorkerPool[*taskInput, *taskOutput](runtime.NumCPU()),
+func NewServer(config *config.Config) *Server {
+	s := &Server{
+		config: config,
+		store:  store.NewMemoryStore(),
+		cache: cache.NewResultCache(&cache.Options{
+			TTL:        config.Cache.TTL,
+			MaxEntries: config.Cache.MaxEntries,
+			MaxBytes:   config.Cache.MaxBytes,
+		}),
+		quotas:  quota.NewManager(),
+		health:  health.NewServer(),
+		pool:    pool.NewDefaultWorkerPool[*taskInput, *taskOutput](config.Pool.Workers),
+		metrics: metrics.New(),
+		started: make(chan struct{}),
+	}
+	s.metrics.RegisterPool(s.pool)
+	s.callbackContext, s.stopCallbacks = context.WithCancel(context.Background())
+	// Jobs are not accepted by orchestrators until the first readiness check
+	for _, service := range healthServices {
+		s.health.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
 	}
+	return s
 }
 
 func (s *Server) Initialize() {
+	listenAddress := s.config.Server.ListenAddress
 	log.L().Debug("Initializing server", zap.String("listenAddress", listenAddress))
 
-	log.L().Debug("Creating Docker client")
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// The Docker client traces its requests with the global tracer provider,
+	// which must be installed first.
+	tracingConfig := s.config.Tracing
+	err, shutdownTracing := tracing.Setup(context.Background(), &tracing.Options{
+		Exporter:    tracingConfig.Exporter,
+		Endpoint:    tracingConfig.Endpoint,
+		Insecure:    tracingConfig.Insecure,
+		SampleRatio: tracingConfig.SampleRatio,
+		ServiceName: tracingConfig.ServiceName,
+	})
 	if err != nil {
-		panic(fmt.Errorf("failed to create Docker client: %w", err))
+		panic(fmt.Errorf("failed to set up tracing: %w", err))
+	}
+	s.shutdownTracing = shutdownTracing
+
+	switch s.config.Runtime.Backend {
+	case config.RuntimeDocker:
+		s.initializeDocker()
+	case config.RuntimeNative:
+		s.initializeNative()
+	}
+	s.runtime = container.InstrumentRuntime(s.metrics.InstrumentRuntime(s.runtime))
+	if warmPoolConfig := s.config.Runtime.WarmPool; warmPoolConfig.Size > 0 {
+		log.L().Debug("Starting warm sandbox pool", zap.Int("size", warmPoolConfig.Size))
+		s.runtime = warm.NewRuntime(s.runtime, &warm.Options{
+			Size:  warmPoolConfig.Size,
+			Specs: warmSpecs(s.config),
+		})
+	}
+
+	if compileCacheConfig := s.config.Cache.Compile; compileCacheConfig.Enabled {
+		log.L().Debug("Opening compile cache", zap.String("directory", compileCacheConfig.Directory))
+		err, artifacts := cache.NewArtifactCache(&cache.ArtifactOptions{
+			Directory:        compileCacheConfig.Directory,
+			MaxBytes:         compileCacheConfig.MaxBytes,
+			MaxArtifactBytes: compileCacheConfig.MaxArtifactBytes,
+		})
+		if err != nil {
+			panic(fmt.Errorf("failed to open compile cache: %w", err))
+		}
+		s.artifacts = artifacts
+	}
+
+	log.L().Debug("Opening blob store", zap.String("directory", s.config.Blobs.Directory))
+	err, blobs := newBlobStore(s.config)
+	if err != nil {
+		panic(fmt.Errorf("failed to open blob store: %w", err))
+	}
+	s.blobs = blobs
+
+	if s.config.Store.Backend == config.StoreBolt {
+		log.L().Debug("Opening job store", zap.String("path", s.config.Store.Path))
+		err, boltStore := store.NewBoltStore(s.config.Store.Path)
+		if err != nil {
+			panic(err)
+		}
+		s.store = boltStore
 	}
 
-	log.L().Debug("Building Docker image")
-	err = container.BuildImage(context.Background(), cli, dockerBuildContextFolder, dockerImageName)
+	err, s.authenticator = newAuthenticator(s.config)
 	if err != nil {
-		panic(fmt.Errorf("failed to build Docker image: %w", err))
+		panic(fmt.Errorf("failed to set up authentication: %w", err))
+	}
+
+	err, notifier := newNotifier(s.config)
+	if err != nil {
+		panic(err)
+	}
+	s.callbacks = notifier
+
+	if tlsConfig := s.config.Server.TLS; tlsConfig.CertFile != "" {
+		log.L().Debug("Loading TLS certificate", zap.String("certFile", tlsConfig.CertFile), zap.String("clientCAFile", tlsConfig.ClientCAFile))
+		err, reloader := certificates.NewReloader(&certificates.Options{
+			CertFile:     tlsConfig.CertFile,
+			KeyFile:      tlsConfig.KeyFile,
+			ClientCAFile: tlsConfig.ClientCAFile,
+		})
+		if err != nil {
+			panic(err)
+		}
+		s.certificates = reloader
 	}
 
 	listener, err := net.Listen("tcp", listenAddress)
@@ -50,48 +212,450 @@ func (s *Server) Initialize() {
 	}
 	s.listener = listener
 
-	s.grpcServer = grpc.NewServer()
-	job.RegisterJobServer(s.grpcServer, s)
+	s.grpcServer = s.newGRPCServer()
+
+	if gatewayAddress := s.config.Gateway.ListenAddress; gatewayAddress != "" {
+		gatewayListener, err := net.Listen("tcp", gatewayAddress)
+		if err != nil {
+			log.L().Panic("Cannot listen on gateway address", zap.Error(err), zap.String("gatewayAddress", gatewayAddress))
+		}
+		if s.certificates != nil {
+			gatewayListener = tls.NewListener(gatewayListener, s.certificates.TLSConfig())
+		}
+		s.gatewayListener = gatewayListener
+		s.gatewayServer = &http.Server{Handler: gateway.NewHandler(s, &gateway.Options{
+			Interceptor:     s.unaryInterceptor(),
+			MaxRequestBytes: s.config.Gateway.MaxRequestBytes,
+		})}
+	}
+
+	if metricsAddress := s.config.Metrics.ListenAddress; metricsAddress != "" {
+		metricsListener, err := net.Listen("tcp", metricsAddress)
+		if err != nil {
+			log.L().Panic("Cannot listen on metrics address", zap.Error(err), zap.String("metricsAddress", metricsAddress))
+		}
+		s.metricsListener = metricsListener
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics.Handler())
+		s.metricsServer = &http.Server{Handler: mux}
+	}
+}
+
+// warmSpecs returns the sandboxes the warm pool keeps ready: one spec per
+// image, matching the jobs without network access and with the memory limit
+// of the warm pool.
+func warmSpecs(cfg *config.Config) []container.SandboxSpec {
+	specs := make([]container.SandboxSpec, 0, len(cfg.Images))
+	for _, image := range cfg.Images {
+		specs = append(specs, container.SandboxSpec{
+			Image:       image.Tag,
+			MemoryLimit: cfg.WarmPoolMemoryLimit(),
+		})
+	}
+	return specs
+}
+
+func (s *Server) initializeDocker() {
+	log.L().Debug("Creating Docker client")
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		panic(fmt.Errorf("failed to create Docker client: %w", err))
+	}
+
+	for _, image := range s.config.Images {
+		if image.BuildContext == "" {
+			continue
+		}
+		log.L().Debug("Building Docker image", zap.String("image", image.Tag))
+		err = docker.BuildImage(context.Background(), cli, image.BuildContext, image.Tag)
+		if err != nil {
+			// The server is reported as not ready until the image exists
+			log.L().Error("Cannot build Docker image", zap.Error(err), zap.String("image", image.Name))
+		}
+	}
+
+	securityConfig := s.config.Security
+	err, runtime := docker.NewRuntime(cli, &docker.Options{
+		NetworkDisabled: securityConfig.NetworkDisabled,
+		PidsLimit:       securityConfig.PidsLimit,
+		CapDrop:         securityConfig.CapDrop,
+		NoNewPrivileges: securityConfig.NoNewPrivileges,
+		User:            securityConfig.User,
+		SeccompProfile:  securityConfig.SeccompProfile,
+	})
+	if err != nil {
+		panic(fmt.Errorf("failed to create Docker runtime: %w", err))
+	}
+	s.runtime = runtime
+	s.docker = cli
+}
+
+func (s *Server) initializeNative() {
+	nativeConfig := s.config.Runtime.Native
+	log.L().Debug("Creating native runtime", zap.String("workDirectory", nativeConfig.WorkDirectory))
+	err, runtime := native.NewRuntime(&native.Options{
+		WorkDirectory: nativeConfig.WorkDirectory,
+		Namespaces:    nativeConfig.Namespaces,
+		CgroupRoot:    nativeConfig.CgroupRoot,
+		UID:           nativeConfig.UID,
+		GID:           nativeConfig.GID,
+		CPUTime:       nativeConfig.CPUTime,
+		MaxFileSize:   nativeConfig.MaxFileSize,
+		MaxProcesses:  nativeConfig.MaxProcesses,
+	})
+	if err != nil {
+		panic(fmt.Errorf("failed to create native runtime: %w", err))
+	}
+	s.runtime = runtime
+}
+
+func (s *Server) newGRPCServer() *grpc.Server {
+	serverOptions := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor()),
+		grpc.ChainStreamInterceptor(s.streamInterceptor()),
+	}
+	if s.certificates != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(s.certificates.TLSConfig())))
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
+	job.RegisterJobServer(grpcServer, s)
+	admin.RegisterAdminServer(grpcServer, &adminServer{server: s})
+	healthpb.RegisterHealthServer(grpcServer, s.health)
+	reflection.Register(grpcServer)
+	return grpcServer
+}
+
+// unaryInterceptor authenticates the calls of both the gRPC server and the
+// gateway.
+func (s *Server) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return auth.UnaryServerInterceptor(s.currentAuthenticator, healthpb.Health_Check_FullMethodName)
+}
+
+// streamInterceptor authenticates the streaming calls of the gRPC server,
+// except the ones of health checks and reflection.
+func (s *Server) streamInterceptor() grpc.StreamServerInterceptor {
+	return auth.StreamServerInterceptor(s.currentAuthenticator,
+		healthpb.Health_Watch_FullMethodName,
+		reflectionv1.ServerReflection_ServerReflectionInfo_FullMethodName,
+		reflectionv1alpha.ServerReflection_ServerReflectionInfo_FullMethodName,
+	)
+}
+
+// Started returns a channel closed once Serve is ready to run jobs submitted
+// by calling Submit directly.
+func (s *Server) Started() <-chan struct{} {
+	return s.started
 }
 
 func (s *Server) Serve() {
-	log.L().Info("Starting server", zap.String("listenAddress", listenAddress))
+	log.L().Info("Starting server", zap.String("listenAddress", s.listener.Addr().String()))
 
-	log.L().Info("Starting worker pool")
+	log.L().Info("Starting worker pool", zap.Int("workerCount", s.pool.WorkerCount()))
 	s.pool.Start()
+	close(s.started)
+
+	backgroundContext, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go s.purgeRecords(backgroundContext)
+	go s.watchHealth(backgroundContext)
+	if s.certificates != nil && s.config.Server.TLS.ReloadInterval > 0 {
+		go s.certificates.Watch(backgroundContext, s.config.Server.TLS.ReloadInterval, func(err error) {
+			log.L().Warn("Cannot reload TLS certificate, keeping the previous one", zap.Error(err))
+		})
+	}
 
+	serveErrorChannel := make(chan error, 1)
 	go func() {
-		err := s.grpcServer.Serve(s.listener)
-		if err != nil {
-			log.L().Panic("Cannot start gRPC server", zap.Error(err))
-		}
+		serveErrorChannel <- s.grpcServer.Serve(s.listener)
 	}()
+	if s.metricsServer != nil {
+		go s.serveMetrics()
+	}
+	if s.gatewayServer != nil {
+		go s.serveGateway()
+	}
 
-outer:
 	for {
 		select {
 		case item := <-s.pool.OutputChannel():
-			fmt.Print(item.ID)
+			s.deliver(item)
 		case event := <-s.pool.EventChannel():
 			switch event {
 			case pool.EventAllTaskDone:
-				break outer
+				log.L().Debug("All submitted tasks are done")
+			}
+		case err := <-serveErrorChannel:
+			if err != nil {
+				log.L().Panic("Cannot start gRPC server", zap.Error(err))
+			}
+			s.pool.Stop()
+			if s.metricsServer != nil {
+				s.metricsServer.Close()
+			}
+			if s.gatewayServer != nil {
+				s.gatewayServer.Close()
 			}
+			if closer, ok := s.runtime.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					log.L().Warn("Cannot close runtime", zap.Error(err))
+				}
+			}
+			s.stopCallbacks()
+			s.pendingCallbacks.Wait()
+			if err := s.store.Close(); err != nil {
+				log.L().Warn("Cannot close job store", zap.Error(err))
+			}
+			if s.shutdownTracing != nil {
+				if err := s.shutdownTracing(context.Background()); err != nil {
+					log.L().Warn("Cannot flush spans", zap.Error(err))
+				}
+			}
+			return
+		}
+	}
+}
+
+// Reload applies the settings of a new configuration that can change while
+// the server is running. The result cache can be toggled but keeps its bounds.
+// Settings only read on startup keep their current value, with a warning.
+func (s *Server) Reload(config *config.Config) error {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+
+	authenticator := s.authenticator
+	if !reflect.DeepEqual(config.Auth, s.config.Auth) {
+		log.L().Info("Reloading clients", zap.Bool("enabled", config.Auth.Enabled), zap.Int("clientCount", len(config.Auth.Clients)))
+		var err error
+		if err, authenticator = newAuthenticator(config); err != nil {
+			return err
+		}
+	}
+	// The pool may have been resized through the admin service since the last
+	// load
+	if workerCount := s.pool.WorkerCount(); config.Pool.Workers != workerCount {
+		log.L().Info("Resizing worker pool", zap.Int("previousWorkerCount", workerCount), zap.Int("workerCount", config.Pool.Workers))
+		if err := s.pool.Resize(config.Pool.Workers); err != nil {
+			return err
+		}
+	}
+	keepOnReload("server", &config.Server, s.config.Server)
+	keepOnReload("images", &config.Images, s.config.Images)
+	keepOnReload("security", &config.Security, s.config.Security)
+	keepOnReload("runtime", &config.Runtime, s.config.Runtime)
+	keepOnReload("store.backend", &config.Store.Backend, s.config.Store.Backend)
+	keepOnReload("store.path", &config.Store.Path, s.config.Store.Path)
+	keepOnReload("cache.ttl", &config.Cache.TTL, s.config.Cache.TTL)
+	keepOnReload("cache.max_entries", &config.Cache.MaxEntries, s.config.Cache.MaxEntries)
+	keepOnReload("cache.max_bytes", &config.Cache.MaxBytes, s.config.Cache.MaxBytes)
+	keepOnReload("cache.compile", &config.Cache.Compile, s.config.Cache.Compile)
+	keepOnReload("blobs", &config.Blobs, s.config.Blobs)
+	keepOnReload("gateway", &config.Gateway, s.config.Gateway)
+	keepOnReload("metrics", &config.Metrics, s.config.Metrics)
+	keepOnReload("tracing", &config.Tracing, s.config.Tracing)
+	// Only the allowed hosts of callbacks are checked per job
+	keepOnReload("callback.secret_file", &config.Callback.SecretFile, s.config.Callback.SecretFile)
+	keepOnReload("callback.max_attempts", &config.Callback.MaxAttempts, s.config.Callback.MaxAttempts)
+	keepOnReload("callback.initial_backoff", &config.Callback.InitialBackoff, s.config.Callback.InitialBackoff)
+	keepOnReload("callback.max_backoff", &config.Callback.MaxBackoff, s.config.Callback.MaxBackoff)
+	keepOnReload("callback.timeout", &config.Callback.Timeout, s.config.Callback.Timeout)
+	// The level may have been changed through the admin service since the
+	// last load
+	if logOptions := (&log.Options{Format: config.Log.Format, Level: config.Log.Level}); !log.Configured(logOptions) {
+		log.L().Info("Reconfiguring logger", zap.String("format", config.Log.Format), zap.String("level", config.Log.Level))
+		if err := log.Configure(logOptions); err != nil {
+			return err
 		}
 	}
+	s.config = config
+	s.authenticator = authenticator
+
+	return nil
+}
+
+// keepOnReload warns when a setting that only changes on restart was changed
+// and restores its current value.
+func keepOnReload[T any](name string, reloaded *T, current T) {
+	if !reflect.DeepEqual(*reloaded, current) {
+		log.L().Warn("Setting only changes on restart, keeping the current value", zap.String("setting", name))
+		*reloaded = current
+	}
 }
 
 func (s *Server) Submit(ctx context.Context, request *job.JobRequest) (*job.JobResponse, error) {
-	log.L().Debug("Received new gRPC call", zap.String("request", request.String()))
-	taskID := uuid.New()
-	// TODO: Use worker pool
-	output := task(ctx, &taskInput{
-		taskID,
-		request,
+	taskID := uuid.Must(uuid.NewV7())
+	createdAt := time.Now()
+	ctx = log.With(ctx, zap.String("jobID", taskID.String()), zap.String("tenant", request.Tenant))
+	log.FromContext(ctx).Debug("Received new gRPC call", zap.String("request", request.String()))
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("job_id", taskID.String()),
+		attribute.String("tenant", request.Tenant),
+	)
+
+	configuration := s.currentConfig()
+	err, client := s.client(ctx, configuration)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRequest(request, &configuration.Limits); err != nil {
+		log.FromContext(ctx).Info("Rejected invalid request", zap.Error(err))
+		return nil, err
+	}
+	request = withLimits(request, &configuration.Limits, client)
+	if request.CallbackUrl == "" && client != nil {
+		request.CallbackUrl = client.CallbackURL
+	}
+
+	err, image := configuration.Image(request.Image)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := authorize(request, image, client); err != nil {
+		log.FromContext(ctx).Info("Rejected unauthorized request", zap.Error(err))
+		return nil, err
+	}
+	if err := authorizeCallback(request, configuration.Callback.AllowedHosts); err != nil {
+		log.FromContext(ctx).Info("Rejected callback URL", zap.Error(err))
+		return nil, err
+	}
+	err, unpinBlobs := s.pinBlobs(request)
+	if err != nil {
+		log.FromContext(ctx).Info("Rejected request referring to a missing blob", zap.Error(err))
+		return nil, err
+	}
+	defer unpinBlobs()
+
+	err, releaseQuota := s.acquireQuota(ctx, request, &configuration.Quotas)
+	if err != nil {
+		return nil, err
+	}
+	var response *job.JobResponse
+	defer func() { releaseQuota(cpuTime(response)) }()
+
+	cacheKey := s.cacheKey(ctx, request, image.Tag)
+	if cacheKey != "" && !request.BypassCache {
+		if response := s.lookupCache(ctx, cacheKey, taskID.String(), request); response != nil {
+			return response, nil
+		}
+	}
+
+	// CancelJob cancels ctx, which aborts the job wherever it is
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	s.runningJobs.Store(taskID.String(), cancel)
+	defer s.runningJobs.Delete(taskID.String())
+
+	queuedRecord := &job.JobRecord{
+		JobId:     taskID.String(),
+		Tenant:    request.Tenant,
+		Client:    auth.ClientFromContext(ctx),
+		State:     job.JobState_JOB_STATE_QUEUED,
+		Request:   request,
+		CreatedAt: createdAt.UnixMilli(),
+	}
+	s.updateRecord(ctx, queuedRecord, nil)
+
+	outputChannel := make(chan *taskOutput, 1)
+	s.pendingTasks.Store(taskID, outputChannel)
+	defer s.pendingTasks.Delete(taskID)
+
+	// The span ends when a worker picks the task up
+	_, queueSpan := tracer.Start(ctx, container.PhaseQueue)
+	defer queueSpan.End()
+
+	input := &taskInput{
+		ID:        taskID,
+		Request:   request,
+		Image:     image.Tag,
+		Record:    queuedRecord,
+		QueueSpan: queueSpan,
+	}
+	err = s.pool.Submit(&pool.Task[*taskInput, *taskOutput]{
+		Context:      ctx,
+		TaskFunction: s.task,
+		Input:        input,
+		Retry: &pool.RetryPolicy[*taskOutput]{
+			MaxAttempts:    configuration.Retry.MaxAttempts,
+			InitialBackoff: configuration.Retry.InitialBackoff,
+			MaxBackoff:     configuration.Retry.MaxBackoff,
+			Retryable:      isRetryable,
+		},
 	})
+	if err != nil {
+		s.finishRecord(ctx, queuedRecord, nil, err)
+		s.metrics.ObserveJob(nil)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	var output *taskOutput
+	select {
+	case output = <-outputChannel:
+	case <-ctx.Done():
+		s.finishRecord(ctx, queuedRecord, nil, context.Cause(ctx))
+		s.metrics.ObserveJob(nil)
+		return nil, contextError(ctx)
+	}
+
+	response = output.Response
+
+	finishedRecord := proto.Clone(queuedRecord).(*job.JobRecord)
+	finishedRecord.StartedAt = input.StartedAt.UnixMilli()
+	if output.Response != nil {
+		output.Response.JobId = taskID.String()
+		queue := container.NewPhaseTiming(container.PhaseQueue, createdAt, input.StartedAt.Sub(createdAt))
+		output.Response.Phases = append([]*job.PhaseTiming{queue}, output.Response.Phases...)
+	}
+	s.finishRecord(ctx, finishedRecord, output.Response, output.Error)
+	s.metrics.ObserveJob(output.Response)
+	if output.Error == nil {
+		s.storeCache(cacheKey, output.Response)
+	}
+
+	if output.Error != nil && ctx.Err() != nil {
+		log.FromContext(ctx).Info("Job was aborted", zap.Error(context.Cause(ctx)))
+		return nil, contextError(ctx)
+	}
 	if output.Error != nil {
-		log.L().Error("Task failed", zap.Error(output.Error), zap.String("taskID", taskID.String()))
+		log.FromContext(ctx).Error("Task failed", zap.Error(output.Error), zap.Int("attempts", output.Attempts))
+		if errors.Is(output.Error, blob.ErrNotFound) {
+			return nil, status.Errorf(codes.FailedPrecondition, "%s, it must be uploaded again", output.Error)
+		}
+		if container.IsInfrastructureError(output.Error) {
+			return nil, status.Errorf(codes.Unavailable, "job failed after %d attempts: %s", output.Attempts, output.Error)
+		}
 	}
 
 	return output.Response, output.Error
 }
+
+func (s *Server) serveMetrics() {
+	log.L().Info("Serving metrics", zap.String("metricsAddress", s.metricsListener.Addr().String()))
+	if err := s.metricsServer.Serve(s.metricsListener); err != nil && err != http.ErrServerClosed {
+		log.L().Error("Cannot serve metrics", zap.Error(err))
+	}
+}
+
+func (s *Server) serveGateway() {
+	log.L().Info("Serving gateway", zap.String("gatewayAddress", s.gatewayListener.Addr().String()))
+	if err := s.gatewayServer.Serve(s.gatewayListener); err != nil && err != http.ErrServerClosed {
+		log.L().Error("Cannot serve gateway", zap.Error(err))
+	}
+}
+
+func (s *Server) currentConfig() *config.Config {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
+
+	return s.config
+}
+
+// deliver hands a finished task over to the Submit call waiting for it.
+func (s *Server) deliver(output *taskOutput) {
+	outputChannel, ok := s.pendingTasks.Load(output.ID)
+	if !ok {
+		log.L().Debug("Dropping output of abandoned task", zap.String("jobID", output.ID.String()))
+		return
+	}
+	outputChannel.(chan *taskOutput) <- output
+}
@@ -0,0 +1,1266 @@
+package server
+
+import (
+	"ExecutionEngine/auth"
+	"ExecutionEngine/blob"
+	"ExecutionEngine/callback"
+	"ExecutionEngine/config"
+	"ExecutionEngine/container"
+	"ExecutionEngine/container/fake"
+	"ExecutionEngine/container/warm"
+	"ExecutionEngine/gateway"
+	"ExecutionEngine/log"
+	"ExecutionEngine/proto/admin"
+	"ExecutionEngine/proto/job"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestServer serves a Server backed by runtime over an in-process
+// connection. configure can adjust the test configuration.
+func startTestServer(t *testing.T, runtime container.Runtime, configure ...func(cfg *config.Config)) *grpc.ClientConn {
+	t.Helper()
+	_, connection := newTestServer(t, runtime, configure...)
+	return connection
+}
+
+// newTestServer is startTestServer for tests that need the server itself.
+func newTestServer(t *testing.T, runtime container.Runtime, configure ...func(cfg *config.Config)) (*Server, *grpc.ClientConn) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Pool.Workers = 2
+	cfg.Retry.InitialBackoff = time.Millisecond
+	cfg.Retry.MaxBackoff = time.Millisecond
+	cfg.Blobs.Directory = t.TempDir()
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	s := NewServer(cfg)
+	s.runtime = runtime
+	err, authenticator := newAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authenticator = authenticator
+	err, s.callbacks = newNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, s.blobs = newBlobStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = listener
+	s.grpcServer = s.newGRPCServer()
+
+	served := make(chan struct{})
+	go func() {
+		s.Serve()
+		close(served)
+	}()
+
+	connection, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		connection.Close()
+		s.grpcServer.Stop()
+		<-served
+	})
+
+	return s, connection
+}
+
+func newRequest() *job.JobRequest {
+	return &job.JobRequest{
+		SourceCodeFileName: "main.py",
+		SourceCode:         "print(input())",
+		RunScript:          "python3 main.py",
+		Stdin:              "hello",
+		ResourceLimits: &job.ResourceLimits{
+			MaxExecutionTime: 500,
+		},
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	tests := []struct {
+		name           string
+		behaviors      map[string]fake.Behavior
+		maxCompileTime int64
+		failCreate     int
+		status         string
+		runStdout      string
+		attempts       int32
+		code           codes.Code
+		createdCount   int
+	}{
+		{
+			name:         "finished",
+			behaviors:    map[string]fake.Behavior{"run.sh": {EchoStdin: true}},
+			status:       container.StatusFinished,
+			runStdout:    "hello",
+			attempts:     1,
+			createdCount: 1,
+		},
+		{
+			name:         "compile error is a verdict",
+			behaviors:    map[string]fake.Behavior{"compile.sh": {ExitCode: 2}},
+			status:       container.StatusCompileError,
+			attempts:     1,
+			createdCount: 1,
+		},
+		{
+			name:           "compile time limit is a verdict",
+			behaviors:      map[string]fake.Behavior{"compile.sh": {Delay: time.Second}},
+			maxCompileTime: 50,
+			status:         container.StatusCompileError,
+			attempts:       1,
+			createdCount:   1,
+		},
+		{
+			name:         "time limit is not retried",
+			behaviors:    map[string]fake.Behavior{"run.sh": {Delay: time.Second}},
+			status:       container.StatusTimeLimitExceeded,
+			attempts:     1,
+			createdCount: 1,
+		},
+		{
+			name:         "binary output is returned",
+			behaviors:    map[string]fake.Behavior{"run.sh": {Stdout: "\xff\xfe"}},
+			status:       container.StatusFinished,
+			runStdout:    "\uFFFD",
+			attempts:     1,
+			createdCount: 1,
+		},
+		{
+			name:         "infrastructure failures are retried",
+			behaviors:    map[string]fake.Behavior{"run.sh": {Stdout: "ok"}},
+			failCreate:   2,
+			status:       container.StatusFinished,
+			runStdout:    "ok",
+			attempts:     3,
+			createdCount: 1,
+		},
+		{
+			name:       "persistent infrastructure failure",
+			failCreate: 10,
+			code:       codes.Unavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runtime := fake.NewRuntime()
+			for command, behavior := range test.behaviors {
+				runtime.SetBehavior(command, behavior)
+			}
+			runtime.FailNext(fake.OperationCreate, test.failCreate)
+			client := job.NewJobClient(startTestServer(t, runtime))
+
+			request := newRequest()
+			request.ResourceLimits.MaxCompileTime = test.maxCompileTime
+			response, err := client.Submit(context.Background(), request)
+			if status.Code(err) != test.code {
+				t.Fatalf("error = %v, want code %v", err, test.code)
+			}
+			if err != nil {
+				return
+			}
+			if response.Status != test.status {
+				t.Errorf("status = %q, want %q", response.Status, test.status)
+			}
+			if response.RunStdout != test.runStdout {
+				t.Errorf("run stdout = %q, want %q", response.RunStdout, test.runStdout)
+			}
+			if response.Attempts != test.attempts {
+				t.Errorf("attempts = %d, want %d", response.Attempts, test.attempts)
+			}
+			if runtime.CreatedSandboxes() != test.createdCount {
+				t.Errorf("%d sandboxes created, want %d", runtime.CreatedSandboxes(), test.createdCount)
+			}
+			if runtime.LiveSandboxes() != 0 {
+				t.Errorf("%d sandboxes were not removed", runtime.LiveSandboxes())
+			}
+		})
+	}
+}
+
+func TestSubmitConcurrently(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: 10 * time.Millisecond, EchoStdin: true})
+	client := job.NewJobClient(startTestServer(t, runtime))
+
+	var wait sync.WaitGroup
+	for range 10 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			response, err := client.Submit(context.Background(), newRequest())
+			if err != nil {
+				t.Errorf("Submit returned error: %v", err)
+				return
+			}
+			if response.RunStdout != "hello" {
+				t.Errorf("run stdout = %q, want %q", response.RunStdout, "hello")
+			}
+		}()
+	}
+	wait.Wait()
+
+	if runtime.CreatedSandboxes() != 10 {
+		t.Errorf("%d sandboxes created, want 10", runtime.CreatedSandboxes())
+	}
+}
+
+func TestResizePool(t *testing.T) {
+	s, connection := newTestServer(t, fake.NewRuntime())
+	client := admin.NewAdminClient(connection)
+
+	response, err := client.ResizePool(context.Background(), &admin.ResizePoolRequest{WorkerCount: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.PreviousWorkerCount != 2 || response.WorkerCount != 5 {
+		t.Errorf("response = %v, want 2 -> 5", response)
+	}
+
+	_, err = client.ResizePool(context.Background(), &admin.ResizePoolRequest{WorkerCount: 0})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("error = %v, want InvalidArgument", err)
+	}
+
+	// Reloading the unchanged configuration restores the configured size
+	configuration := *s.currentConfig()
+	if err := s.Reload(&configuration); err != nil {
+		t.Fatal(err)
+	}
+	if s.pool.WorkerCount() != 2 {
+		t.Errorf("worker count after reload = %d, want 2", s.pool.WorkerCount())
+	}
+}
+
+func TestReloadKeepsRestartSettings(t *testing.T) {
+	s, _ := newTestServer(t, fake.NewRuntime())
+	current := *s.currentConfig()
+
+	configuration := current
+	configuration.Store.Path = "other.db"
+	configuration.Store.Retention = time.Hour
+	configuration.Cache.MaxEntries = current.Cache.MaxEntries + 1
+	configuration.Cache.Enabled = !current.Cache.Enabled
+	configuration.Metrics.ListenAddress = ":9999"
+	configuration.Callback.Timeout = current.Callback.Timeout + time.Second
+	configuration.Callback.AllowedHosts = []string{"lms.example.com"}
+	if err := s.Reload(&configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := s.currentConfig()
+	if reloaded.Store.Path != current.Store.Path || reloaded.Cache.MaxEntries != current.Cache.MaxEntries ||
+		reloaded.Metrics != current.Metrics || reloaded.Callback.Timeout != current.Callback.Timeout {
+		t.Errorf("settings only read on startup changed: %+v", reloaded)
+	}
+	if reloaded.Store.Retention != time.Hour || reloaded.Cache.Enabled == current.Cache.Enabled ||
+		!slices.Equal(reloaded.Callback.AllowedHosts, []string{"lms.example.com"}) {
+		t.Errorf("settings read while running did not change: %+v", reloaded)
+	}
+}
+
+func TestJobRecords(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "ok"})
+	runtime.SetBehavior("compile.sh", fake.Behavior{})
+	client := job.NewJobClient(startTestServer(t, runtime))
+
+	request := newRequest()
+	request.Tenant = "course-1"
+	response, err := client.Submit(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.JobId == "" {
+		t.Fatal("response has no job ID")
+	}
+	var phases []string
+	for _, phase := range response.Phases {
+		phases = append(phases, phase.Name)
+	}
+	wantPhases := []string{container.PhaseQueue, container.PhasePrepare, container.PhaseSetup, container.PhaseCompile, container.PhaseRun}
+	if fmt.Sprint(phases) != fmt.Sprint(wantPhases) {
+		t.Errorf("phases = %v, want %v", phases, wantPhases)
+	}
+
+	record, err := client.GetJob(context.Background(), &job.GetJobRequest{JobId: response.JobId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != job.JobState_JOB_STATE_COMPLETED || record.Tenant != "course-1" {
+		t.Errorf("record state = %v, tenant = %q", record.State, record.Tenant)
+	}
+	if record.Response.GetRunStdout() != "ok" || record.Request.GetSourceCode() != request.SourceCode {
+		t.Errorf("record does not hold the request and response: %v", record)
+	}
+	if record.CreatedAt == 0 || record.StartedAt < record.CreatedAt || record.FinishedAt < record.StartedAt {
+		t.Errorf("timestamps out of order: created %d, started %d, finished %d", record.CreatedAt, record.StartedAt, record.FinishedAt)
+	}
+
+	runtime.FailNext(fake.OperationCreate, 10)
+	if _, err := client.Submit(context.Background(), newRequest()); err == nil {
+		t.Fatal("Submit succeeded, want an infrastructure failure")
+	}
+
+	tests := []struct {
+		request *job.ListJobsRequest
+		count   int
+	}{
+		{&job.ListJobsRequest{}, 2},
+		{&job.ListJobsRequest{Tenant: "course-1"}, 1},
+		{&job.ListJobsRequest{State: job.JobState_JOB_STATE_FAILED}, 1},
+		{&job.ListJobsRequest{CreatedAfter: time.Now().Add(time.Minute).UnixMilli()}, 0},
+		{&job.ListJobsRequest{Limit: 1}, 1},
+	}
+	for _, test := range tests {
+		listed, err := client.ListJobs(context.Background(), test.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed.Jobs) != test.count {
+			t.Errorf("ListJobs(%v) returned %d jobs, want %d", test.request, len(listed.Jobs), test.count)
+		}
+	}
+
+	_, err = client.GetJob(context.Background(), &job.GetJobRequest{JobId: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("error = %v, want NotFound", err)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{EchoStdin: true})
+	client := job.NewJobClient(startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Cache.Enabled = true
+	}))
+
+	submit := func(request *job.JobRequest) *job.JobResponse {
+		t.Helper()
+		response, err := client.Submit(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	first := submit(newRequest())
+	if first.Cached {
+		t.Error("first response was served from the cache")
+	}
+
+	request := newRequest()
+	request.Tenant = "course-1"
+	second := submit(request)
+	if !second.Cached || second.RunStdout != "hello" || second.JobId == first.JobId {
+		t.Errorf("second response = %v, want a cached copy with a new job ID", second)
+	}
+	if runtime.CreatedSandboxes() != 1 {
+		t.Errorf("%d sandboxes created, want 1", runtime.CreatedSandboxes())
+	}
+	record, err := client.GetJob(context.Background(), &job.GetJobRequest{JobId: second.JobId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.Response.GetCached() || record.Tenant != "course-1" {
+		t.Errorf("cached job was not recorded: %v", record)
+	}
+
+	request = newRequest()
+	request.BypassCache = true
+	if submit(request).Cached {
+		t.Error("bypass_cache was ignored")
+	}
+
+	runtime.RebuildImage()
+	if submit(newRequest()).Cached {
+		t.Error("response cached for a previous image was served")
+	}
+
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: time.Second})
+	request = newRequest()
+	request.Stdin = "slow"
+	submit(request)
+	if submit(request).Cached {
+		t.Error("time limit exceeded verdict was cached")
+	}
+	if runtime.CreatedSandboxes() != 5 {
+		t.Errorf("%d sandboxes created, want 5", runtime.CreatedSandboxes())
+	}
+}
+
+// spanExporter records the spans of the whole test binary. The global tracer
+// provider is installed once, package level tracers keep using the first one.
+var spanExporter = sync.OnceValue(func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+})
+
+func TestTracing(t *testing.T) {
+	exporter := spanExporter()
+	exporter.Reset()
+
+	client := job.NewJobClient(startTestServer(t, container.InstrumentRuntime(fake.NewRuntime())))
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if _, err := client.Submit(ctx, newRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %s is not part of the incoming trace", span.Name)
+		}
+		names[span.Name] = true
+	}
+	for _, name := range []string{"ExecutionEngine.Job/Submit", "queue", "attempt", "prepare", "setup", "compile", "run", "runtime.Create", "runtime.Exec"} {
+		if !names[name] {
+			t.Errorf("no %s span in %v", name, names)
+		}
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	s, connection := newTestServer(t, fake.NewRuntime())
+	client := admin.NewAdminClient(connection)
+
+	response, err := client.SetLogLevel(context.Background(), &admin.SetLogLevelRequest{Level: "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.SetLogLevel(context.Background(), &admin.SetLogLevelRequest{Level: response.PreviousLevel})
+	})
+	if response.Level != "error" {
+		t.Errorf("level = %q, want error", response.Level)
+	}
+
+	_, err = client.SetLogLevel(context.Background(), &admin.SetLogLevelRequest{Level: "loud"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("error = %v, want InvalidArgument", err)
+	}
+
+	// Reloading the unchanged configuration restores the configured level
+	configuration := *s.currentConfig()
+	if err := s.Reload(&configuration); err != nil {
+		t.Fatal(err)
+	}
+	if logConfig := configuration.Log; !log.Configured(&log.Options{Format: logConfig.Format, Level: logConfig.Level}) || log.Level() == "error" {
+		t.Errorf("level after reload = %s, want the configured one", log.Level())
+	}
+}
+
+func TestSubmitImages(t *testing.T) {
+	runtime := fake.NewRuntime()
+	client := job.NewJobClient(startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Images = []config.ImageConfig{{Name: "c", Tag: "gcc:14"}, {Name: "python", Tag: "python:3.12"}}
+	}))
+
+	for i, name := range []string{"", "python"} {
+		request := newRequest()
+		request.Image = name
+		if _, err := client.Submit(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+		err, spec := runtime.Spec(fmt.Sprintf("fake-%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"": "gcc:14", "python": "python:3.12"}[name]
+		if spec.Image != want {
+			t.Errorf("image %q ran in %q, want %q", name, spec.Image, want)
+		}
+	}
+
+	request := newRequest()
+	request.Image = "ruby"
+	if _, err := client.Submit(context.Background(), request); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestSubmitInvalidRequest(t *testing.T) {
+	client := job.NewJobClient(startTestServer(t, fake.NewRuntime()))
+
+	tests := []struct {
+		name   string
+		modify func(request *job.JobRequest)
+		field  string
+	}{
+		{"missing file name", func(r *job.JobRequest) { r.SourceCodeFileName = "" }, "source_code_file_name"},
+		{"path traversal", func(r *job.JobRequest) { r.SourceCodeFileName = "../main.py" }, "source_code_file_name"},
+		{"reserved file name", func(r *job.JobRequest) { r.SourceCodeFileName = "run.sh" }, "source_code_file_name"},
+		{"missing run script", func(r *job.JobRequest) { r.RunScript = "" }, "run_script"},
+		{"malformed variable", func(r *job.JobRequest) { r.EnvironmentVariables = []string{"A=1", "1B=2"} }, "environment_variables[1]"},
+		{"large stdin", func(r *job.JobRequest) { r.Stdin = strings.Repeat("a", 3<<20) }, "stdin"},
+		{"stdin twice", func(r *job.JobRequest) { r.StdinBytes = []byte{0xff} }, "stdin_bytes"},
+		{"malformed stdin blob", func(r *job.JobRequest) { r.Stdin, r.StdinBlob = "", "abc" }, "stdin_blob"},
+		{"file outside workspace", func(r *job.JobRequest) { r.Files = []*job.InputFile{{Name: "../data", Blob: strings.Repeat("a", 64)}} }, "files[0].name"},
+		{"file replacing the source", func(r *job.JobRequest) { r.Files = []*job.InputFile{{Name: "main.py", Blob: strings.Repeat("a", 64)}} }, "files[0].name"},
+		{"negative limit", func(r *job.JobRequest) { r.ResourceLimits.MaxMemory = -1 }, "resource_limits.max_memory"},
+		{"relative callback URL", func(r *job.JobRequest) { r.CallbackUrl = "/results" }, "callback_url"},
+		{"malformed output pattern", func(r *job.JobRequest) { r.OutputFiles = []string{"*.csv", "[a-"} }, "output_files[1]"},
+		{"output pattern outside workspace", func(r *job.JobRequest) { r.OutputFiles = []string{"../*.csv"} }, "output_files[0]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := newRequest()
+			test.modify(request)
+			_, err := client.Submit(context.Background(), request, grpc.MaxCallSendMsgSize(8<<20))
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("error = %v, want InvalidArgument", err)
+			}
+			var fields []string
+			for _, detail := range status.Convert(err).Details() {
+				if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+					for _, violation := range badRequest.FieldViolations {
+						fields = append(fields, violation.Field)
+					}
+				}
+			}
+			if len(fields) != 1 || fields[0] != test.field {
+				t.Errorf("violations = %v, want %s", fields, test.field)
+			}
+		})
+	}
+}
+
+func TestSubmitLimits(t *testing.T) {
+	runtime := fake.NewRuntime()
+	client := job.NewJobClient(startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Limits.Default.MaxMemory = 64 << 20
+		cfg.Limits.Maximum.MaxMemory = 128 << 20
+	}))
+
+	for i, test := range []struct {
+		requested, want int64
+	}{
+		{0, 64 << 20},
+		{96 << 20, 96 << 20},
+		{1 << 30, 128 << 20},
+	} {
+		request := newRequest()
+		request.ResourceLimits.MaxMemory = test.requested
+		if _, err := client.Submit(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+		err, spec := runtime.Spec(fmt.Sprintf("fake-%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.MemoryLimit != test.want {
+			t.Errorf("requested %d bytes, got %d, want %d", test.requested, spec.MemoryLimit, test.want)
+		}
+	}
+}
+
+func TestNetworkAccessWithoutAuthentication(t *testing.T) {
+	runtime := fake.NewRuntime()
+	connection := startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Auth.Enabled = false
+		cfg.Security.NetworkDisabled = true
+	})
+	client := job.NewJobClient(connection)
+
+	request := newRequest()
+	request.NetworkAccess = true
+	if _, err := client.Submit(context.Background(), request); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("anonymous network error = %v, want PermissionDenied", err)
+	}
+	if runtime.CreatedSandboxes() != 0 {
+		t.Errorf("%d sandboxes were created for a rejected job", runtime.CreatedSandboxes())
+	}
+	if _, err := client.Submit(context.Background(), newRequest()); err != nil {
+		t.Errorf("anonymous job without network: %v", err)
+	}
+}
+
+func TestWarmPool(t *testing.T) {
+	configure := func(cfg *config.Config) {
+		cfg.Images = []config.ImageConfig{{Name: "c", Tag: "gcc:14"}, {Name: "python", Tag: "python:3.12"}}
+	}
+	cfg := config.Default()
+	configure(cfg)
+	runtime := fake.NewRuntime()
+	warmRuntime := warm.NewRuntime(runtime, &warm.Options{Size: 1, Specs: warmSpecs(cfg)})
+	for warmRuntime.ReadySandboxes() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	connection := startTestServer(t, warmRuntime, configure)
+	client := job.NewJobClient(connection)
+
+	// A job without limits gets the default memory limit, the one of the
+	// ready sandboxes
+	request := newRequest()
+	request.Image = "python"
+	if _, err := client.Submit(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	var used []string
+	for _, sandboxID := range []string{"fake-1", "fake-2"} {
+		if err, _ := runtime.File(sandboxID, "main.py"); err == nil {
+			_, spec := runtime.Spec(sandboxID)
+			used = append(used, spec.Image)
+		}
+	}
+	if fmt.Sprint(used) != "[python:3.12]" {
+		t.Errorf("ready sandboxes used by the job: %v, want the python one", used)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	hash := func(key string) string {
+		digest := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(digest[:])
+	}
+	runtime := fake.NewRuntime()
+	connection := startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Images = []config.ImageConfig{{Name: "c", Tag: "gcc:14"}, {Name: "python", Tag: "python:3.12"}}
+		cfg.Auth.Enabled = true
+		cfg.Auth.Clients = []config.ClientConfig{
+			{
+				Name:         "lms",
+				APIKeyHashes: []string{hash("lms-key")},
+				Images:       []string{"python"},
+				Limits:       config.ResourceLimits{MaxMemory: 32 << 20},
+			},
+			{Name: "grader", APIKeyHashes: []string{hash("grader-key")}, NetworkAccess: true},
+			{Name: "operator", APIKeyHashes: []string{hash("operator-key")}, Admin: true},
+		}
+	})
+	client := job.NewJobClient(connection)
+	adminClient := admin.NewAdminClient(connection)
+	as := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyHeader, key)
+	}
+	pythonRequest := func() *job.JobRequest {
+		request := newRequest()
+		request.Image = "python"
+		return request
+	}
+
+	if _, err := client.Submit(context.Background(), pythonRequest()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("anonymous error = %v, want Unauthenticated", err)
+	}
+	if _, err := client.Submit(as("wrong-key"), pythonRequest()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong key error = %v, want Unauthenticated", err)
+	}
+	if _, err := client.Submit(as("lms-key"), newRequest()); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("forbidden image error = %v, want PermissionDenied", err)
+	}
+	networkRequest := pythonRequest()
+	networkRequest.NetworkAccess = true
+	if _, err := client.Submit(as("lms-key"), networkRequest); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("forbidden network error = %v, want PermissionDenied", err)
+	}
+	if _, err := adminClient.ResizePool(as("lms-key"), &admin.ResizePoolRequest{WorkerCount: 3}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ResizePool error = %v, want PermissionDenied", err)
+	}
+
+	request := pythonRequest()
+	request.ResourceLimits.MaxMemory = 1 << 30
+	response, err := client.Submit(as("lms-key"), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, spec := runtime.Spec("fake-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.MemoryLimit != 32<<20 || spec.NetworkAccess {
+		t.Errorf("spec = %+v, want the memory limit of the client and no network", spec)
+	}
+	if _, err := client.Submit(as("grader-key"), networkRequest); err != nil {
+		t.Fatal(err)
+	}
+	if err, spec := runtime.Spec("fake-2"); err != nil || !spec.NetworkAccess {
+		t.Errorf("spec = %+v, %v, want network access", spec, err)
+	}
+
+	record, err := client.GetJob(as("lms-key"), &job.GetJobRequest{JobId: response.JobId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Client != "lms" {
+		t.Errorf("record client = %q, want lms", record.Client)
+	}
+	if _, err := client.GetJob(as("grader-key"), &job.GetJobRequest{JobId: response.JobId}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetJob of another client error = %v, want NotFound", err)
+	}
+	if _, err := client.GetJob(as("operator-key"), &job.GetJobRequest{JobId: response.JobId}); err != nil {
+		t.Errorf("GetJob as administrator error = %v", err)
+	}
+	list, err := client.ListJobs(as("grader-key"), &job.ListJobsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Jobs) != 1 || list.Jobs[0].Client != "grader" {
+		t.Errorf("grader lists %v, want only its own job", list.Jobs)
+	}
+	if _, err := adminClient.ResizePool(as("operator-key"), &admin.ResizePoolRequest{WorkerCount: 3}); err != nil {
+		t.Errorf("ResizePool as administrator error = %v", err)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	runtime := fake.NewRuntime()
+	// Jobs return at once, only their processor time uses up a budget
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "ok", CPUTime: time.Minute})
+	client := job.NewJobClient(startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Quotas.Key = config.QuotaKeyTenant
+		cfg.Quotas.Default = config.QuotaConfig{Rate: 0.01, Burst: 1}
+		cfg.Quotas.Overrides = map[string]config.QuotaConfig{"unlimited": {}, "budget": {DailyCPUTime: time.Minute}}
+	}))
+	submit := func(tenant string, header *metadata.MD) error {
+		request := newRequest()
+		request.Tenant = tenant
+		request.BypassCache = true
+		_, err := client.Submit(context.Background(), request, grpc.Header(header))
+		return err
+	}
+
+	var header metadata.MD
+	if err := submit("course-1", &header); err != nil {
+		t.Fatal(err)
+	}
+	err := submit("course-1", &header)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("error = %v, want ResourceExhausted", err)
+	}
+	if retryAfter := header.Get(retryAfterHeader); len(retryAfter) != 1 || retryAfter[0] != "100" {
+		t.Errorf("retry-after = %v, want 100", retryAfter)
+	}
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	if retryInfo == nil || retryInfo.RetryDelay.AsDuration() != 100*time.Second {
+		t.Errorf("retry info = %v, want 100s", retryInfo)
+	}
+
+	if err := submit("course-2", &header); err != nil {
+		t.Errorf("other tenant: %v", err)
+	}
+	for range 3 {
+		if err := submit("unlimited", &header); err != nil {
+			t.Errorf("tenant without quota: %v", err)
+		}
+	}
+
+	if err := submit("budget", &header); err != nil {
+		t.Fatal(err)
+	}
+	if err := submit("budget", &header); status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), "CPU time") {
+		t.Errorf("error = %v, want the daily CPU time exhausted", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: 200 * time.Millisecond})
+	s, connection := newTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Pool.Workers = 1
+		cfg.Health.CheckInterval = 10 * time.Millisecond
+		cfg.Health.MaxQueuedJobs = 1
+		cfg.Health.DrainDelay = 200 * time.Millisecond
+		cfg.Auth.Enabled = true
+		cfg.Auth.Clients = []config.ClientConfig{{Name: "lms", APIKeyHashes: []string{fmt.Sprintf("%x", sha256.Sum256([]byte("key")))}}}
+	})
+	healthClient := healthpb.NewHealthClient(connection)
+	waitForStatus := func(service string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			// Health checks need no credentials
+			response, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err == nil && response.Status == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("status of %q = %v, %v, want %v", service, response.GetStatus(), err, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitForStatus("", healthpb.HealthCheckResponse_SERVING)
+	waitForStatus(job.Job_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	// One job runs and two wait, which is more than the server accepts
+	client := job.NewJobClient(connection)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyHeader, "key")
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := newRequest()
+			request.BypassCache = true
+			if _, err := client.Submit(ctx, request); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitForStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	wg.Wait()
+	waitForStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	drained := make(chan struct{})
+	go func() {
+		s.Drain()
+		close(drained)
+	}()
+	waitForStatus(job.Job_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return")
+	}
+}
+
+func TestReflection(t *testing.T) {
+	// Reflection needs no credentials
+	connection := startTestServer(t, fake.NewRuntime(), func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.Clients = []config.ClientConfig{{Name: "lms", APIKeyHashes: []string{fmt.Sprintf("%x", sha256.Sum256([]byte("key")))}}}
+	})
+	stream, err := reflectionpb.NewServerReflectionClient(connection).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.Name)
+	}
+	for _, want := range []string{job.Job_ServiceDesc.ServiceName, admin.Admin_ServiceDesc.ServiceName, healthpb.Health_ServiceDesc.ServiceName} {
+		if !slices.Contains(services, want) {
+			t.Errorf("services = %v, want %s", services, want)
+		}
+	}
+}
+
+func TestUploadBlob(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{EchoStdin: true})
+	connection := startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Blobs.MaxBlobBytes = 1 << 20
+		cfg.Auth.Enabled = true
+		cfg.Auth.Clients = []config.ClientConfig{{Name: "lms", APIKeyHashes: []string{fmt.Sprintf("%x", sha256.Sum256([]byte("key")))}}}
+	})
+	client := job.NewJobClient(connection)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyHeader, "key")
+
+	upload := func(ctx context.Context, content []byte, chunkSize int, digest string) (*job.UploadBlobResponse, error) {
+		t.Helper()
+		stream, err := client.UploadBlob(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i == 0 || i < len(content); i += chunkSize {
+			request := &job.UploadBlobRequest{Chunk: content[i:min(i+chunkSize, len(content))]}
+			if i == 0 {
+				request.Sha256 = digest
+			}
+			if err := stream.Send(request); err != nil {
+				// The server failed the upload, CloseAndRecv returns why
+				break
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	input := bytes.Repeat([]byte("0123456789"), 50_000)
+	sum := sha256.Sum256(input)
+	digest := hex.EncodeToString(sum[:])
+	if _, err := upload(context.Background(), input, 64<<10, ""); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("upload without credentials error = %v, want Unauthenticated", err)
+	}
+	response, err := upload(ctx, input, 64<<10, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Sha256 != digest || response.Size != int64(len(input)) {
+		t.Errorf("response = %v, want %s of %d bytes", response, digest, len(input))
+	}
+	if _, err := upload(ctx, []byte("other"), 64<<10, digest); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("upload with another digest error = %v, want InvalidArgument", err)
+	}
+	if _, err := upload(ctx, make([]byte, 2<<20), 64<<10, ""); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("too large upload error = %v, want ResourceExhausted", err)
+	}
+
+	request := newRequest()
+	request.Stdin = ""
+	request.StdinBlob = digest
+	request.Files = []*job.InputFile{{Name: "tests/expected.txt", Blob: digest}}
+	jobResponse, err := client.Submit(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobResponse.RunStdout != string(input) {
+		t.Errorf("run stdout has %d bytes, want the %d bytes of the blob", len(jobResponse.RunStdout), len(input))
+	}
+	if err, content := runtime.File("fake-1", "tests/expected.txt"); err != nil || !bytes.Equal(content, input) {
+		t.Errorf("file has %d bytes, %v, want the blob", len(content), err)
+	}
+
+	sum = sha256.Sum256([]byte("never uploaded"))
+	request.StdinBlob = hex.EncodeToString(sum[:])
+	if _, err := client.Submit(ctx, request); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("missing blob error = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestBlobsOfRunningJobs(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("setup.sh", fake.Behavior{Delay: 200 * time.Millisecond})
+	runtime.SetBehavior("run.sh", fake.Behavior{EchoStdin: true})
+	s, connection := newTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Blobs.MaxBytes = 10
+	})
+	client := job.NewJobClient(connection)
+
+	put := func(content string) string {
+		t.Helper()
+		err, info := s.blobs.Put(strings.NewReader(content), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Digest
+	}
+	submit := func(digest string) (*job.JobResponse, error) {
+		request := newRequest()
+		request.Stdin = ""
+		request.StdinBlob = digest
+		return client.Submit(context.Background(), request)
+	}
+	// whileRunning calls f once the next job has a sandbox, while it runs
+	// its setup script
+	whileRunning := func(f func()) {
+		created := runtime.CreatedSandboxes()
+		go func() {
+			for runtime.CreatedSandboxes() == created {
+				time.Sleep(time.Millisecond)
+			}
+			f()
+		}()
+	}
+
+	// Blobs uploaded while a job runs do not evict the blobs of the job
+	digest := put("0123456789")
+	whileRunning(func() { put("abcdefghij") })
+	response, err := submit(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RunStdout != "0123456789" {
+		t.Errorf("run stdout = %q, want the pinned blob", response.RunStdout)
+	}
+	put("ABCDEFGHIJ")
+	if err, _ := s.blobs.Stat(digest); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("blob of the finished job: %v, want it evicted", err)
+	}
+
+	// A blob removed anyway fails the job without retrying it
+	digest = put("0123456789")
+	created := runtime.CreatedSandboxes()
+	whileRunning(func() { os.Remove(filepath.Join(s.config.Blobs.Directory, digest)) })
+	_, err = submit(digest)
+	if status.Code(err) != codes.FailedPrecondition || !strings.Contains(err.Error(), digest) {
+		t.Errorf("error = %v, want FailedPrecondition naming the blob", err)
+	}
+	if attempts := runtime.CreatedSandboxes() - created; attempts != 1 {
+		t.Errorf("job ran %d times, want once", attempts)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Delay: 10 * time.Second})
+	s, connection := newTestServer(t, runtime)
+	client := job.NewJobClient(connection)
+
+	submitted := make(chan error, 1)
+	go func() {
+		_, err := client.Submit(context.Background(), newRequest())
+		submitted <- err
+	}()
+	var jobID string
+	for jobID == "" {
+		s.runningJobs.Range(func(key, _ any) bool {
+			jobID = key.(string)
+			return false
+		})
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := client.CancelJob(context.Background(), &job.CancelJobRequest{JobId: jobID}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-submitted:
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("Submit error = %v, want Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit did not return after the job was cancelled")
+	}
+	record, err := client.GetJob(context.Background(), &job.GetJobRequest{JobId: jobID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != job.JobState_JOB_STATE_CANCELLED {
+		t.Errorf("record state = %v, want cancelled", record.State)
+	}
+
+	if _, err := client.CancelJob(context.Background(), &job.CancelJobRequest{JobId: jobID}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("cancelling a finished job error = %v, want FailedPrecondition", err)
+	}
+	if _, err := client.CancelJob(context.Background(), &job.CancelJobRequest{JobId: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("cancelling a missing job error = %v, want NotFound", err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "ok", Stderr: "\xff"})
+	s, _ := newTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		digest := sha256.Sum256([]byte("lms-key"))
+		cfg.Auth.Clients = []config.ClientConfig{{Name: "lms", APIKeyHashes: []string{hex.EncodeToString(digest[:])}}}
+	})
+	server := httptest.NewServer(gateway.NewHandler(s, &gateway.Options{
+		Interceptor:     s.unaryInterceptor(),
+		MaxRequestBytes: s.config.Gateway.MaxRequestBytes,
+	}))
+	defer server.Close()
+
+	do := func(method, path, body string, header ...string) (*http.Response, []byte) {
+		t.Helper()
+		request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set(auth.APIKeyHeader, "lms-key")
+		for i := 0; i < len(header); i += 2 {
+			request.Header.Set(header[i], header[i+1])
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response, data
+	}
+	body, err := protojson.Marshal(newRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response, _ := do(http.MethodPost, "/jobs", string(body), auth.APIKeyHeader, "wrong-key"); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong key status = %d, want 401", response.StatusCode)
+	}
+	if response, _ := do(http.MethodPost, "/jobs", `{"runScript": "python3 main.py"}`); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid request status = %d, want 400", response.StatusCode)
+	}
+
+	response, data := do(http.MethodPost, "/jobs", string(body))
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", response.StatusCode, data)
+	}
+	jobResponse := &job.JobResponse{}
+	if err := protojson.Unmarshal(data, jobResponse); err != nil {
+		t.Fatal(err)
+	}
+	if jobResponse.RunStdout != "ok" {
+		t.Errorf("run stdout = %q, want ok", jobResponse.RunStdout)
+	}
+
+	response, data = do(http.MethodGet, "/jobs/"+jobResponse.JobId, "")
+	record := &job.JobRecord{}
+	if err := protojson.Unmarshal(data, record); err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d, error = %v: %s", response.StatusCode, err, data)
+	}
+	if record.State != job.JobState_JOB_STATE_COMPLETED || record.Client != "lms" {
+		t.Errorf("record state = %v, client = %q", record.State, record.Client)
+	}
+	if response, _ := do(http.MethodGet, "/jobs/missing", ""); response.StatusCode != http.StatusNotFound {
+		t.Errorf("missing job status = %d, want 404", response.StatusCode)
+	}
+	if response, _ := do(http.MethodDelete, "/jobs/"+jobResponse.JobId, ""); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("cancelling a finished job status = %d, want 400", response.StatusCode)
+	}
+
+	response, data = do(http.MethodPost, "/jobs", `{"sourceCodeFileName": "main.py", "runScript": "python3 main.py", "bypassCache": true}`, "Accept", "text/event-stream")
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream status = %d, content type %q: %s", response.StatusCode, response.Header.Get("Content-Type"), data)
+	}
+	wantOutput := `event: output
+data: {"phase":"run","stream":"stdout","data":"ok"}`
+	// Output that is not UTF-8 is sent in base64
+	wantBinary := `event: output
+data: {"phase":"run","stream":"stderr","data_base64":"/w=="}`
+	if !strings.Contains(string(data), wantOutput) || !strings.Contains(string(data), wantBinary) || !strings.Contains(string(data), "event: response\n") {
+		t.Errorf("stream = %s, want the output followed by the response", data)
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("callback secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	delivered := make(chan *job.JobResponse, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if !callback.Verify([]byte("callback secret"), r.Header.Get(callback.TimestampHeader), body, r.Header.Get(callback.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response := &job.JobResponse{}
+		if err := protojson.Unmarshal(body, response); err != nil {
+			t.Error(err)
+		}
+		delivered <- response
+	}))
+	defer receiver.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	runtime := fake.NewRuntime()
+	runtime.SetBehavior("run.sh", fake.Behavior{Stdout: "ok"})
+	client := job.NewJobClient(startTestServer(t, runtime, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		digest := sha256.Sum256([]byte("lms-key"))
+		cfg.Auth.Clients = []config.ClientConfig{{Name: "lms", APIKeyHashes: []string{hex.EncodeToString(digest[:])}, CallbackURL: receiver.URL}}
+		cfg.Callback.SecretFile = secretFile
+		cfg.Callback.AllowedHosts = []string{"127.0.0.1"}
+		cfg.Callback.MaxAttempts = 2
+		cfg.Callback.InitialBackoff = time.Millisecond
+	}))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.APIKeyHeader, "lms-key")
+	waitForCallback := func(jobID string) *job.JobRecord {
+		t.Helper()
+		for range 500 {
+			record, err := client.GetJob(ctx, &job.GetJobRequest{JobId: jobID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.CallbackState != job.CallbackState_CALLBACK_STATE_PENDING {
+				return record
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("callback is still pending")
+		return nil
+	}
+
+	response, err := client.Submit(ctx, newRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case received := <-delivered:
+		if received.JobId != response.JobId || received.RunStdout != "ok" {
+			t.Errorf("callback received %v, want the response of job %s", received, response.JobId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered to the default URL of the client")
+	}
+	if record := waitForCallback(response.JobId); record.CallbackState != job.CallbackState_CALLBACK_STATE_DELIVERED || record.CallbackAttempts != 1 {
+		t.Errorf("callback state = %v after %d attempts, want delivered", record.CallbackState, record.CallbackAttempts)
+	}
+
+	request := newRequest()
+	request.CallbackUrl = failing.URL
+	response, err = client.Submit(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := waitForCallback(response.JobId)
+	if record.CallbackState != job.CallbackState_CALLBACK_STATE_FAILED || record.CallbackAttempts != 2 || record.CallbackError == "" {
+		t.Errorf("callback state = %v after %d attempts (%q), want failed after 2", record.CallbackState, record.CallbackAttempts, record.CallbackError)
+	}
+	listed, err := client.ListJobs(ctx, &job.ListJobsRequest{CallbackState: job.CallbackState_CALLBACK_STATE_FAILED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Jobs) != 1 || listed.Jobs[0].JobId != response.JobId {
+		t.Errorf("failed callbacks = %v, want job %s", listed.Jobs, response.JobId)
+	}
+
+	request.CallbackUrl = "http://169.254.169.254/latest/meta-data"
+	if _, err := client.Submit(ctx, request); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("callback to a host not allowed error = %v, want PermissionDenied", err)
+	}
+}
@@ -1,51 +1,91 @@
 package server
 
 import (
+	"ExecutionEngine/blob"
 	"ExecutionEngine/container"
 	"ExecutionEngine/log"
+	"ExecutionEngine/pool"
 	"ExecutionEngine/proto/job"
 	"context"
-	"github.com/docker/docker/client"
+	"errors"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"time"
 )
 
 type taskInput struct {
 	ID      uuid.UUID
 	Request *job.JobRequest
+	// Image is the tag of the image the job runs in
+	Image string
+	// Record is the queued job record, it must not be modified
+	Record *job.JobRecord
+	// StartedAt is set when the first attempt starts
+	StartedAt time.Time
+	QueueSpan trace.Span
 }
 
 type taskOutput struct {
 	ID       uuid.UUID
 	Error    error
 	Response *job.JobResponse
+	Attempts int
 }
 
-func task(ctx context.Context, input *taskInput) *taskOutput {
-	log.L().Debug("Creating Docker client", zap.String("taskID", input.ID.String()))
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return &taskOutput{
-			input.ID,
-			err,
-			nil,
-		}
+func (s *Server) task(ctx context.Context, workerID int, input *taskInput) *taskOutput {
+	attempt := pool.Attempt(ctx)
+	if attempt == 1 {
+		input.QueueSpan.End()
+		input.StartedAt = time.Now()
+		s.updateRecord(ctx, input.Record, func(record *job.JobRecord) {
+			record.State = job.JobState_JOB_STATE_RUNNING
+			record.StartedAt = input.StartedAt.UnixMilli()
+		})
 	}
 
-	log.L().Debug("Running Docker container", zap.String("taskID", input.ID.String()))
-	err, response := container.Run(ctx, cli, dockerImageName, input.Request)
+	ctx, span := tracer.Start(ctx, "attempt", trace.WithAttributes(
+		attribute.Int("attempt", attempt),
+		attribute.Int("worker_id", workerID),
+	))
+	defer span.End()
+
+	log.FromContext(ctx).Debug("Running job", zap.Int("workerID", workerID), zap.Int("attempt", attempt))
+	err, response := container.Run(ctx, s.runtime, input.Image, input.Request, s.artifacts, s.blobs)
+	if response != nil {
+		span.SetAttributes(attribute.String("status", response.Status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if response != nil {
+		response.Attempts = int32(attempt)
+	}
 	if err != nil {
+		if container.IsInfrastructureError(err) {
+			log.FromContext(ctx).Warn("Task hit an infrastructure failure", zap.Error(err), zap.Int("attempt", attempt))
+		}
 		return &taskOutput{
 			input.ID,
 			err,
 			nil,
+			attempt,
 		}
 	}
 
-	log.L().Debug("Got task output", zap.String("taskID", input.ID.String()), zap.String("response", response.String()))
+	log.FromContext(ctx).Debug("Got task output", zap.String("response", response.String()))
 	return &taskOutput{
 		input.ID,
 		nil,
 		response,
+		attempt,
 	}
 }
+
+func isRetryable(output *taskOutput) bool {
+	// A blob removed from the store will not come back on its own
+	return container.IsInfrastructureError(output.Error) && !errors.Is(output.Error, blob.ErrNotFound)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"ExecutionEngine/blob"
+	"ExecutionEngine/config"
+	"ExecutionEngine/proto/job"
+	"fmt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxFileNameLength is the usual limit of file systems.
+const maxFileNameLength = 255
+
+const maxOutputFilePatterns = 32
+const maxInputFiles = 256
+
+var environmentVariablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// reservedFileNames are written next to the source code.
+var reservedFileNames = map[string]bool{
+	"setup.sh":   true,
+	"compile.sh": true,
+	"run.sh":     true,
+}
+
+// validateRequest returns an INVALID_ARGUMENT status listing every problem
+// of request.
+func validateRequest(request *job.JobRequest, limits *config.LimitsConfig) error {
+	var violations []*errdetails.BadRequest_FieldViolation
+	violate := func(field, format string, arguments ...interface{}) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: fmt.Sprintf(format, arguments...),
+		})
+	}
+
+	name := request.SourceCodeFileName
+	switch {
+	case name == "":
+		violate("source_code_file_name", "must not be empty")
+	case len(name) > maxFileNameLength:
+		violate("source_code_file_name", "must not be longer than %d bytes", maxFileNameLength)
+	case name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00"):
+		violate("source_code_file_name", "must be a plain file name")
+	case reservedFileNames[name]:
+		violate("source_code_file_name", "%s is reserved for the scripts of the job", name)
+	}
+	if request.RunScript == "" {
+		violate("run_script", "must not be empty")
+	}
+
+	for field, content := range map[string]string{
+		"source_code":    request.SourceCode,
+		"setup_script":   request.SetupScript,
+		"compile_script": request.CompileScript,
+		"run_script":     request.RunScript,
+	} {
+		if int64(len(content)) > limits.MaxSourceSize {
+			violate(field, "must not be larger than %d bytes", limits.MaxSourceSize)
+		}
+	}
+	if int64(len(request.Stdin)) > limits.MaxStdinSize {
+		violate("stdin", "must not be larger than %d bytes", limits.MaxStdinSize)
+	}
+	if int64(len(request.StdinBytes)) > limits.MaxStdinSize {
+		violate("stdin_bytes", "must not be larger than %d bytes", limits.MaxStdinSize)
+	}
+	if request.Stdin != "" && len(request.StdinBytes) > 0 {
+		violate("stdin_bytes", "must be empty when stdin is set")
+	}
+	if request.StdinBlob != "" {
+		if !blob.ValidDigest(request.StdinBlob) {
+			violate("stdin_blob", "must be a SHA-256 in lowercase hex")
+		} else if request.Stdin != "" || len(request.StdinBytes) > 0 {
+			violate("stdin_blob", "must be empty when stdin or stdin_bytes is set")
+		}
+	}
+
+	if len(request.Files) > maxInputFiles {
+		violate("files", "must not have more than %d files", maxInputFiles)
+	}
+	fileNames := map[string]bool{name: true}
+	for i, file := range request.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		switch {
+		case !filepath.IsLocal(file.Name) || path.Clean(file.Name) != file.Name || strings.ContainsAny(file.Name, "\\\x00"):
+			violate(field+".name", "must be a relative path inside the working directory")
+		case reservedFileNames[file.Name]:
+			violate(field+".name", "%s is reserved for the scripts of the job", file.Name)
+		case fileNames[file.Name]:
+			violate(field+".name", "%s is already written by the request", file.Name)
+		}
+		fileNames[file.Name] = true
+		if !blob.ValidDigest(file.Blob) {
+			violate(field+".blob", "must be a SHA-256 in lowercase hex")
+		}
+	}
+
+	for i, variable := range request.EnvironmentVariables {
+		if !environmentVariablePattern.MatchString(variable) || strings.ContainsRune(variable, 0) {
+			violate(fmt.Sprintf("environment_variables[%d]", i), "must have the form NAME=value")
+		}
+	}
+
+	if len(request.OutputFiles) > maxOutputFilePatterns {
+		violate("output_files", "must not have more than %d patterns", maxOutputFilePatterns)
+	}
+	for i, pattern := range request.OutputFiles {
+		field := fmt.Sprintf("output_files[%d]", i)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			violate(field, "must be a valid pattern")
+		} else if path.IsAbs(pattern) || slices.Contains(strings.Split(pattern, "/"), "..") {
+			violate(field, "must be relative to the working directory")
+		}
+	}
+
+	if request.CallbackUrl != "" {
+		callbackURL, err := url.Parse(request.CallbackUrl)
+		if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+			violate("callback_url", "must be an absolute http or https URL")
+		}
+	}
+
+	resourceLimits := request.GetResourceLimits()
+	if resourceLimits.GetMaxExecutionTime() < 0 {
+		violate("resource_limits.max_execution_time", "must not be negative")
+	}
+	if resourceLimits.GetMaxMemory() < 0 {
+		violate("resource_limits.max_memory", "must not be negative")
+	}
+	if resourceLimits.GetMaxOutputSize() < 0 {
+		violate("resource_limits.max_output_size", "must not be negative")
+	}
+	if resourceLimits.GetMaxOutputFilesSize() < 0 {
+		violate("resource_limits.max_output_files_size", "must not be negative")
+	}
+	if resourceLimits.GetMaxCompileTime() < 0 {
+		violate("resource_limits.max_compile_time", "must not be negative")
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	invalid, err := status.New(codes.InvalidArgument, "invalid job request").WithDetails(&errdetails.BadRequest{
+		FieldViolations: violations,
+	})
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid job request: %s", violations[0].Description)
+	}
+	return invalid.Err()
+}
+
+// withLimits returns a copy of request whose unset limits are replaced by the
+// defaults and whose limits above the maxima of the server or of client are
+// lowered to them. client may be nil.
+func withLimits(request *job.JobRequest, limits *config.LimitsConfig, client *config.ClientConfig) *job.JobRequest {
+	request = proto.Clone(request).(*job.JobRequest)
+	if request.ResourceLimits == nil {
+		request.ResourceLimits = &job.ResourceLimits{}
+	}
+
+	maximum := limits.Maximum
+	if client != nil {
+		maximum = config.ResourceLimits{
+			MaxExecutionTime:   time.Duration(lower(int64(maximum.MaxExecutionTime), int64(client.Limits.MaxExecutionTime))),
+			MaxMemory:          lower(maximum.MaxMemory, client.Limits.MaxMemory),
+			MaxOutputSize:      lower(maximum.MaxOutputSize, client.Limits.MaxOutputSize),
+			MaxOutputFilesSize: lower(maximum.MaxOutputFilesSize, client.Limits.MaxOutputFilesSize),
+		}
+	}
+
+	resourceLimits := request.ResourceLimits
+	resourceLimits.MaxExecutionTime = limit(resourceLimits.MaxExecutionTime, limits.Default.MaxExecutionTime.Milliseconds(), maximum.MaxExecutionTime.Milliseconds())
+	resourceLimits.MaxMemory = limit(resourceLimits.MaxMemory, limits.Default.MaxMemory, maximum.MaxMemory)
+	resourceLimits.MaxOutputSize = limit(resourceLimits.MaxOutputSize, limits.Default.MaxOutputSize, maximum.MaxOutputSize)
+	resourceLimits.MaxOutputFilesSize = limit(resourceLimits.MaxOutputFilesSize, limits.Default.MaxOutputFilesSize, maximum.MaxOutputFilesSize)
+	resourceLimits.MaxCompileTime = limit(resourceLimits.MaxCompileTime, limits.MaxCompileTime.Milliseconds(), limits.MaxCompileTime.Milliseconds())
+	return request
+}
+
+func limit(requested, defaultValue, maximum int64) int64 {
+	if requested == 0 {
+		requested = defaultValue
+	}
+	return min(requested, maximum)
+}
+
+// lower returns the lower of two maxima where zero means no maximum.
+func lower(maximum, clientMaximum int64) int64 {
+	if clientMaximum == 0 {
+		return maximum
+	}
+	return min(maximum, clientMaximum)
+}
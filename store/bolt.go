@@ -0,0 +1,138 @@
+package store
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+var jobsBucket = []byte("jobs")
+
+// openTimeout bounds how long opening waits for another process holding the
+// database file.
+const openTimeout = 5 * time.Second
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates an embedded BoltDB database file.
+func NewBoltStore(path string) (error, Store) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open job store: %w", err), nil
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to initialize job store: %w", err), nil
+	}
+
+	return nil, &boltStore{
+		db: db,
+	}
+}
+
+func (b *boltStore) Put(ctx context.Context, record *job.JobRecord) error {
+	content, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(record.JobId), content)
+	})
+}
+
+func (b *boltStore) Get(ctx context.Context, jobID string) (error, *job.JobRecord) {
+	record := &job.JobRecord{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(jobsBucket).Get([]byte(jobID))
+		if content == nil {
+			return ErrNotFound
+		}
+		return proto.Unmarshal(content, record)
+	})
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, record
+}
+
+func (b *boltStore) List(ctx context.Context, filter *Filter) (error, []*job.JobRecord) {
+	records := make([]*job.JobRecord, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(jobsBucket).Cursor()
+		// Keys sort by creation time, so walk backwards from the newest
+		for key, content := cursor.Last(); key != nil; key, content = cursor.Prev() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			record := &job.JobRecord{}
+			if err := proto.Unmarshal(content, record); err != nil {
+				return fmt.Errorf("corrupt job record %s: %w", key, err)
+			}
+			if !filter.CreatedAfter.IsZero() && record.CreatedAt < filter.CreatedAfter.UnixMilli() {
+				break
+			}
+			if !filter.Matches(record) {
+				continue
+			}
+
+			records = append(records, record)
+			if filter.Limit > 0 && len(records) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, records
+}
+
+func (b *boltStore) Purge(ctx context.Context, before time.Time) (error, int) {
+	var expired [][]byte
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		cursor := bucket.Cursor()
+		for key, content := cursor.First(); key != nil; key, content = cursor.Next() {
+			record := &job.JobRecord{}
+			if err := proto.Unmarshal(content, record); err != nil {
+				return fmt.Errorf("corrupt job record %s: %w", key, err)
+			}
+			if record.CreatedAt >= before.UnixMilli() {
+				break
+			}
+			expired = append(expired, key)
+		}
+
+		// Deleting while iterating makes the cursor skip entries
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err, 0
+	}
+
+	return nil, len(expired)
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryStore struct {
+	lock    sync.RWMutex
+	records map[string]*job.JobRecord
+}
+
+// NewMemoryStore returns a store that forgets everything on restart.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		records: map[string]*job.JobRecord{},
+	}
+}
+
+func (m *memoryStore) Put(ctx context.Context, record *job.JobRecord) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.records[record.JobId] = proto.Clone(record).(*job.JobRecord)
+	return nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, jobID string) (error, *job.JobRecord) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	record, ok := m.records[jobID]
+	if !ok {
+		return ErrNotFound, nil
+	}
+	return nil, proto.Clone(record).(*job.JobRecord)
+}
+
+func (m *memoryStore) List(ctx context.Context, filter *Filter) (error, []*job.JobRecord) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	records := make([]*job.JobRecord, 0)
+	for _, record := range m.records {
+		if filter.Matches(record) {
+			records = append(records, proto.Clone(record).(*job.JobRecord))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].JobId > records[j].JobId
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return nil, records
+}
+
+func (m *memoryStore) Purge(ctx context.Context, before time.Time) (error, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	purged := 0
+	for jobID, record := range m.records {
+		if record.CreatedAt < before.UnixMilli() {
+			delete(m.records, jobID)
+			purged++
+		}
+	}
+	return nil, purged
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
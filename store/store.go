@@ -0,0 +1,57 @@
+package store
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("job not found")
+
+// Store persists job records. Job IDs are time-ordered (UUIDv7), stores rely
+// on this to list and purge records in creation order.
+type Store interface {
+	// Put inserts a record or replaces the one with the same job ID.
+	Put(ctx context.Context, record *job.JobRecord) error
+	Get(ctx context.Context, jobID string) (error, *job.JobRecord)
+	// List returns the records matching filter, newest first.
+	List(ctx context.Context, filter *Filter) (error, []*job.JobRecord)
+	// Purge deletes the records created before the given time and returns
+	// how many were deleted.
+	Purge(ctx context.Context, before time.Time) (error, int)
+	Close() error
+}
+
+type Filter struct {
+	State         job.JobState
+	Tenant        string
+	Client        string
+	CallbackState job.CallbackState
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+}
+
+// Matches reports whether a record passes the filter, the limit is ignored.
+func (f *Filter) Matches(record *job.JobRecord) bool {
+	if f.State != job.JobState_JOB_STATE_UNSPECIFIED && record.State != f.State {
+		return false
+	}
+	if f.Tenant != "" && record.Tenant != f.Tenant {
+		return false
+	}
+	if f.Client != "" && record.Client != f.Client {
+		return false
+	}
+	if f.CallbackState != job.CallbackState_CALLBACK_STATE_UNSPECIFIED && record.CallbackState != f.CallbackState {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && record.CreatedAt < f.CreatedAfter.UnixMilli() {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && record.CreatedAt >= f.CreatedBefore.UnixMilli() {
+		return false
+	}
+	return true
+}
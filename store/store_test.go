@@ -0,0 +1,146 @@
+package store
+
+import (
+	"ExecutionEngine/proto/job"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	err, boltStore := NewBoltStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { boltStore.Close() })
+
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"bolt":   boltStore,
+	}
+}
+
+// putRecords stores one record per tenant and state, created one minute apart
+// starting at base. The callback of the second one failed.
+func putRecords(t *testing.T, s Store, base time.Time) []*job.JobRecord {
+	t.Helper()
+
+	var records []*job.JobRecord
+	states := []job.JobState{job.JobState_JOB_STATE_COMPLETED, job.JobState_JOB_STATE_FAILED}
+	for i, tenant := range []string{"a", "b", "a", "b"} {
+		createdAt := base.Add(time.Duration(i) * time.Minute)
+		record := &job.JobRecord{
+			JobId:     uuid.Must(uuid.NewV7()).String(),
+			Tenant:    tenant,
+			State:     states[i%len(states)],
+			CreatedAt: createdAt.UnixMilli(),
+			Response:  &job.JobResponse{Status: "Finished"},
+		}
+		if i == 1 {
+			record.CallbackState = job.CallbackState_CALLBACK_STATE_FAILED
+		}
+		if err := s.Put(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+		// UUIDv7 only orders records created in different milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+	return records
+}
+
+func TestGetAndPut(t *testing.T) {
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			records := putRecords(t, s, time.Now())
+
+			err, record := s.Get(context.Background(), records[1].JobId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Tenant != "b" || record.Response.Status != "Finished" {
+				t.Errorf("record = %v, want the stored one", record)
+			}
+
+			record.State = job.JobState_JOB_STATE_RUNNING
+			if err := s.Put(context.Background(), record); err != nil {
+				t.Fatal(err)
+			}
+			err, updated := s.Get(context.Background(), record.JobId)
+			if err != nil || updated.State != job.JobState_JOB_STATE_RUNNING {
+				t.Errorf("updated record = %v, %v", updated, err)
+			}
+
+			if err, _ := s.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int
+	}{
+		{"everything newest first", Filter{}, []int{3, 2, 1, 0}},
+		{"by tenant", Filter{Tenant: "a"}, []int{2, 0}},
+		{"by state", Filter{State: job.JobState_JOB_STATE_FAILED}, []int{3, 1}},
+		{"by callback state", Filter{CallbackState: job.CallbackState_CALLBACK_STATE_FAILED}, []int{1}},
+		{"created after", Filter{CreatedAfter: base.Add(2 * time.Minute)}, []int{3, 2}},
+		{"created before", Filter{CreatedBefore: base.Add(2 * time.Minute)}, []int{1, 0}},
+		{"limit", Filter{Limit: 3}, []int{3, 2, 1}},
+		{"combined", Filter{Tenant: "b", State: job.JobState_JOB_STATE_FAILED, Limit: 1}, []int{3}},
+	}
+
+	for name, s := range newStores(t) {
+		records := putRecords(t, s, base)
+		for _, test := range tests {
+			err, listed := s.List(context.Background(), &test.filter)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, test.name, err)
+			}
+			if len(listed) != len(test.want) {
+				t.Errorf("%s, %s: listed %d records, want %d", name, test.name, len(listed), len(test.want))
+				continue
+			}
+			for i, index := range test.want {
+				if listed[i].JobId != records[index].JobId {
+					t.Errorf("%s, %s: record %d is %s, want %s", name, test.name, i, listed[i].JobId, records[index].JobId)
+				}
+			}
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			records := putRecords(t, s, base)
+
+			err, purged := s.Purge(context.Background(), base.Add(90*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if purged != 2 {
+				t.Errorf("purged %d records, want 2", purged)
+			}
+
+			err, listed := s.List(context.Background(), &Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listed) != 2 || listed[1].JobId != records[2].JobId {
+				t.Errorf("remaining records = %v, want the two newest", listed)
+			}
+		})
+	}
+}